@@ -0,0 +1,258 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+type CameraMode int32
+
+const (
+	// Rotate around, pan and zoom towards a focus point.
+	CameraOrbit CameraMode = iota
+	// Look around from the eye and move it with the keyboard.
+	CameraFly
+)
+
+var CameraModeNames = []string{"Orbit", "Fly"}
+
+// Keeps the camera from flipping over the poles.
+const maxPitch = math.Pi/2 - 0.01
+
+/**
+ * Where the camera is and what it's looking at.
+ * The eye sits Distance away from Target, in the direction given by Yaw and Pitch.
+ */
+type CameraPose struct {
+	Target               mgl32.Vec3
+	Yaw, Pitch, Distance float32
+}
+
+/**
+ * Pose with the eye at `eye`, looking at `target`.
+ */
+func PoseLookingAt(eye, target mgl32.Vec3) CameraPose {
+	offset := eye.Sub(target)
+	distance := offset.Len()
+	if distance == 0 {
+		return CameraPose{Target: target, Distance: 1}
+	}
+	return CameraPose{
+		Target:   target,
+		Yaw:      float32(math.Atan2(float64(offset[2]), float64(offset[0]))),
+		Pitch:    float32(math.Asin(float64(offset[1] / distance))),
+		Distance: distance,
+	}
+}
+
+/**
+ * Unit vector from the target to the eye.
+ */
+func (p CameraPose) direction() mgl32.Vec3 {
+	cosPitch := float32(math.Cos(float64(p.Pitch)))
+	return mgl32.Vec3{
+		cosPitch * float32(math.Cos(float64(p.Yaw))),
+		float32(math.Sin(float64(p.Pitch))),
+		cosPitch * float32(math.Sin(float64(p.Yaw))),
+	}
+}
+
+func (p CameraPose) Eye() mgl32.Vec3 {
+	return p.Target.Add(p.direction().Mul(p.Distance))
+}
+
+func (p CameraPose) Forward() mgl32.Vec3 {
+	return p.direction().Mul(-1)
+}
+
+func (p CameraPose) Right() mgl32.Vec3 {
+	return p.Forward().Cross(mgl32.Vec3{0, 1, 0}).Normalize()
+}
+
+func (p CameraPose) Up() mgl32.Vec3 {
+	return p.Right().Cross(p.Forward())
+}
+
+type CameraBookmark struct {
+	Name string
+	Pose CameraPose
+}
+
+/**
+ * Interactive camera. Input moves a goal pose, and the pose used for rendering
+ * follows it with exponential smoothing.
+ */
+type Camera struct {
+	Mode          CameraMode
+	current, goal CameraPose
+	// How quickly the camera catches up with its input, per second. Zero disables smoothing.
+	Smoothing float32
+	// Radians per pixel dragged.
+	RotateSpeed float32
+	// Fraction of the distance to the target panned per pixel dragged.
+	PanSpeed float32
+	// Fraction of the distance to the target zoomed per scroll step.
+	ZoomSpeed float32
+	// World units per second moved with the keyboard.
+	MoveSpeed float32
+	Bookmarks []CameraBookmark
+}
+
+func NewCamera(pose CameraPose) *Camera {
+	return &Camera{
+		Mode:        CameraOrbit,
+		current:     pose,
+		goal:        pose,
+		Smoothing:   12,
+		RotateSpeed: 0.005,
+		PanSpeed:    0.0015,
+		ZoomSpeed:   0.1,
+		MoveSpeed:   100,
+	}
+}
+
+/**
+ * The smoothed pose, used for rendering.
+ */
+func (c *Camera) Pose() CameraPose {
+	return c.current
+}
+
+/**
+ * Moves the camera to a pose, either straight away or smoothly.
+ */
+func (c *Camera) SetPose(pose CameraPose, immediate bool) {
+	// Turn the short way round.
+	for pose.Yaw-c.current.Yaw > math.Pi {
+		pose.Yaw -= 2 * math.Pi
+	}
+	for pose.Yaw-c.current.Yaw < -math.Pi {
+		pose.Yaw += 2 * math.Pi
+	}
+	c.goal = pose
+	if immediate {
+		c.current = pose
+	}
+}
+
+func (c *Camera) Eye() mgl32.Vec3 {
+	return c.current.Eye()
+}
+
+func (c *Camera) View() mgl32.Mat4 {
+	return mgl32.LookAtV(c.current.Eye(), c.current.Target, mgl32.Vec3{0, 1, 0})
+}
+
+/**
+ * Rotates by a mouse drag of (dx, dy) pixels. Orbit mode swings the eye around the target,
+ * fly mode turns the view around the eye.
+ */
+func (c *Camera) Rotate(dx, dy float32) {
+	eye := c.goal.Eye()
+	c.goal.Yaw += dx * c.RotateSpeed
+	c.goal.Pitch = clampPitch(c.goal.Pitch + dy*c.RotateSpeed)
+	if c.Mode == CameraFly {
+		c.goal.Target = eye.Sub(c.goal.direction().Mul(c.goal.Distance))
+	}
+}
+
+/**
+ * Slides the camera parallel to the view by a mouse drag of (dx, dy) pixels,
+ * so the scene follows the cursor.
+ */
+func (c *Camera) Pan(dx, dy float32) {
+	scale := c.goal.Distance * c.PanSpeed
+	offset := c.goal.Right().Mul(-dx * scale).Add(c.goal.Up().Mul(dy * scale))
+	c.goal.Target = c.goal.Target.Add(offset)
+}
+
+/**
+ * Zooms by a number of scroll steps, positive zooms in. Fly mode moves the eye forward instead.
+ */
+func (c *Camera) Zoom(steps float32) {
+	if c.Mode == CameraFly {
+		c.goal.Target = c.goal.Target.Add(c.goal.Forward().Mul(steps * c.goal.Distance * c.ZoomSpeed))
+		return
+	}
+	c.goal.Distance *= float32(math.Exp(float64(-steps * c.ZoomSpeed)))
+	c.goal.Distance = float32(math.Max(1, float64(c.goal.Distance)))
+}
+
+/**
+ * Moves the eye and target together, `forward`, `right` and `up` are in [-1, 1].
+ * Orbit mode keeps forward and right level with the ground so the target stays at the same height.
+ */
+func (c *Camera) Move(forward, right, up, dt float32) {
+	forwardDir, rightDir := c.goal.Forward(), c.goal.Right()
+	if c.Mode == CameraOrbit {
+		forwardDir = mgl32.Vec3{forwardDir[0], 0, forwardDir[2]}
+		if forwardDir.Len() > 0 {
+			forwardDir = forwardDir.Normalize()
+		}
+	}
+	offset := forwardDir.Mul(forward).Add(rightDir.Mul(right)).Add(mgl32.Vec3{0, up, 0})
+	c.goal.Target = c.goal.Target.Add(offset.Mul(c.MoveSpeed * dt))
+}
+
+/**
+ * Advances the smoothed pose towards the goal by dt seconds.
+ */
+func (c *Camera) Update(dt float32) {
+	if c.Smoothing <= 0 {
+		c.current = c.goal
+		return
+	}
+	t := 1 - float32(math.Exp(float64(-c.Smoothing*dt)))
+	c.current = CameraPose{
+		Target:   c.current.Target.Add(c.goal.Target.Sub(c.current.Target).Mul(t)),
+		Yaw:      c.current.Yaw + (c.goal.Yaw-c.current.Yaw)*t,
+		Pitch:    c.current.Pitch + (c.goal.Pitch-c.current.Pitch)*t,
+		Distance: c.current.Distance + (c.goal.Distance-c.current.Distance)*t,
+	}
+}
+
+/**
+ * Stores the current pose under a name.
+ */
+func (c *Camera) AddBookmark(name string) {
+	c.Bookmarks = append(c.Bookmarks, CameraBookmark{Name: name, Pose: c.goal})
+}
+
+func (c *Camera) RemoveBookmark(index int) {
+	c.Bookmarks = append(c.Bookmarks[:index], c.Bookmarks[index+1:]...)
+}
+
+/**
+ * Flies to a bookmarked pose.
+ */
+func (c *Camera) GoToBookmark(index int) {
+	c.SetPose(c.Bookmarks[index].Pose, false)
+}
+
+func (c *Camera) SaveBookmarks(path string) error {
+	data, err := json.MarshalIndent(c.Bookmarks, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func (c *Camera) LoadBookmarks(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var bookmarks []CameraBookmark
+	if err := json.Unmarshal(data, &bookmarks); err != nil {
+		return err
+	}
+	c.Bookmarks = bookmarks
+	return nil
+}
+
+func clampPitch(pitch float32) float32 {
+	return float32(math.Max(-maxPitch, math.Min(maxPitch, float64(pitch))))
+}
@@ -0,0 +1,53 @@
+package core
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+/**
+ * The six clip planes of a camera (left, right, bottom, top, near, far) as (normal, distance),
+ * with normals pointing into the visible volume.
+ */
+type Frustum [6]mgl32.Vec4
+
+/**
+ * Extracts the frustum planes from a combined projection * view matrix.
+ */
+func NewFrustum(viewProjection mgl32.Mat4) Frustum {
+	var f Frustum
+	w := viewProjection.Row(3)
+	for axis := 0; axis < 3; axis++ {
+		row := viewProjection.Row(axis)
+		f[axis*2] = normalisePlane(w.Add(row))
+		f[axis*2+1] = normalisePlane(w.Sub(row))
+	}
+	return f
+}
+
+func normalisePlane(plane mgl32.Vec4) mgl32.Vec4 {
+	length := plane.Vec3().Len()
+	if length == 0 {
+		return plane
+	}
+	return plane.Mul(1 / length)
+}
+
+/**
+ * Reports whether any part of an axis aligned box may be visible.
+ * Conservative: boxes near the corners of the frustum can pass without being on screen.
+ */
+func (f Frustum) IntersectsBox(min, max mgl32.Vec3) bool {
+	for _, plane := range f {
+		// The corner of the box furthest along the plane normal.
+		corner := min
+		for i := 0; i < 3; i++ {
+			if plane[i] >= 0 {
+				corner[i] = max[i]
+			}
+		}
+		if plane.Vec3().Dot(corner)+plane[3] < 0 {
+			return false
+		}
+	}
+	return true
+}
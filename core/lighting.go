@@ -0,0 +1,204 @@
+package core
+
+import (
+	"math"
+
+	"github.com/go-gl/gl/v4.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	shadowVertexShaderPath   = "shadow.vert"
+	shadowFragmentShaderPath = "shadow.frag"
+	horizonAOShaderPath      = "HorizonAO.comp"
+)
+
+// Texture units the shadow map and ambient occlusion are bound to, match the bindings in main.frag.
+// The occlusion is baked through the image unit of the same number.
+const (
+	ShadowTextureUnit = 5
+	AOTextureUnit     = 6
+)
+
+/**
+ * A directional light, angles in degrees.
+ * Azimuth turns from +X towards +Z, elevation is above the horizon.
+ */
+type Sun struct {
+	Azimuth, Elevation float32
+}
+
+/**
+ * Unit vector pointing towards the sun.
+ */
+func (s Sun) Direction() mgl32.Vec3 {
+	azimuth := float64(mgl32.DegToRad(s.Azimuth))
+	elevation := float64(mgl32.DegToRad(s.Elevation))
+	return mgl32.Vec3{
+		float32(math.Cos(elevation) * math.Cos(azimuth)),
+		float32(math.Sin(elevation)),
+		float32(math.Cos(elevation) * math.Sin(azimuth)),
+	}
+}
+
+type LightingSettings struct {
+	Sun     Sun
+	Shadows bool
+	// Depth offset against shadow acne, in shadow map depth units.
+	ShadowBias float32
+	// Darkens the ambient light where the surrounding terrain hides the sky.
+	AmbientOcclusion bool
+	// World distance searched for occluding terrain.
+	AORadius float32
+	// Rebake the occlusion as the terrain erodes, rather than only on request.
+	AOAutoUpdate bool
+}
+
+func DefaultLightingSettings() LightingSettings {
+	return LightingSettings{
+		Sun:              Sun{Azimuth: 45, Elevation: 70},
+		Shadows:          true,
+		ShadowBias:       0.002,
+		AmbientOcclusion: true,
+		AORadius:         30,
+		AOAutoUpdate:     true,
+	}
+}
+
+/**
+ * Depth of the terrain seen from the sun, for shadowing.
+ */
+type ShadowMap struct {
+	size                 int32
+	texture, framebuffer uint32
+	program              *Program
+	// Takes world positions to the shadow map's clip space, as of the last Render.
+	LightSpace mgl32.Mat4
+}
+
+func NewShadowMap(size int32) (*ShadowMap, error) {
+	program, err := NewProgramFromPath(shadowVertexShaderPath, shadowFragmentShaderPath)
+	if err != nil {
+		return nil, err
+	}
+	var s = &ShadowMap{size: size, program: program, LightSpace: mgl32.Ident4()}
+
+	gl.GenTextures(1, &s.texture)
+	gl.BindTexture(gl.TEXTURE_2D, s.texture)
+	gl.TexStorage2D(gl.TEXTURE_2D, 1, gl.DEPTH_COMPONENT32F, size, size)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	// Hardware depth comparison, so linear filtering gives soft edges.
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_COMPARE_MODE, gl.COMPARE_REF_TO_TEXTURE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_COMPARE_FUNC, gl.LEQUAL)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+
+	gl.GenFramebuffers(1, &s.framebuffer)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, s.framebuffer)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.TEXTURE_2D, s.texture, 0)
+	gl.DrawBuffer(gl.NONE)
+	gl.ReadBuffer(gl.NONE)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	return s, nil
+}
+
+func (s *ShadowMap) Texture() uint32 {
+	return s.texture
+}
+
+/**
+ * Renders the terrain's depth from the sun. The shadow map covers the whole terrain,
+ * levels of detail still follow the camera so the shadows match what's drawn.
+ */
+func (s *ShadowMap) Render(terrain *ChunkedTerrain, sunDirection, cameraPos mgl32.Vec3, heightScale float32, heightTexture uint32) {
+	min, max := terrain.Bounds(heightScale)
+	centre := min.Add(max).Mul(0.5)
+	radius := max.Sub(min).Len() / 2
+
+	up := mgl32.Vec3{0, 1, 0}
+	if math.Abs(float64(sunDirection.Dot(up))) > 0.99 {
+		up = mgl32.Vec3{1, 0, 0}
+	}
+	view := mgl32.LookAtV(centre.Add(sunDirection.Mul(radius*2)), centre, up)
+	projection := mgl32.Ortho(-radius, radius, -radius, radius, radius, radius*3)
+	s.LightSpace = projection.Mul4(view)
+
+	var viewport [4]int32
+	gl.GetIntegerv(gl.VIEWPORT, &viewport[0])
+	gl.BindFramebuffer(gl.FRAMEBUFFER, s.framebuffer)
+	gl.Viewport(0, 0, s.size, s.size)
+	gl.Clear(gl.DEPTH_BUFFER_BIT)
+	gl.Enable(gl.POLYGON_OFFSET_FILL)
+	gl.PolygonOffset(2, 4)
+
+	s.program.Use()
+	s.program.SetMat4("lightSpace", s.LightSpace)
+	s.program.SetFloat("height", heightScale)
+	s.program.SetFloat("skirtDepth", terrain.SkirtDepth)
+	s.program.SetFloat("sampleLod", terrain.SampleLOD())
+	gl.ActiveTexture(gl.TEXTURE2)
+	gl.BindTexture(gl.TEXTURE_2D, heightTexture)
+	gl.ActiveTexture(gl.TEXTURE0)
+	terrain.Draw(s.LightSpace, cameraPos, heightScale)
+
+	gl.Disable(gl.POLYGON_OFFSET_FILL)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	gl.Viewport(viewport[0], viewport[1], viewport[2], viewport[3])
+}
+
+/**
+ * Horizon based ambient occlusion of the heightfield, baked into a texture with a cell per texel.
+ */
+type HorizonAO struct {
+	// Directions searched around each cell, and steps taken along each.
+	Directions, Steps int32
+	texture           uint32
+	width, height     int
+	program           *Program
+}
+
+func NewHorizonAO() (*HorizonAO, error) {
+	program, err := NewComputeProgramFromPath(horizonAOShaderPath)
+	if err != nil {
+		return nil, err
+	}
+	return &HorizonAO{Directions: 8, Steps: 16, program: program}, nil
+}
+
+func (a *HorizonAO) Texture() uint32 {
+	return a.texture
+}
+
+/**
+ * Recomputes the occlusion of a width x height heightfield from its sampled height texture
+ * (see GPUEroder.HeightSampleTexture). radius and cellSize are in world units.
+ */
+func (a *HorizonAO) Bake(heightTexture uint32, width, height int, radius, cellSize, heightScale float32) {
+	if a.texture == 0 || a.width != width || a.height != height {
+		gl.DeleteTextures(1, &a.texture)
+		gl.GenTextures(1, &a.texture)
+		gl.BindTexture(gl.TEXTURE_2D, a.texture)
+		gl.TexStorage2D(gl.TEXTURE_2D, 1, gl.R32F, int32(width), int32(height))
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+		gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+		gl.BindTexture(gl.TEXTURE_2D, 0)
+		a.width, a.height = width, height
+	}
+
+	a.program.Use()
+	a.program.SetInt("directions", a.Directions)
+	a.program.SetInt("steps", a.Steps)
+	a.program.SetFloat("radius", radius)
+	a.program.SetFloat("cellSize", cellSize)
+	a.program.SetFloat("heightScale", heightScale)
+	gl.ActiveTexture(gl.TEXTURE2)
+	gl.BindTexture(gl.TEXTURE_2D, heightTexture)
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindImageTexture(AOTextureUnit, a.texture, 0, false, 0, gl.WRITE_ONLY, gl.R32F)
+	gl.DispatchCompute(uint32(width+15)/16, uint32(height+15)/16, 1)
+	gl.MemoryBarrier(gl.TEXTURE_FETCH_BARRIER_BIT)
+}
@@ -0,0 +1,190 @@
+package core
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strings"
+
+	"github.com/go-gl/gl/v4.3-core/gl"
+)
+
+// Upper bound on layers, the terrain shader has arrays of this size.
+const MaxMaterials = 8
+
+// Every albedo texture is resampled to this size so they fit in one texture array.
+const materialTextureSize = 512
+
+// Texture unit the albedo array is bound to, matches the binding in main.frag.
+const MaterialTextureUnit = 3
+
+/**
+ * One layer of terrain surface. Layers are painted over each other in order,
+ * each covering the terrain where both the height and slope are inside its ranges.
+ */
+type Material struct {
+	Name string
+	// Albedo image, tinted by Colour. Left empty the layer is just Colour.
+	Texture string
+	Colour  [3]float32
+	// World units covered by one repeat of the texture.
+	Scale float32
+	// In simulation height units.
+	MinHeight, MaxHeight float32
+	// In degrees from flat.
+	MinSlope, MaxSlope float32
+	// How quickly the layer fades out beyond its ranges, higher is a harder edge.
+	Sharpness float32
+}
+
+func DefaultMaterials() []Material {
+	return []Material{
+		{Name: "Grass", Colour: [3]float32{0.25, 0.55, 0.15}, Scale: 8, MinHeight: -1, MaxHeight: 10, MinSlope: 0, MaxSlope: 90, Sharpness: 4},
+		{Name: "Sand", Colour: [3]float32{0.76, 0.7, 0.5}, Scale: 8, MinHeight: -1, MaxHeight: 0.15, MinSlope: 0, MaxSlope: 20, Sharpness: 4},
+		{Name: "Rock", Colour: [3]float32{0.45, 0.42, 0.4}, Scale: 16, MinHeight: -1, MaxHeight: 10, MinSlope: 35, MaxSlope: 90, Sharpness: 4},
+		{Name: "Snow", Colour: [3]float32{0.95, 0.95, 1.0}, Scale: 8, MinHeight: 0.7, MaxHeight: 10, MinSlope: 0, MaxSlope: 45, Sharpness: 4},
+	}
+}
+
+/**
+ * The material layers of the terrain and the texture array holding their albedo.
+ */
+type MaterialSet struct {
+	Materials []Material
+	texture   uint32
+	// Texture path each layer of the array was built from, to tell when it needs rebuilding.
+	built []string
+}
+
+func NewMaterialSet(materials []Material) *MaterialSet {
+	return &MaterialSet{Materials: materials}
+}
+
+/**
+ * Whether the texture array is out of date with the layers.
+ */
+func (m *MaterialSet) Stale() bool {
+	if len(m.built) != len(m.Materials) {
+		return true
+	}
+	for i, material := range m.Materials {
+		if m.built[i] != material.Texture {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Rebuilds the albedo texture array. Layers whose image can't be loaded are left white,
+ * so they show as their colour, and are reported in the returned error.
+ */
+func (m *MaterialSet) UpdateTextures() error {
+	count := len(m.Materials)
+	if count == 0 {
+		count = 1
+	}
+	levels := int32(1)
+	for size := materialTextureSize; size > 1; size /= 2 {
+		levels++
+	}
+
+	gl.DeleteTextures(1, &m.texture)
+	gl.GenTextures(1, &m.texture)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, m.texture)
+	gl.TexStorage3D(gl.TEXTURE_2D_ARRAY, levels, gl.RGBA8, materialTextureSize, materialTextureSize, int32(count))
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_WRAP_S, gl.REPEAT)
+	gl.TexParameteri(gl.TEXTURE_2D_ARRAY, gl.TEXTURE_WRAP_T, gl.REPEAT)
+
+	var failed []string
+	m.built = make([]string, len(m.Materials))
+	for i, material := range m.Materials {
+		m.built[i] = material.Texture
+		pixels, err := loadAlbedo(material.Texture)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", material.Name, err))
+		}
+		gl.TexSubImage3D(gl.TEXTURE_2D_ARRAY, 0, 0, 0, int32(i), materialTextureSize, materialTextureSize, 1, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(pixels))
+	}
+	gl.GenerateMipmap(gl.TEXTURE_2D_ARRAY)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, 0)
+
+	if len(failed) > 0 {
+		return fmt.Errorf("couldn't load material textures: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+/**
+ * Reads an image resampled to the texture array size, or plain white for an empty path or on error.
+ */
+func loadAlbedo(path string) ([]uint8, error) {
+	pixels := make([]uint8, materialTextureSize*materialTextureSize*4)
+	for i := range pixels {
+		pixels[i] = 255
+	}
+	if path == "" {
+		return pixels, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return pixels, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return pixels, err
+	}
+
+	// Nearest sampling is enough, the mipmaps take care of minification.
+	bounds := img.Bounds()
+	for y := 0; y < materialTextureSize; y++ {
+		for x := 0; x < materialTextureSize; x++ {
+			sx := bounds.Min.X + x*bounds.Dx()/materialTextureSize
+			sy := bounds.Min.Y + y*bounds.Dy()/materialTextureSize
+			r, g, b, a := img.At(sx, sy).RGBA()
+			index := (x + y*materialTextureSize) * 4
+			pixels[index+0] = uint8(r >> 8)
+			pixels[index+1] = uint8(g >> 8)
+			pixels[index+2] = uint8(b >> 8)
+			pixels[index+3] = uint8(a >> 8)
+		}
+	}
+	return pixels, nil
+}
+
+/**
+ * Uploads the layers to a program using the material uniforms of main.frag, and binds the texture array.
+ * Layers past MaxMaterials are ignored.
+ */
+func (m *MaterialSet) Bind(program *Program) {
+	count := len(m.Materials)
+	if count > MaxMaterials {
+		count = MaxMaterials
+	}
+	var colours [MaxMaterials * 3]float32
+	var ranges [MaxMaterials * 4]float32
+	var params [MaxMaterials * 2]float32
+	for i, material := range m.Materials[:count] {
+		copy(colours[i*3:], material.Colour[:])
+		ranges[i*4+0] = material.MinHeight
+		ranges[i*4+1] = material.MaxHeight
+		ranges[i*4+2] = material.MinSlope
+		ranges[i*4+3] = material.MaxSlope
+		params[i*2+0] = material.Sharpness
+		params[i*2+1] = material.Scale
+	}
+
+	program.SetInt("materialCount", int32(count))
+	program.SetVectorArray("materialColour", 3, colours[:])
+	program.SetVectorArray("materialRange", 4, ranges[:])
+	program.SetVectorArray("materialParams", 2, params[:])
+
+	gl.ActiveTexture(gl.TEXTURE0 + MaterialTextureUnit)
+	gl.BindTexture(gl.TEXTURE_2D_ARRAY, m.texture)
+	gl.ActiveTexture(gl.TEXTURE0)
+}
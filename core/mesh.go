@@ -5,6 +5,17 @@ import (
 	"unsafe"
 )
 
+/**
+ * Vertex layout shared by every mesh: position (3), normal (3), texcoord (2), sample coords (2).
+ * The sample coords address the texel of the simulation state textures a vertex is displaced by.
+ */
+const (
+	VertexStride      = 10
+	NormalOffset      = 3
+	TexCoordOffset    = 6
+	SampleCoordOffset = 8
+)
+
 type Mesh struct {
 	Vertices      []float32
 	Texture       uint32
@@ -26,11 +37,44 @@ func (m Mesh) Draw() {
 	gl.BindVertexArray(0)
 }
 
-func (m *Mesh) Construct() {
-	// Free up memory used for last buffers
+/**
+ * Draws the mesh using an index buffer shared with other meshes of the same layout.
+ */
+func (m *Mesh) DrawIndexed(ebo uint32, count int32) {
+	gl.BindVertexArray(m.vao)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, ebo)
+	gl.DrawElements(m.RenderMode, count, gl.UNSIGNED_INT, unsafe.Pointer(nil))
+	gl.BindVertexArray(0)
+}
+
+/**
+ * The vertex buffer, so compute passes can write into the vertex data directly.
+ */
+func (m *Mesh) VertexBuffer() uint32 {
+	return m.vbo
+}
+
+/**
+ * Re-uploads the vertex data after it has been modified on the CPU.
+ */
+func (m *Mesh) UpdateVertices() {
+	gl.BindBuffer(gl.ARRAY_BUFFER, m.vbo)
+	gl.BufferSubData(gl.ARRAY_BUFFER, 0, len(m.Vertices)*4, gl.Ptr(m.Vertices))
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+}
+
+/**
+ * Frees the GPU buffers of the mesh.
+ */
+func (m *Mesh) Delete() {
 	gl.DeleteVertexArrays(1, &m.vao)
 	gl.DeleteBuffers(1, &m.vbo)
 	gl.DeleteBuffers(1, &m.ebo)
+}
+
+func (m *Mesh) Construct() {
+	// Free up memory used for last buffers
+	m.Delete()
 
 	// Vertex Array Object Setup
 	gl.GenVertexArrays(1, &m.vao)
@@ -45,27 +89,29 @@ func (m *Mesh) Construct() {
 
 	// Send vertex data to a VBO
 	gl.BindBuffer(gl.ARRAY_BUFFER, m.vbo)
-	gl.BufferData(gl.ARRAY_BUFFER, len(m.Vertices)*4, gl.Ptr(m.Vertices), gl.STATIC_DRAW)
+	gl.BufferData(gl.ARRAY_BUFFER, len(m.Vertices)*4, gl.Ptr(m.Vertices), gl.DYNAMIC_DRAW)
 
-	// Send index data to a EBO
-	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, m.ebo)
-	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(m.Indices)*4, gl.Ptr(m.Indices), gl.STATIC_DRAW)
+	// Send index data to a EBO, meshes drawn with shared index buffers (see DrawIndexed) have none.
+	if len(m.Indices) > 0 {
+		gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, m.ebo)
+		gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(m.Indices)*4, gl.Ptr(m.Indices), gl.STATIC_DRAW)
+	}
 
-	// Setup Vertex Attrib Pointers so VBO is read correctly (positions, normals, texcoords)
+	// Setup Vertex Attrib Pointers so VBO is read correctly (positions, normals, texcoords, sample coords)
 	gl.EnableVertexAttribArray(0)
-	gl.VertexAttribPointer(0, 3, gl.FLOAT, false, 9*4, gl.PtrOffset(0))
+	gl.VertexAttribPointer(0, 3, gl.FLOAT, false, VertexStride*4, gl.PtrOffset(0))
 
 	// Normal Vector
 	gl.EnableVertexAttribArray(1)
-	gl.VertexAttribPointer(1, 3, gl.FLOAT, false, 9*4, gl.PtrOffset(3*4))
+	gl.VertexAttribPointer(1, 3, gl.FLOAT, false, VertexStride*4, gl.PtrOffset(NormalOffset*4))
 
 	// Texture Coords
 	gl.EnableVertexAttribArray(2)
-	gl.VertexAttribPointer(2, 2, gl.FLOAT, false, 9*4, gl.PtrOffset(6*4))
+	gl.VertexAttribPointer(2, 2, gl.FLOAT, false, VertexStride*4, gl.PtrOffset(TexCoordOffset*4))
 
-	// Lookup Index
+	// Sample Coords
 	gl.EnableVertexAttribArray(3)
-	gl.VertexAttribPointer(3, 1, gl.FLOAT, false, 9*4, gl.PtrOffset(8*4))
+	gl.VertexAttribPointer(3, 2, gl.FLOAT, false, VertexStride*4, gl.PtrOffset(SampleCoordOffset*4))
 
 	gl.BindVertexArray(0)
 }
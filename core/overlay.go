@@ -0,0 +1,240 @@
+package core
+
+import (
+	"math"
+
+	"github.com/go-gl/gl/v4.3-core/gl"
+)
+
+// Texture units of the simulation state only the overlay reads, match the bindings in main.frag.
+// The height and velocity come from units 2 and 4, shared with the terrain and water.
+const (
+	OutflowTextureUnit       = 7
+	InitialHeightTextureUnit = 8
+)
+
+// Upper bound on colour ramp stops, main.frag has an array of this size.
+const MaxRampStops = 8
+
+// Texels across the legend image of a ramp.
+const legendTextureSize = 256
+
+/**
+ * Simulation channel the terrain is coloured by. Keep in step with the OVERLAY_ constants in main.frag.
+ */
+type OverlayChannel int32
+
+const (
+	OverlayNone OverlayChannel = iota
+	OverlayWater
+	OverlaySediment
+	OverlaySpeed
+	OverlayDirection
+	OverlayOutflow
+	OverlayErosion
+	OverlaySlope
+)
+
+var OverlayChannelNames = []string{
+	"None", "Water Depth", "Suspended Sediment", "Velocity Magnitude", "Velocity Direction",
+	"Outflow", "Erosion / Deposition Since Edit", "Slope",
+}
+
+/**
+ * A sensible range of values to start with, in simulation units (degrees for slope).
+ */
+func (c OverlayChannel) DefaultRange() (min, max float32) {
+	switch c {
+	case OverlayWater:
+		return 0, 0.05
+	case OverlaySediment:
+		return 0, 0.01
+	case OverlaySpeed, OverlayDirection:
+		return 0, 1
+	case OverlayOutflow:
+		return 0, 0.1
+	case OverlayErosion:
+		return -0.01, 0.01
+	case OverlaySlope:
+		return 0, 90
+	}
+	return 0, 1
+}
+
+/**
+ * The ramp that reads best for the channel, diverging for signed values.
+ */
+func (c OverlayChannel) DefaultRamp() ColourRamp {
+	switch c {
+	case OverlayWater:
+		return RampBlues
+	case OverlayErosion:
+		return RampDiverging
+	case OverlaySlope:
+		return RampMagma
+	}
+	return RampViridis
+}
+
+type ColourRamp int32
+
+const (
+	RampViridis ColourRamp = iota
+	RampMagma
+	RampBlues
+	RampDiverging
+	RampGreyscale
+)
+
+var ColourRampNames = []string{"Viridis", "Magma", "Blues", "Diverging (Red / Blue)", "Greyscale"}
+
+// Evenly spaced stops from the low end of each ramp to the high end.
+var rampStops = [][][3]float32{
+	RampViridis: {
+		{0.267, 0.005, 0.329}, {0.275, 0.194, 0.496}, {0.212, 0.359, 0.552}, {0.153, 0.497, 0.558},
+		{0.122, 0.633, 0.530}, {0.288, 0.758, 0.428}, {0.626, 0.854, 0.223}, {0.993, 0.906, 0.144},
+	},
+	RampMagma: {
+		{0.001, 0.000, 0.014}, {0.171, 0.064, 0.370}, {0.445, 0.122, 0.506}, {0.716, 0.215, 0.475},
+		{0.945, 0.376, 0.365}, {0.994, 0.624, 0.427}, {0.987, 0.991, 0.750},
+	},
+	RampBlues: {
+		{0.969, 0.984, 1.000}, {0.776, 0.859, 0.937}, {0.420, 0.682, 0.839}, {0.129, 0.443, 0.710}, {0.031, 0.188, 0.420},
+	},
+	RampDiverging: {
+		{0.698, 0.094, 0.169}, {0.937, 0.541, 0.384}, {0.969, 0.969, 0.969}, {0.404, 0.663, 0.812}, {0.129, 0.400, 0.675},
+	},
+	RampGreyscale: {
+		{0, 0, 0}, {1, 1, 1},
+	},
+}
+
+/**
+ * Colour at t in [0, 1] along the ramp, interpolated the same way as main.frag.
+ */
+func (r ColourRamp) Colour(t float32) [3]float32 {
+	stops := rampStops[r]
+	t = float32(math.Max(0, math.Min(1, float64(t)))) * float32(len(stops)-1)
+	i := int(t)
+	if i > len(stops)-2 {
+		i = len(stops) - 2
+	}
+	f := t - float32(i)
+	var c [3]float32
+	for k := range c {
+		c[k] = stops[i][k] + (stops[i+1][k]-stops[i][k])*f
+	}
+	return c
+}
+
+type OverlaySettings struct {
+	Channel OverlayChannel
+	Ramp    ColourRamp
+	// Values mapped to the two ends of the ramp. Velocity direction is coloured by hue,
+	// the range sets the speed at which it's fully bright.
+	Min, Max float32
+	// How much the overlay covers the terrain's own colour.
+	Opacity float32
+	// Flow direction glyphs, one per Spacing cells, full length at ArrowSpeed.
+	Arrows                   bool
+	ArrowSpacing, ArrowSpeed float32
+	// Lines of constant height every ContourInterval from ContourBase, in simulation height units,
+	// with every ContourIndexEvery'th drawn heavier. Matches heightmap.ContourOptions.
+	Contours                     bool
+	ContourInterval, ContourBase float32
+	ContourIndexEvery            int32
+}
+
+func DefaultOverlaySettings() OverlaySettings {
+	min, max := OverlayNone.DefaultRange()
+	return OverlaySettings{
+		Channel:           OverlayNone,
+		Ramp:              RampViridis,
+		Min:               min,
+		Max:               max,
+		Opacity:           0.85,
+		ArrowSpacing:      16,
+		ArrowSpeed:        1,
+		ContourInterval:   0.02,
+		ContourIndexEvery: 5,
+	}
+}
+
+/**
+ * Colours the terrain by a simulation channel, with a legend for the UI.
+ */
+type Overlay struct {
+	OverlaySettings
+	legend      uint32
+	legendRamp  ColourRamp
+	legendBuilt bool
+}
+
+func NewOverlay() *Overlay {
+	return &Overlay{OverlaySettings: DefaultOverlaySettings()}
+}
+
+/**
+ * Switches channel, resetting the range and ramp to the channel's defaults.
+ */
+func (o *Overlay) SetChannel(channel OverlayChannel) {
+	o.Channel = channel
+	o.Min, o.Max = channel.DefaultRange()
+	o.Ramp = channel.DefaultRamp()
+}
+
+/**
+ * The current ramp from low to high as a strip, for drawing a legend with imgui.
+ */
+func (o *Overlay) LegendTexture() uint32 {
+	if o.legendBuilt && o.legendRamp == o.Ramp {
+		return o.legend
+	}
+	pixels := make([]uint8, legendTextureSize*4)
+	for i := 0; i < legendTextureSize; i++ {
+		c := o.Ramp.Colour(float32(i) / (legendTextureSize - 1))
+		pixels[i*4+0] = uint8(c[0]*255 + 0.5)
+		pixels[i*4+1] = uint8(c[1]*255 + 0.5)
+		pixels[i*4+2] = uint8(c[2]*255 + 0.5)
+		pixels[i*4+3] = 255
+	}
+	if o.legend == 0 {
+		gl.GenTextures(1, &o.legend)
+	}
+	gl.BindTexture(gl.TEXTURE_2D, o.legend)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA8, legendTextureSize, 1, 0, gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(pixels))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	o.legendRamp = o.Ramp
+	o.legendBuilt = true
+	return o.legend
+}
+
+/**
+ * Uploads the overlay to a program using the overlay uniforms of main.frag.
+ * The simulation textures are bound by the caller.
+ */
+func (o *Overlay) Bind(program *Program) {
+	stops := rampStops[o.Ramp]
+	var colours [MaxRampStops * 3]float32
+	for i, stop := range stops {
+		copy(colours[i*3:], stop[:])
+	}
+
+	program.SetInt("overlayChannel", int32(o.Channel))
+	program.SetFloat("overlayMin", o.Min)
+	program.SetFloat("overlayMax", o.Max)
+	program.SetFloat("overlayOpacity", o.Opacity)
+	program.SetInt("overlayRampStops", int32(len(stops)))
+	program.SetVectorArray("overlayRamp", 3, colours[:])
+	program.SetBool("overlayArrows", o.Arrows)
+	program.SetFloat("arrowSpacing", o.ArrowSpacing)
+	program.SetFloat("arrowSpeed", o.ArrowSpeed)
+	program.SetBool("contoursEnabled", o.Contours && o.ContourInterval > 0)
+	program.SetFloat("contourInterval", o.ContourInterval)
+	program.SetFloat("contourBase", o.ContourBase)
+	program.SetInt("contourIndexEvery", o.ContourIndexEvery)
+}
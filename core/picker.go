@@ -0,0 +1,153 @@
+package core
+
+import (
+	"github.com/go-gl/gl/v4.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const pickShaderPath = "Pick.comp"
+
+/**
+ * Where a ray from the cursor meets the terrain.
+ */
+type TerrainHit struct {
+	Hit      bool
+	Position mgl32.Vec3
+	// Fractional cell coordinates in the heightfield, cell (x, y) is centred on (x, y).
+	CellX, CellY float32
+	// Simulation state of the nearest cell.
+	Height, Water, Sediment float32
+}
+
+/**
+ * The nearest cell to the hit, as integer coordinates.
+ */
+func (h TerrainHit) Cell() (int, int) {
+	return int(h.CellX + 0.5), int(h.CellY + 0.5)
+}
+
+/**
+ * Casts rays against the heightfield on the GPU, so picking always sees the latest erosion
+ * without reading the whole map back. Results are read back once the GPU has finished with them,
+ * usually a frame later, rather than waiting for them.
+ */
+type Picker struct {
+	program *Program
+	// Alternated between, so a pick can be made while the last one is still being read back.
+	slots     [2]pickSlot
+	next      int
+	requested int
+}
+
+type pickSlot struct {
+	result uint32
+	// Signalled once the pick has been made, zero when there's nothing to read.
+	fence uintptr
+	// Order the pick was requested in, so the latest finished one is used.
+	sequence int
+}
+
+func NewPicker() (*Picker, error) {
+	program, err := NewComputeProgramFromPath(pickShaderPath)
+	if err != nil {
+		return nil, err
+	}
+	var p = &Picker{program: program}
+
+	// Three vec4s each: position, cell and state.
+	for i := range p.slots {
+		gl.GenBuffers(1, &p.slots[i].result)
+		gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, p.slots[i].result)
+		gl.BufferData(gl.SHADER_STORAGE_BUFFER, 12*4, nil, gl.DYNAMIC_READ)
+	}
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, 0)
+	return p, nil
+}
+
+/**
+ * Ray through a point on the screen, given in pixels from the top left of a width x height viewport.
+ */
+func ScreenRay(viewProjection mgl32.Mat4, x, y float32, width, height int) (origin, direction mgl32.Vec3) {
+	inverse := viewProjection.Inv()
+	ndcX := 2*x/float32(width) - 1
+	ndcY := 1 - 2*y/float32(height)
+	near := inverse.Mul4x1(mgl32.Vec4{ndcX, ndcY, -1, 1})
+	far := inverse.Mul4x1(mgl32.Vec4{ndcX, ndcY, 1, 1})
+	nearPoint := near.Vec3().Mul(1 / near[3])
+	farPoint := far.Vec3().Mul(1 / far[3])
+	return nearPoint, farPoint.Sub(nearPoint).Normalize()
+}
+
+/**
+ * Starts intersecting a ray with the terrain, displaced by `heightTexture` (see GPUEroder.HeightSampleTexture)
+ * scaled by heightScale, the same way it is drawn. The hit is returned by a later call to Result.
+ */
+func (p *Picker) Pick(heightTexture uint32, terrain *ChunkedTerrain, heightScale float32, origin, direction mgl32.Vec3) {
+	slot := &p.slots[p.next]
+	if slot.fence != 0 {
+		// Still unread two picks later, a newer one will do.
+		gl.DeleteSync(slot.fence)
+	}
+	p.next = (p.next + 1) % len(p.slots)
+	cellOriginX, cellOriginZ := terrain.CellOrigin()
+
+	p.program.Use()
+	p.program.SetVec3("rayOrigin", origin)
+	p.program.SetVec3("rayDirection", direction)
+	p.program.SetVec2("cellOrigin", mgl32.Vec2{cellOriginX, cellOriginZ})
+	p.program.SetFloat("cellSize", terrain.CellSize())
+	p.program.SetFloat("heightScale", heightScale)
+
+	gl.ActiveTexture(gl.TEXTURE2)
+	gl.BindTexture(gl.TEXTURE_2D, heightTexture)
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 1, slot.result)
+	gl.DispatchCompute(1, 1, 1)
+	gl.MemoryBarrier(gl.BUFFER_UPDATE_BARRIER_BIT)
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 1, 0)
+
+	slot.fence = gl.FenceSync(gl.SYNC_GPU_COMMANDS_COMPLETE, 0)
+	p.requested++
+	slot.sequence = p.requested
+}
+
+/**
+ * The latest hit the GPU has finished since the last call, ok is false if there isn't one yet.
+ * Never waits for the GPU.
+ */
+func (p *Picker) Result() (hit TerrainHit, ok bool) {
+	latest := -1
+	for i := range p.slots {
+		slot := &p.slots[i]
+		if slot.fence == 0 {
+			continue
+		}
+		status := gl.ClientWaitSync(slot.fence, 0, 0)
+		if status != gl.ALREADY_SIGNALED && status != gl.CONDITION_SATISFIED {
+			continue
+		}
+		gl.DeleteSync(slot.fence)
+		slot.fence = 0
+		if latest < 0 || slot.sequence > p.slots[latest].sequence {
+			latest = i
+		}
+	}
+	if latest < 0 {
+		return TerrainHit{}, false
+	}
+
+	var result [12]float32
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, p.slots[latest].result)
+	gl.GetBufferSubData(gl.SHADER_STORAGE_BUFFER, 0, len(result)*4, gl.Ptr(&result[0]))
+	gl.BindBuffer(gl.SHADER_STORAGE_BUFFER, 0)
+
+	return TerrainHit{
+		Hit:      result[3] > 0,
+		Position: mgl32.Vec3{result[0], result[1], result[2]},
+		CellX:    result[4],
+		CellY:    result[5],
+		Height:   result[8],
+		Water:    result[9],
+		Sediment: result[10],
+	}, true
+}
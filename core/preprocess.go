@@ -0,0 +1,141 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ob6160/Terrain/shaders"
+)
+
+/**
+ * Directory shader files are read from in preference to the copies built into the binary,
+ * so they can be edited, and reloaded, without rebuilding. Files it doesn't have come from the built-in copies.
+ * Empty to only use the built-in shaders.
+ */
+var ShaderDir = "shaders"
+
+/**
+ * The source of a shader file, by its path under the shader directory, and when it was last modified.
+ * The time is zero for the built-in copy.
+ */
+func readShaderFile(name string) (string, time.Time, error) {
+	if ShaderDir != "" {
+		path := filepath.Join(ShaderDir, filepath.FromSlash(name))
+		if info, err := os.Stat(path); err == nil {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return "", time.Time{}, err
+			}
+			return string(data), info.ModTime(), nil
+		}
+	}
+	if source, ok := shaders.Source(name); ok {
+		return source, time.Time{}, nil
+	}
+	return "", time.Time{}, fmt.Errorf("no shader %q", name)
+}
+
+/**
+ * When a shader file in the shader directory was last modified, zero if it isn't there.
+ */
+func shaderModTime(name string) time.Time {
+	if ShaderDir == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(filepath.Join(ShaderDir, filepath.FromSlash(name)))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+/**
+ * Expands `#include "path"` lines, with paths relative to the including file. A file is only included
+ * once per shader and later includes of it are dropped, so files can include what they use without guards.
+ */
+type preprocessor struct {
+	// Every file read, in the order of the source string numbers given to them by the #line directives.
+	shaderFiles
+	modified map[string]time.Time
+}
+
+/**
+ * Reads a shader file and everything it includes into a single source.
+ */
+func preprocessShader(name string) (string, *preprocessor, error) {
+	var pp = &preprocessor{shaderFiles: shaderFiles{lines: make(map[string][]string)}, modified: make(map[string]time.Time)}
+	var out bytes.Buffer
+	if err := pp.expand(name, &out); err != nil {
+		return "", nil, err
+	}
+	return out.String(), pp, nil
+}
+
+func (pp *preprocessor) expand(name string, out *bytes.Buffer) error {
+	text, modified, err := readShaderFile(name)
+	if err != nil {
+		return err
+	}
+	index := len(pp.files)
+	pp.files = append(pp.files, name)
+	pp.modified[name] = modified
+
+	lines := strings.Split(text, "\n")
+	pp.lines[name] = lines
+	for i, line := range lines {
+		include, ok, err := parseInclude(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %v", name, i+1, err)
+		}
+		if !ok {
+			out.WriteString(line)
+			if i < len(lines)-1 {
+				out.WriteByte('\n')
+			}
+			continue
+		}
+
+		target := path.Join(path.Dir(name), include)
+		if _, seen := pp.modified[target]; seen {
+			// Blank, so the lines after keep their numbers.
+			out.WriteByte('\n')
+			continue
+		}
+		fmt.Fprintf(out, "#line 1 %d\n", len(pp.files))
+		if err := pp.expand(target, out); err != nil {
+			return fmt.Errorf("%s:%d: %v", name, i+1, err)
+		}
+		if out.Len() > 0 && out.Bytes()[out.Len()-1] != '\n' {
+			out.WriteByte('\n')
+		}
+		// Numbers the line after the include, GLSL 4.3 applies #line to the line that follows it.
+		fmt.Fprintf(out, "#line %d %d\n", i+2, index)
+	}
+	return nil
+}
+
+/**
+ * The path of an `#include "path"` or `#include <path>` line, ok is false for any other line.
+ */
+func parseInclude(line string) (include string, ok bool, err error) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "#") {
+		return "", false, nil
+	}
+	directive := strings.TrimSpace(trimmed[1:])
+	if !strings.HasPrefix(directive, "include") {
+		return "", false, nil
+	}
+	argument := strings.TrimSpace(directive[len("include"):])
+	if len(argument) < 3 || !(argument[0] == '"' && argument[len(argument)-1] == '"' ||
+		argument[0] == '<' && argument[len(argument)-1] == '>') {
+		return "", false, fmt.Errorf("malformed #include, expected a quoted path: %s", trimmed)
+	}
+	return argument[1 : len(argument)-1], true, nil
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ob6160/Terrain/shaders"
+)
+
+/**
+ * Points ShaderDir at a new directory holding `files`, returns a func that puts it back.
+ */
+func shaderDir(t *testing.T, files map[string]string) func() {
+	dir, err := ioutil.TempDir("", "shaders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	previous := ShaderDir
+	ShaderDir = dir
+	return func() {
+		ShaderDir = previous
+		os.RemoveAll(dir)
+	}
+}
+
+/**
+ * Follows the #line directives through the expanded source and checks every other line is the line
+ * of the file they say it is, the mapping the driver's log is read back through.
+ */
+func checkLineMapping(t *testing.T, source string, pp *preprocessor) {
+	file, line := 0, 1
+	for _, text := range strings.Split(source, "\n") {
+		if fields := strings.Fields(text); len(fields) == 3 && fields[0] == "#line" {
+			line, _ = strconv.Atoi(fields[1])
+			file, _ = strconv.Atoi(fields[2])
+			continue
+		}
+		name := pp.files[file]
+		lines := pp.lines[name]
+		if line > len(lines) {
+			t.Errorf("%q maps to %s:%d, past the end of the file", text, name, line)
+		} else if want := lines[line-1]; text != want {
+			if _, included, _ := parseInclude(want); !included || text != "" {
+				t.Errorf("%q maps to %s:%d, which is %q", text, name, line, want)
+			}
+		}
+		line++
+	}
+}
+
+func TestPreprocessShader(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+		// Source string numbers in order.
+		included []string
+	}{
+		{"no includes", map[string]string{
+			"main.frag": "#version 430\nvoid main() {}\n",
+		}, "#version 430\nvoid main() {}\n", []string{"main.frag"}},
+
+		{"nested, relative to the including file", map[string]string{
+			"main.frag":  "#version 430\n#include \"lib/a.glsl\"\nvoid main() {}\n",
+			"lib/a.glsl": "#include \"b.glsl\"\nfloat a;",
+			"lib/b.glsl": "float b;",
+		}, "#version 430\n#line 1 1\n#line 1 2\nfloat b;\n#line 2 1\nfloat a;\n#line 3 0\nvoid main() {}\n",
+			[]string{"main.frag", "lib/a.glsl", "lib/b.glsl"}},
+
+		{"included once", map[string]string{
+			"main.frag":  "#include \"lib/b.glsl\"\n#include \"lib/a.glsl\"\n#include \"lib/b.glsl\"\nmain\n",
+			"lib/a.glsl": "#include \"b.glsl\"\na\n",
+			"lib/b.glsl": "b\n",
+		}, "#line 1 1\nb\n#line 2 0\n#line 1 2\n\na\n#line 3 0\n\nmain\n",
+			[]string{"main.frag", "lib/b.glsl", "lib/a.glsl"}},
+
+		{"angle brackets and spacing", map[string]string{
+			"main.frag":  "  #  include <lib/b.glsl>\nmain",
+			"lib/b.glsl": "b",
+		}, "#line 1 1\nb\n#line 2 0\nmain", []string{"main.frag", "lib/b.glsl"}},
+
+		{"includes from the built-in shaders", map[string]string{
+			"main.frag": "#include \"include/height.glsl\"\nmain",
+		}, "", []string{"main.frag", "include/height.glsl"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer shaderDir(t, test.files)()
+			source, pp, err := preprocessShader("main.frag")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.want != "" && source != test.want {
+				t.Errorf("got\n%q\nwant\n%q", source, test.want)
+			}
+			if strings.Join(pp.files, " ") != strings.Join(test.included, " ") {
+				t.Errorf("got files %v, want %v", pp.files, test.included)
+			}
+			for _, name := range pp.files {
+				_, onDisk := test.files[name]
+				if modified := pp.modified[name]; modified.IsZero() == onDisk {
+					t.Errorf("%s modified at %v, want a time only for files on disk", name, modified)
+				}
+			}
+			checkLineMapping(t, source, pp)
+		})
+	}
+}
+
+func TestPreprocessShaderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"missing", map[string]string{
+			"main.frag": "#include \"nowhere.glsl\"\n",
+		}, `main.frag:1: no shader "nowhere.glsl"`},
+		{"missing include", map[string]string{
+			"main.frag":  "#version 430\n#include \"lib/a.glsl\"\n",
+			"lib/a.glsl": "\n\n#include \"missing.glsl\"\n",
+		}, `main.frag:2: lib/a.glsl:3: no shader "lib/missing.glsl"`},
+		{"unquoted", map[string]string{
+			"main.frag": "#include lib/a.glsl\n",
+		}, "main.frag:1: malformed #include, expected a quoted path: #include lib/a.glsl"},
+		{"unterminated", map[string]string{
+			"main.frag": "#include \"lib/a.glsl\n",
+		}, "main.frag:1: malformed #include"},
+		{"empty path", map[string]string{
+			"main.frag": "#include \"\"\n",
+		}, "main.frag:1: malformed #include"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer shaderDir(t, test.files)()
+			_, _, err := preprocessShader("main.frag")
+			if err == nil {
+				t.Fatalf("preprocessed without an error, want %q", test.want)
+			}
+			if !strings.HasPrefix(err.Error(), test.want) {
+				t.Errorf("got error %q, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestPreprocessBuiltInShaders(t *testing.T) {
+	previous := ShaderDir
+	ShaderDir = ""
+	defer func() { ShaderDir = previous }()
+
+	for _, name := range shaders.Names() {
+		source, pp, err := preprocessShader(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if strings.Contains(source, "#include") {
+			t.Errorf("%s still has an #include after preprocessing", name)
+		}
+		checkLineMapping(t, source, pp)
+	}
+}
@@ -0,0 +1,436 @@
+package core
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-gl/gl/v4.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+/**
+ * An active uniform of a linked program.
+ */
+type Uniform struct {
+	Name     string
+	Location int32
+	// GL type, eg gl.FLOAT_VEC3, and the length for arrays (1 otherwise).
+	Type uint32
+	Size int32
+	// Texture unit of a sampler, or image unit of an image, as set by its layout binding or SetInt.
+	Binding int32
+}
+
+func (u *Uniform) Opaque() bool {
+	return isSampler(u.Type) || isImage(u.Type)
+}
+
+/**
+ * A linked shader program. Its active uniforms are looked up once after linking, and the setters
+ * complain (once per name) about uniforms the program doesn't have or that don't match the setter's type,
+ * rather than silently writing to location -1.
+ *
+ * Uniforms are set with glProgramUniform, so the program doesn't need to be in use.
+ * The last value set for each is kept, so a program reloaded from its files picks up where it left off.
+ */
+type Program struct {
+	// Where the program came from, the shader paths when loaded from files.
+	Name     string
+	handle   uint32
+	uniforms map[string]*Uniform
+	values   map[string]*uniformValue // name -> the uniform's last value
+	warnings []string
+	warned   map[string]bool
+	sources  []shaderSource
+	modified map[string]time.Time // path -> modification time when last built
+	err      error                // Why the last reload failed, nil if it didn't
+}
+
+/**
+ * Wraps a successfully linked program and reflects its uniforms.
+ */
+func newProgram(name string, handle uint32) *Program {
+	var p = &Program{Name: name, handle: handle, values: make(map[string]*uniformValue)}
+	p.reflect()
+	return p
+}
+
+/**
+ * Looks up the active uniforms of the program's current handle.
+ */
+func (p *Program) reflect() {
+	handle := p.handle
+	p.uniforms = make(map[string]*Uniform)
+	p.warnings = nil
+	p.warned = make(map[string]bool)
+
+	var count, maxLength int32
+	gl.GetProgramiv(handle, gl.ACTIVE_UNIFORMS, &count)
+	gl.GetProgramiv(handle, gl.ACTIVE_UNIFORM_MAX_LENGTH, &maxLength)
+	buffer := make([]uint8, maxLength+1)
+	for i := int32(0); i < count; i++ {
+		var length, size int32
+		var kind uint32
+		gl.GetActiveUniform(handle, uint32(i), maxLength+1, &length, &size, &kind, &buffer[0])
+		location := gl.GetUniformLocation(handle, &buffer[0])
+		if location < 0 {
+			// Members of uniform blocks and storage buffers have no location of their own.
+			continue
+		}
+		// Arrays are reported as their first element.
+		name := strings.TrimSuffix(string(buffer[:length]), "[0]")
+		var u = &Uniform{Name: name, Location: location, Type: kind, Size: size}
+		if u.Opaque() {
+			gl.GetUniformiv(handle, location, &u.Binding)
+		}
+		p.uniforms[name] = u
+	}
+}
+
+func (p *Program) Handle() uint32 {
+	return p.handle
+}
+
+func (p *Program) Use() {
+	gl.UseProgram(p.handle)
+}
+
+func (p *Program) Delete() {
+	unwatch(p)
+	gl.DeleteProgram(p.handle)
+}
+
+/**
+ * The shader files the program was built from, includes too, sorted. None if it was built from source strings.
+ */
+func (p *Program) Files() []string {
+	files := make([]string, 0, len(p.modified))
+	for name := range p.modified {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+	return files
+}
+
+/**
+ * Why the last reload failed, the program carries on with the shaders it had. nil after a successful reload.
+ */
+func (p *Program) Error() error {
+	return p.err
+}
+
+/**
+ * Rebuilds the program from its files. The new program replaces the old only if it compiles and links,
+ * and is given the uniform values the old one had.
+ */
+func (p *Program) Reload() error {
+	if len(p.sources) == 0 {
+		return fmt.Errorf("%s: not loaded from files", p.Name)
+	}
+	handle, modified, err := buildProgram(p.sources)
+	if modified != nil {
+		p.modified = modified
+	}
+	if err != nil {
+		p.err = fmt.Errorf("%s: %w", p.Name, err)
+		return p.err
+	}
+	gl.DeleteProgram(p.handle)
+	p.handle = handle
+	p.err = nil
+	p.reflect()
+
+	for name, value := range p.values {
+		// Uniforms the new shaders no longer use keep quiet until they're set again.
+		if p.Has(name) {
+			p.replay(name, value)
+		}
+	}
+	return nil
+}
+
+/**
+ * Whether any of the program's files in the shader directory changed since it was last built.
+ * Files missing from it, eg in the middle of being saved, are left until the next check.
+ */
+func (p *Program) changed() bool {
+	for name, modified := range p.modified {
+		if current := shaderModTime(name); !current.IsZero() && !current.Equal(modified) {
+			return true
+		}
+	}
+	return false
+}
+
+/**
+ * Whether the program has an active uniform of this name. Uniforms the compiler found unused aren't active.
+ */
+func (p *Program) Has(name string) bool {
+	_, ok := p.uniforms[name]
+	return ok
+}
+
+/**
+ * The active uniform of this name, or nil.
+ */
+func (p *Program) Uniform(name string) *Uniform {
+	return p.uniforms[name]
+}
+
+/**
+ * The active uniforms, sorted by name.
+ */
+func (p *Program) Uniforms() []*Uniform {
+	uniforms := make([]*Uniform, 0, len(p.uniforms))
+	for _, u := range p.uniforms {
+		uniforms = append(uniforms, u)
+	}
+	sort.Slice(uniforms, func(i, j int) bool { return uniforms[i].Name < uniforms[j].Name })
+	return uniforms
+}
+
+/**
+ * Texture or image unit a sampler or image uniform is bound to.
+ */
+func (p *Program) Binding(name string) (int32, bool) {
+	u, ok := p.uniforms[name]
+	if !ok || !u.Opaque() {
+		return 0, false
+	}
+	return u.Binding, true
+}
+
+/**
+ * Problems found setting uniforms so far, each reported once.
+ */
+func (p *Program) Warnings() []string {
+	return p.warnings
+}
+
+func (p *Program) warn(key, format string, args ...interface{}) {
+	if p.warned[key] {
+		return
+	}
+	p.warned[key] = true
+	message := fmt.Sprintf("%s: %s", p.Name, fmt.Sprintf(format, args...))
+	p.warnings = append(p.warnings, message)
+	log.Println(message)
+}
+
+/**
+ * Location of a uniform for a setter accepting `types`, or -1 after reporting why it can't be set.
+ */
+func (p *Program) location(name string, types ...uint32) int32 {
+	u, ok := p.uniforms[name]
+	if !ok {
+		p.warn(name, "no active uniform %q (misspelt, or unused and optimised out)", name)
+		return -1
+	}
+	for _, t := range types {
+		if u.Type == t {
+			return u.Location
+		}
+	}
+	if len(types) == 1 && types[0] == gl.INT && u.Opaque() {
+		return u.Location
+	}
+	p.warn(name, "uniform %q is %s, not %s", name, typeName(u.Type), typeName(types[0]))
+	return -1
+}
+
+type uniformSetter int
+
+const (
+	setInt uniformSetter = iota
+	setBool
+	setIVec2
+	setFloat
+	setVec2
+	setVec3
+	setVec4
+	setMat4
+	setVectorArray
+)
+
+/**
+ * The last value set for a uniform and the setter it was set with. Kept per name and overwritten,
+ * so setting uniforms every frame doesn't allocate.
+ */
+type uniformValue struct {
+	setter uniformSetter
+	ints   [2]int32
+	floats [16]float32
+	// Components and vector size of SetVectorArray.
+	array []float32
+	size  int
+}
+
+/**
+ * The value kept for a uniform, to be overwritten by a setter.
+ */
+func (p *Program) value(name string, setter uniformSetter) *uniformValue {
+	v, ok := p.values[name]
+	if !ok {
+		v = new(uniformValue)
+		p.values[name] = v
+	}
+	v.setter = setter
+	return v
+}
+
+/**
+ * Sets a uniform to its kept value again.
+ */
+func (p *Program) replay(name string, v *uniformValue) {
+	switch v.setter {
+	case setInt:
+		p.SetInt(name, v.ints[0])
+	case setBool:
+		p.SetBool(name, v.ints[0] != 0)
+	case setIVec2:
+		p.SetIVec2(name, v.ints[0], v.ints[1])
+	case setFloat:
+		p.SetFloat(name, v.floats[0])
+	case setVec2:
+		p.SetVec2(name, mgl32.Vec2{v.floats[0], v.floats[1]})
+	case setVec3:
+		p.SetVec3(name, mgl32.Vec3{v.floats[0], v.floats[1], v.floats[2]})
+	case setVec4:
+		p.SetVec4(name, mgl32.Vec4{v.floats[0], v.floats[1], v.floats[2], v.floats[3]})
+	case setMat4:
+		p.SetMat4(name, mgl32.Mat4(v.floats))
+	case setVectorArray:
+		p.SetVectorArray(name, v.size, v.array)
+	}
+}
+
+/**
+ * Sets an int, or the unit of a sampler or image.
+ */
+func (p *Program) SetInt(name string, value int32) {
+	p.value(name, setInt).ints[0] = value
+	if location := p.location(name, gl.INT); location >= 0 {
+		gl.ProgramUniform1i(p.handle, location, value)
+		if u := p.uniforms[name]; u.Opaque() {
+			u.Binding = value
+		}
+	}
+}
+
+/**
+ * Sets an int uniform used as a flag to 0 or 1.
+ */
+func (p *Program) SetBool(name string, value bool) {
+	var i int32
+	if value {
+		i = 1
+	}
+	p.value(name, setBool).ints[0] = i
+	if location := p.location(name, gl.INT, gl.BOOL); location >= 0 {
+		gl.ProgramUniform1i(p.handle, location, i)
+	}
+}
+
+func (p *Program) SetIVec2(name string, x, y int32) {
+	p.value(name, setIVec2).ints = [2]int32{x, y}
+	if location := p.location(name, gl.INT_VEC2); location >= 0 {
+		gl.ProgramUniform2i(p.handle, location, x, y)
+	}
+}
+
+func (p *Program) SetFloat(name string, value float32) {
+	p.value(name, setFloat).floats[0] = value
+	if location := p.location(name, gl.FLOAT); location >= 0 {
+		gl.ProgramUniform1f(p.handle, location, value)
+	}
+}
+
+func (p *Program) SetVec2(name string, value mgl32.Vec2) {
+	copy(p.value(name, setVec2).floats[:], value[:])
+	if location := p.location(name, gl.FLOAT_VEC2); location >= 0 {
+		gl.ProgramUniform2fv(p.handle, location, 1, &value[0])
+	}
+}
+
+func (p *Program) SetVec3(name string, value mgl32.Vec3) {
+	copy(p.value(name, setVec3).floats[:], value[:])
+	if location := p.location(name, gl.FLOAT_VEC3); location >= 0 {
+		gl.ProgramUniform3fv(p.handle, location, 1, &value[0])
+	}
+}
+
+func (p *Program) SetVec4(name string, value mgl32.Vec4) {
+	copy(p.value(name, setVec4).floats[:], value[:])
+	if location := p.location(name, gl.FLOAT_VEC4); location >= 0 {
+		gl.ProgramUniform4fv(p.handle, location, 1, &value[0])
+	}
+}
+
+func (p *Program) SetMat4(name string, value mgl32.Mat4) {
+	p.value(name, setMat4).floats = value
+	if location := p.location(name, gl.FLOAT_MAT4); location >= 0 {
+		gl.ProgramUniformMatrix4fv(p.handle, location, 1, false, &value[0])
+	}
+}
+
+/**
+ * Sets a vec2, vec3 or vec4 array from packed components, len(values) must be a multiple of the vector size.
+ */
+func (p *Program) SetVectorArray(name string, size int, values []float32) {
+	if len(values) == 0 {
+		return
+	}
+	kept := p.value(name, setVectorArray)
+	kept.array, kept.size = append(kept.array[:0], values...), size
+	types := [...]uint32{2: gl.FLOAT_VEC2, 3: gl.FLOAT_VEC3, 4: gl.FLOAT_VEC4}
+	location := p.location(name, types[size])
+	if location < 0 {
+		return
+	}
+	count := int32(len(values) / size)
+	if limit := p.uniforms[name].Size; count > limit {
+		count = limit
+	}
+	switch size {
+	case 2:
+		gl.ProgramUniform2fv(p.handle, location, count, &values[0])
+	case 3:
+		gl.ProgramUniform3fv(p.handle, location, count, &values[0])
+	case 4:
+		gl.ProgramUniform4fv(p.handle, location, count, &values[0])
+	}
+}
+
+func isSampler(kind uint32) bool {
+	switch kind {
+	case gl.SAMPLER_1D, gl.SAMPLER_2D, gl.SAMPLER_3D, gl.SAMPLER_CUBE, gl.SAMPLER_2D_SHADOW, gl.SAMPLER_2D_ARRAY,
+		gl.SAMPLER_2D_ARRAY_SHADOW, gl.SAMPLER_BUFFER, gl.INT_SAMPLER_2D, gl.UNSIGNED_INT_SAMPLER_2D:
+		return true
+	}
+	return false
+}
+
+func isImage(kind uint32) bool {
+	switch kind {
+	case gl.IMAGE_1D, gl.IMAGE_2D, gl.IMAGE_3D, gl.IMAGE_2D_ARRAY, gl.IMAGE_BUFFER, gl.INT_IMAGE_2D, gl.UNSIGNED_INT_IMAGE_2D:
+		return true
+	}
+	return false
+}
+
+var typeNames = map[uint32]string{
+	gl.INT: "int", gl.BOOL: "bool", gl.INT_VEC2: "ivec2", gl.FLOAT: "float",
+	gl.FLOAT_VEC2: "vec2", gl.FLOAT_VEC3: "vec3", gl.FLOAT_VEC4: "vec4", gl.FLOAT_MAT4: "mat4",
+	gl.SAMPLER_2D: "sampler2D", gl.SAMPLER_2D_SHADOW: "sampler2DShadow", gl.SAMPLER_2D_ARRAY: "sampler2DArray",
+	gl.IMAGE_2D: "image2D",
+}
+
+func typeName(kind uint32) string {
+	if name, ok := typeNames[kind]; ok {
+		return name
+	}
+	return fmt.Sprintf("type 0x%x", kind)
+}
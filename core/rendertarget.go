@@ -0,0 +1,88 @@
+package core
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/go-gl/gl/v4.3-core/gl"
+)
+
+/**
+ * An offscreen framebuffer with colour and depth, for rendering the view at a size other than the window's.
+ */
+type RenderTarget struct {
+	Width, Height int
+	framebuffer   uint32
+	colour, depth uint32
+	viewport      [4]int32 // Restored by Unbind
+}
+
+func NewRenderTarget(width, height int) (*RenderTarget, error) {
+	var r = &RenderTarget{Width: width, Height: height}
+	gl.GenRenderbuffers(1, &r.colour)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, r.colour)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.RGBA8, int32(width), int32(height))
+	gl.GenRenderbuffers(1, &r.depth)
+	gl.BindRenderbuffer(gl.RENDERBUFFER, r.depth)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.DEPTH_COMPONENT32F, int32(width), int32(height))
+	gl.BindRenderbuffer(gl.RENDERBUFFER, 0)
+
+	gl.GenFramebuffers(1, &r.framebuffer)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, r.framebuffer)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.RENDERBUFFER, r.colour)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.RENDERBUFFER, r.depth)
+	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	if status != gl.FRAMEBUFFER_COMPLETE {
+		r.Delete()
+		return nil, fmt.Errorf("offscreen framebuffer of %dx%d is incomplete (status 0x%x)", width, height, status)
+	}
+	return r, nil
+}
+
+/**
+ * Directs drawing into the target, covering all of it. Unbind goes back to the window.
+ */
+func (r *RenderTarget) Bind() {
+	gl.GetIntegerv(gl.VIEWPORT, &r.viewport[0])
+	gl.BindFramebuffer(gl.FRAMEBUFFER, r.framebuffer)
+	gl.Viewport(0, 0, int32(r.Width), int32(r.Height))
+}
+
+func (r *RenderTarget) Unbind() {
+	gl.BindFramebuffer(gl.FRAMEBUFFER, 0)
+	gl.Viewport(r.viewport[0], r.viewport[1], r.viewport[2], r.viewport[3])
+}
+
+/**
+ * Reads back what's been drawn, the right way up.
+ */
+func (r *RenderTarget) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, r.Width, r.Height))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, r.framebuffer)
+	gl.ReadBuffer(gl.COLOR_ATTACHMENT0)
+	gl.PixelStorei(gl.PACK_ALIGNMENT, 1)
+	gl.ReadPixels(0, 0, int32(r.Width), int32(r.Height), gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(img.Pix))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+
+	// GL's rows start at the bottom.
+	row := make([]uint8, img.Stride)
+	for y := 0; y < r.Height/2; y++ {
+		top := img.Pix[y*img.Stride : (y+1)*img.Stride]
+		bottom := img.Pix[(r.Height-1-y)*img.Stride : (r.Height-y)*img.Stride]
+		copy(row, top)
+		copy(top, bottom)
+		copy(bottom, row)
+	}
+	// Blending leaves the water's alpha in the framebuffer, the picture itself is opaque.
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	return img
+}
+
+func (r *RenderTarget) Delete() {
+	gl.DeleteFramebuffers(1, &r.framebuffer)
+	gl.DeleteRenderbuffers(1, &r.colour)
+	gl.DeleteRenderbuffers(1, &r.depth)
+}
@@ -0,0 +1,38 @@
+package core
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+/**
+ * Look of the scene, saved to and loaded from JSON.
+ */
+type Scene struct {
+	Materials []Material
+	Camera    CameraPose
+	Bookmarks []CameraBookmark
+	// Missing from older scenes, the current settings are kept then.
+	Water    *WaterSettings    `json:",omitempty"`
+	Lighting *LightingSettings `json:",omitempty"`
+}
+
+func SaveScene(path string, scene *Scene) error {
+	data, err := json.MarshalIndent(scene, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func LoadScene(path string) (*Scene, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var scene Scene
+	if err := json.Unmarshal(data, &scene); err != nil {
+		return nil, err
+	}
+	return &scene, nil
+}
@@ -1,65 +1,131 @@
 package core
-// Include ref to source
+
 import (
 	"fmt"
-	"github.com/go-gl/gl/v4.3-core/gl"
-	"github.com/ob6160/Terrain/utils"
 	"strings"
+	"time"
+
+	"github.com/go-gl/gl/v4.3-core/gl"
 )
 
-func NewProgramFromPath(vertexShaderPath, fragmentShaderPath string) (uint32, error) {
-	vertexShader, _ := utils.ReadTextFile(vertexShaderPath)
-	fragmentShader, _ := utils.ReadTextFile(fragmentShaderPath)
-	return NewProgram(vertexShader+"\x00", fragmentShader+"\x00")
+/**
+ * One stage of a program loaded from a file, named by its path under the shader directory (see ShaderDir).
+ */
+type shaderSource struct {
+	name string
+	kind uint32
 }
 
-func NewComputeProgramFromPath(computeShaderPath string) (uint32, error) {
-	computeShader, _ := utils.ReadTextFile(computeShaderPath)
-	return NewComputeProgram(computeShader + "\x00")
+/**
+ * Builds a program from shader files, eg "main.vert", read from ShaderDir or the copies built into the binary.
+ */
+func NewProgramFromPath(vertexShaderPath, fragmentShaderPath string) (*Program, error) {
+	return newProgramFromFiles(vertexShaderPath+" + "+fragmentShaderPath, []shaderSource{
+		{vertexShaderPath, gl.VERTEX_SHADER},
+		{fragmentShaderPath, gl.FRAGMENT_SHADER},
+	})
 }
 
-func NewComputeProgram(computeShaderSource string) (uint32, error) {
-	computeShader, err := compileShader(computeShaderSource, gl.COMPUTE_SHADER)
+func NewComputeProgramFromPath(computeShaderPath string) (*Program, error) {
+	return newProgramFromFiles(computeShaderPath, []shaderSource{{computeShaderPath, gl.COMPUTE_SHADER}})
+}
 
+/**
+ * Builds a program from shader files and watches them for changes, see ReloadChangedShaders.
+ */
+func newProgramFromFiles(name string, sources []shaderSource) (*Program, error) {
+	handle, modified, err := buildProgram(sources)
 	if err != nil {
-		return 0, err
+		return nil, fmt.Errorf("%s: %w", name, err)
 	}
+	p := newProgram(name, handle)
+	p.sources = sources
+	p.modified = modified
+	watch(p)
+	return p, nil
+}
 
-	program := gl.CreateProgram()
-	gl.AttachShader(program, computeShader)
-	gl.LinkProgram(program)
-
-	var status int32
-	gl.GetProgramiv(program, gl.LINK_STATUS, &status)
-	if status == gl.FALSE {
-		var logLength int32
-		gl.GetProgramiv(program, gl.INFO_LOG_LENGTH, &logLength)
+/**
+ * A stage ready to compile, with where its lines came from for error messages.
+ */
+type shaderStage struct {
+	kind   uint32
+	name   string
+	source string
+	files  *shaderFiles
+}
 
-		log := strings.Repeat("\x00", int(logLength+1))
-		gl.GetProgramInfoLog(program, logLength, nil, gl.Str(log))
+/**
+ * A stage compiled from a string rather than a file, named for error messages.
+ */
+func stringStage(kind uint32, name, source string) shaderStage {
+	lines := strings.Split(strings.TrimRight(source, "\x00"), "\n")
+	return shaderStage{kind, name, source, &shaderFiles{files: []string{name}, lines: map[string][]string{name: lines}}}
+}
 
-		return 0, fmt.Errorf("failed to link program: %v", log)
+/**
+ * Reads, preprocesses, compiles and links the shader files, returning the program and
+ * when each file it used, includes too, was last modified.
+ */
+func buildProgram(sources []shaderSource) (uint32, map[string]time.Time, error) {
+	var modified = make(map[string]time.Time, len(sources))
+	var stages = make([]shaderStage, len(sources))
+	for i, source := range sources {
+		text, pp, err := preprocessShader(source.name)
+		if err != nil {
+			return 0, nil, err
+		}
+		for name, modTime := range pp.modified {
+			modified[name] = modTime
+		}
+		stages[i] = shaderStage{source.kind, source.name, text + "\x00", &pp.shaderFiles}
 	}
-
-	gl.DeleteShader(computeShader)
-	return program, nil
+	handle, err := linkProgram(stages)
+	return handle, modified, err
 }
 
-func NewProgram(vertexShaderSource, fragmentShaderSource string) (uint32, error) {
-	vertexShader, err := compileShader(vertexShaderSource, gl.VERTEX_SHADER)
+func NewComputeProgram(computeShaderSource string) (*Program, error) {
+	program, err := linkProgram([]shaderStage{stringStage(gl.COMPUTE_SHADER, "compute shader", computeShaderSource)})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	return newProgram("compute program", program), nil
+}
 
-	fragmentShader, err := compileShader(fragmentShaderSource, gl.FRAGMENT_SHADER)
+func NewProgram(vertexShaderSource, fragmentShaderSource string) (*Program, error) {
+	program, err := linkProgram([]shaderStage{
+		stringStage(gl.VERTEX_SHADER, "vertex shader", vertexShaderSource),
+		stringStage(gl.FRAGMENT_SHADER, "fragment shader", fragmentShaderSource),
+	})
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	return newProgram("program", program), nil
+}
+
+/**
+ * Compiles each stage and links them. Nothing is left behind when it fails.
+ * Failures are *ShaderError.
+ */
+func linkProgram(stages []shaderStage) (uint32, error) {
+	var shaders []uint32
+	defer func() {
+		for _, shader := range shaders {
+			gl.DeleteShader(shader)
+		}
+	}()
+	for _, stage := range stages {
+		shader, err := compileShader(stage)
+		if err != nil {
+			return 0, err
+		}
+		shaders = append(shaders, shader)
 	}
 
 	program := gl.CreateProgram()
-
-	gl.AttachShader(program, vertexShader)
-	gl.AttachShader(program, fragmentShader)
+	for _, shader := range shaders {
+		gl.AttachShader(program, shader)
+	}
 	gl.LinkProgram(program)
 
 	var status int32
@@ -70,20 +136,21 @@ func NewProgram(vertexShaderSource, fragmentShaderSource string) (uint32, error)
 
 		log := strings.Repeat("\x00", int(logLength+1))
 		gl.GetProgramInfoLog(program, logLength, nil, gl.Str(log))
+		gl.DeleteProgram(program)
 
-		return 0, fmt.Errorf("failed to link program: %v", log)
+		log = strings.TrimRight(log, "\x00")
+		return 0, &ShaderError{Stage: "link", Messages: parseShaderLog(log, nil), Log: log}
+	}
+	for _, shader := range shaders {
+		gl.DetachShader(program, shader)
 	}
-
-	gl.DeleteShader(vertexShader)
-	gl.DeleteShader(fragmentShader)
-
 	return program, nil
 }
 
-func compileShader(source string, shaderType uint32) (uint32, error) {
-	shader := gl.CreateShader(shaderType)
+func compileShader(stage shaderStage) (uint32, error) {
+	shader := gl.CreateShader(stage.kind)
 
-	csources, free := gl.Strs(source)
+	csources, free := gl.Strs(stage.source)
 	gl.ShaderSource(shader, 1, csources, nil)
 	free()
 	gl.CompileShader(shader)
@@ -96,8 +163,10 @@ func compileShader(source string, shaderType uint32) (uint32, error) {
 
 		log := strings.Repeat("\x00", int(logLength+1))
 		gl.GetShaderInfoLog(shader, logLength, nil, gl.Str(log))
+		gl.DeleteShader(shader)
 
-		return 0, fmt.Errorf("failed to compile %v: %v", source, log)
+		log = strings.TrimRight(log, "\x00")
+		return 0, &ShaderError{Stage: stage.name, Messages: parseShaderLog(log, stage.files), Log: log}
 	}
 
 	return shader, nil
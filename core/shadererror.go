@@ -0,0 +1,163 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Source lines shown either side of the line a message is about.
+const shaderErrorContext = 2
+
+/**
+ * One message from the driver's compile or link log, with its location mapped back to the shader file,
+ * includes too. File is empty when the driver didn't say where.
+ */
+type ShaderMessage struct {
+	File     string
+	Line     int
+	Column   int // 0 when not given
+	Severity string
+	Text     string
+	// Source lines around Line, formatted with their numbers, the line itself marked with '>'.
+	Context []string
+}
+
+func (m ShaderMessage) Location() string {
+	switch {
+	case m.File == "":
+		return ""
+	case m.Column > 0:
+		return fmt.Sprintf("%s:%d:%d", m.File, m.Line, m.Column)
+	case m.Line > 0:
+		return fmt.Sprintf("%s:%d", m.File, m.Line)
+	}
+	return m.File
+}
+
+func (m ShaderMessage) String() string {
+	if location := m.Location(); location != "" {
+		return fmt.Sprintf("%s: %s: %s", location, m.Severity, m.Text)
+	}
+	return fmt.Sprintf("%s: %s", m.Severity, m.Text)
+}
+
+/**
+ * A shader that failed to compile, or a program that failed to link.
+ */
+type ShaderError struct {
+	// The file or stage that failed, or "link".
+	Stage    string
+	Messages []ShaderMessage
+	// The driver's log as it was given.
+	Log string
+}
+
+func (e *ShaderError) Error() string {
+	var b strings.Builder
+	if e.Stage == "link" {
+		b.WriteString("failed to link")
+	} else {
+		fmt.Fprintf(&b, "%s failed to compile", e.Stage)
+	}
+	if len(e.Messages) == 0 {
+		fmt.Fprintf(&b, ": %s", strings.TrimSpace(e.Log))
+		return b.String()
+	}
+	for _, m := range e.Messages {
+		b.WriteString("\n")
+		b.WriteString(m.String())
+		for _, line := range m.Context {
+			b.WriteString("\n")
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
+
+/**
+ * Where the lines of a compiled source came from: files[n] is source string number n in the log,
+ * as set by the preprocessor's #line directives, and lines holds each file's text.
+ */
+type shaderFiles struct {
+	files []string
+	lines map[string][]string
+}
+
+// Locations as the common drivers write them, with the source string number, line and maybe column:
+// Mesa "0:12(5): error: ...", NVIDIA "0(12) : error C0000: ..." and AMD / Intel "ERROR: 0:12: ...".
+var shaderLogPatterns = []struct {
+	pattern                              *regexp.Regexp
+	source, line, column, severity, text int
+}{
+	{regexp.MustCompile(`^(\d+):(\d+)\((\d+)\):\s*(?:\w+\s+)?(error|warning)\s*:\s*(.*)$`), 1, 2, 3, 4, 5},
+	{regexp.MustCompile(`^(\d+)\((\d+)\)\s*:\s*(error|warning)\s*(?:\w+\s*)?:\s*(.*)$`), 1, 2, 0, 3, 4},
+	{regexp.MustCompile(`^(ERROR|WARNING):\s*(\d+):(\d+):\s*(.*)$`), 2, 3, 0, 1, 4},
+}
+
+/**
+ * Splits a driver log into messages. Lines it doesn't recognise are kept as they are, without a location.
+ */
+func parseShaderLog(log string, files *shaderFiles) []ShaderMessage {
+	var messages []ShaderMessage
+	for _, line := range strings.Split(log, "\n") {
+		line = strings.TrimSpace(strings.TrimRight(line, "\x00"))
+		if line == "" {
+			continue
+		}
+		messages = append(messages, parseShaderLogLine(line, files))
+	}
+	return messages
+}
+
+func parseShaderLogLine(line string, files *shaderFiles) ShaderMessage {
+	for _, p := range shaderLogPatterns {
+		match := p.pattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		source, _ := strconv.Atoi(match[p.source])
+		var m = ShaderMessage{Severity: strings.ToLower(match[p.severity]), Text: match[p.text]}
+		m.Line, _ = strconv.Atoi(match[p.line])
+		if p.column > 0 {
+			m.Column, _ = strconv.Atoi(match[p.column])
+		}
+		if files != nil && source < len(files.files) {
+			m.File = files.files[source]
+			m.Context = sourceContext(files.lines[m.File], m.Line)
+		}
+		return m
+	}
+	var m = ShaderMessage{Severity: "error", Text: line}
+	if lower := strings.ToLower(line); strings.HasPrefix(lower, "warning") {
+		m.Severity = "warning"
+	}
+	return m
+}
+
+/**
+ * The lines around `line` (1 based), numbered, with the line itself marked.
+ */
+func sourceContext(lines []string, line int) []string {
+	if line < 1 || line > len(lines) {
+		return nil
+	}
+	first, last := line-shaderErrorContext, line+shaderErrorContext
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+	width := len(strconv.Itoa(last))
+	var context []string
+	for n := first; n <= last; n++ {
+		marker := " "
+		if n == line {
+			marker = ">"
+		}
+		context = append(context, fmt.Sprintf("%s %*d | %s", marker, width, n, strings.TrimRight(lines[n-1], "\r")))
+	}
+	return context
+}
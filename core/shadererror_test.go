@@ -0,0 +1,166 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func numberedLines(count int) []string {
+	lines := make([]string, count)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d", i+1)
+	}
+	return lines
+}
+
+func testShaderFiles() *shaderFiles {
+	return &shaderFiles{
+		files: []string{"main.frag", "include/height.glsl"},
+		lines: map[string][]string{
+			"main.frag":           numberedLines(20),
+			"include/height.glsl": numberedLines(5),
+		},
+	}
+}
+
+func TestParseShaderLogLine(t *testing.T) {
+	tests := []struct {
+		name, line string
+		files      *shaderFiles
+		want       ShaderMessage
+		// Lines of source shown around the message.
+		context int
+	}{
+		{"mesa", "0:12(5): error: `x' undeclared", testShaderFiles(),
+			ShaderMessage{File: "main.frag", Line: 12, Column: 5, Severity: "error", Text: "`x' undeclared"}, 5},
+		{"mesa include", "1:3(10): warning: unused variable", testShaderFiles(),
+			ShaderMessage{File: "include/height.glsl", Line: 3, Column: 10, Severity: "warning", Text: "unused variable"}, 5},
+		{"mesa preprocessor", "0:1(1): preprocessor error: syntax error", testShaderFiles(),
+			ShaderMessage{File: "main.frag", Line: 1, Column: 1, Severity: "error", Text: "syntax error"}, 3},
+		{"nvidia", `0(12) : error C0000: syntax error, unexpected ";"`, testShaderFiles(),
+			ShaderMessage{File: "main.frag", Line: 12, Severity: "error", Text: `syntax error, unexpected ";"`}, 5},
+		{"nvidia include", `1(5) : warning C7050: "h" might be used before being initialized`, testShaderFiles(),
+			ShaderMessage{File: "include/height.glsl", Line: 5, Severity: "warning", Text: `"h" might be used before being initialized`}, 3},
+		{"amd", "ERROR: 0:20: 'foo' : undeclared identifier", testShaderFiles(),
+			ShaderMessage{File: "main.frag", Line: 20, Severity: "error", Text: "'foo' : undeclared identifier"}, 3},
+		{"amd include", "WARNING: 1:2: extension not supported", testShaderFiles(),
+			ShaderMessage{File: "include/height.glsl", Line: 2, Severity: "warning", Text: "extension not supported"}, 4},
+		// The location is still read when the file can't be found.
+		{"unknown source string", "7:4(2): error: bad", testShaderFiles(),
+			ShaderMessage{Line: 4, Column: 2, Severity: "error", Text: "bad"}, 0},
+		{"no files", "0(4) : error C1008: undefined variable", nil,
+			ShaderMessage{Line: 4, Severity: "error", Text: "undefined variable"}, 0},
+		{"line past the end", "1:9(1): error: bad", testShaderFiles(),
+			ShaderMessage{File: "include/height.glsl", Line: 9, Column: 1, Severity: "error", Text: "bad"}, 0},
+		{"unrecognised", "Vertex info: linking failed", testShaderFiles(),
+			ShaderMessage{Severity: "error", Text: "Vertex info: linking failed"}, 0},
+		{"unrecognised warning", "Warning: varying unused", testShaderFiles(),
+			ShaderMessage{Severity: "warning", Text: "Warning: varying unused"}, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseShaderLogLine(test.line, test.files)
+			if len(got.Context) != test.context {
+				t.Errorf("got %d lines of context, want %d", len(got.Context), test.context)
+			}
+			got.Context = nil
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseShaderLog(t *testing.T) {
+	log := "0:12(5): error: first\n\n  0:13(1): warning: second  \r\nLinking failed\x00\x00"
+	messages := parseShaderLog(log, testShaderFiles())
+	want := []string{
+		"main.frag:12:5: error: first",
+		"main.frag:13:1: warning: second",
+		"error: Linking failed",
+	}
+	if len(messages) != len(want) {
+		t.Fatalf("got %d messages %v, want %d", len(messages), messages, len(want))
+	}
+	for i, m := range messages {
+		if m.String() != want[i] {
+			t.Errorf("message %d is %q, want %q", i, m, want[i])
+		}
+	}
+}
+
+func TestSourceContext(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		line  int
+		want  []string
+	}{
+		{"middle", numberedLines(5), 3, []string{
+			"  1 | line 1", "  2 | line 2", "> 3 | line 3", "  4 | line 4", "  5 | line 5",
+		}},
+		{"first line", numberedLines(5), 1, []string{"> 1 | line 1", "  2 | line 2", "  3 | line 3"}},
+		{"last line, numbers aligned", numberedLines(10), 10, []string{
+			"   8 | line 8", "   9 | line 9", "> 10 | line 10",
+		}},
+		{"carriage returns dropped", []string{"a\r", "b\r"}, 2, []string{"  1 | a", "> 2 | b"}},
+		{"before the start", numberedLines(5), 0, nil},
+		{"past the end", numberedLines(5), 6, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := sourceContext(test.lines, test.line)
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestShaderErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  ShaderError
+		want string
+	}{
+		{"compile", ShaderError{Stage: "main.frag", Messages: []ShaderMessage{
+			{File: "main.frag", Line: 2, Severity: "error", Text: "bad", Context: []string{"> 2 | x"}},
+			{Severity: "warning", Text: "odd"},
+		}}, "main.frag failed to compile\nmain.frag:2: error: bad\n> 2 | x\nwarning: odd"},
+		{"link without messages", ShaderError{Stage: "link", Log: "  out of registers\n"}, "failed to link: out of registers"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.err.Error(); got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestShaderLogThroughIncludes(t *testing.T) {
+	defer shaderDir(t, map[string]string{
+		"main.frag":  "#version 430\n#include \"lib/a.glsl\"\nvoid main() {}\n",
+		"lib/a.glsl": "float a;\nfloat b = a +;\n",
+	})()
+	_, pp, err := preprocessShader("main.frag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The source string numbers are the ones the preprocessor's #line directives gave the driver.
+	messages := parseShaderLog("1:2(14): error: syntax error\nERROR: 0:3: 'main' : bad", &pp.shaderFiles)
+	want := []string{"lib/a.glsl:2:14: error: syntax error", "main.frag:3: error: 'main' : bad"}
+	if len(messages) != len(want) {
+		t.Fatalf("got %d messages %v, want %d", len(messages), messages, len(want))
+	}
+	for i, m := range messages {
+		if m.String() != want[i] {
+			t.Errorf("message %d is %q, want %q", i, m, want[i])
+		}
+	}
+	if got := strings.Join(messages[0].Context, "\n"); !strings.Contains(got, "> 2 | float b = a +;") {
+		t.Errorf("got context\n%s\nwant it to mark the included line", got)
+	}
+}
@@ -0,0 +1,429 @@
+package core
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-gl/gl/v4.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+/**
+ * Chunked (geomipmapped) terrain renderer.
+ *
+ * The heightfield is split into square patches. Every patch owns a full resolution vertex grid,
+ * and each level of detail is an index buffer shared by all patches that skips every other
+ * vertex of the level below. Patches pick their level from the distance to the camera, and
+ * hang a skirt below their edges to hide cracks between neighbouring levels. Patches outside
+ * the view frustum aren't drawn at all.
+ */
+type ChunkedTerrain struct {
+	// Mesh resolution in quads, independent of the resolution of the heightfield it samples.
+	width, height             int
+	sourceWidth, sourceHeight int
+	patchSize                 int
+	quadSize                  float32
+	patches                   []*terrainPatch
+	lods                      []terrainLOD
+	// Distance (in world units) covered by the full resolution level, each level after doubles it.
+	LODDistance float32
+	// How far skirts hang below the patch edges, in world units.
+	SkirtDepth float32
+	drawn      int
+}
+
+type terrainPatch struct {
+	m Mesh
+	// Origin in quads, and height range in heightmap units (before the height scale).
+	x, y                 int
+	minHeight, maxHeight float32
+	// Highest water surface, terrain height plus water depth, see UpdateWaterBounds.
+	maxWater float32
+}
+
+type terrainLOD struct {
+	ebo   uint32
+	count int32
+}
+
+// Allowance for erosion moving heights outside the range the bounds were last computed from,
+// between the refreshes made while it runs.
+const boundsMargin = 0.05
+
+/**
+ * Creates a terrain mesh of width x height quads, each `quadSize` world units across.
+ * Both dimensions must be a multiple of the patch size, which must be a power of two.
+ */
+func NewChunkedTerrain(width, height, patchSize int, quadSize float32) *ChunkedTerrain {
+	if patchSize <= 0 || patchSize&(patchSize-1) != 0 {
+		panic(fmt.Sprintf("terrain patch size %d is not a power of two", patchSize))
+	}
+	if width%patchSize != 0 || height%patchSize != 0 {
+		panic(fmt.Sprintf("terrain size %dx%d is not a multiple of the patch size %d", width, height, patchSize))
+	}
+	return &ChunkedTerrain{
+		width:       width,
+		height:      height,
+		patchSize:   patchSize,
+		quadSize:    quadSize,
+		LODDistance: 100,
+		SkirtDepth:  5,
+	}
+}
+
+/**
+ * Cells of the heightfield between neighbouring vertices. Below one the mesh is denser
+ * than the heightfield and upsamples it, above one it skips cells.
+ */
+func (t *ChunkedTerrain) SampleSpacing() float32 {
+	return float32(t.sourceWidth-1) / float32(t.width)
+}
+
+/**
+ * World units between neighbouring cells of the heightfield.
+ */
+func (t *ChunkedTerrain) CellSize() float32 {
+	return t.quadSize / t.SampleSpacing()
+}
+
+/**
+ * Mip level of the height texture to sample, so a coarse mesh sees the average of the
+ * cells between its vertices rather than aliasing.
+ */
+func (t *ChunkedTerrain) SampleLOD() float32 {
+	return float32(math.Max(0, math.Log2(float64(t.SampleSpacing()))))
+}
+
+/**
+ * Number of patches drawn by the last call to Draw, and the total number of patches.
+ */
+func (t *ChunkedTerrain) Stats() (drawn, total int) {
+	return t.drawn, len(t.patches)
+}
+
+/**
+ * The vertex data of every patch, for passes that update it in place (such as normals).
+ */
+func (t *ChunkedTerrain) Meshes() []*Mesh {
+	meshes := make([]*Mesh, len(t.patches))
+	for i, patch := range t.patches {
+		meshes[i] = &patch.m
+	}
+	return meshes
+}
+
+/**
+ * Builds the vertex buffers for every patch, sampling a sourceWidth x sourceHeight heightfield,
+ * and the shared index buffers for every level.
+ */
+func (t *ChunkedTerrain) Construct(sourceWidth, sourceHeight int) {
+	t.sourceWidth, t.sourceHeight = sourceWidth, sourceHeight
+	t.Delete()
+
+	t.patches = t.patches[:0]
+	for x := 0; x < t.width; x += t.patchSize {
+		for y := 0; y < t.height; y += t.patchSize {
+			patch := &terrainPatch{x: x, y: y, minHeight: 0, maxHeight: 1}
+			patch.m = Mesh{Vertices: t.patchVertices(x, y), RenderMode: gl.TRIANGLES}
+			patch.m.Construct()
+			t.patches = append(t.patches, patch)
+		}
+	}
+
+	t.lods = t.lods[:0]
+	for step := 1; step <= t.patchSize; step *= 2 {
+		indices := t.patchIndices(step)
+		var lod = terrainLOD{count: int32(len(indices))}
+		gl.GenBuffers(1, &lod.ebo)
+		gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, lod.ebo)
+		gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, len(indices)*4, gl.Ptr(indices), gl.STATIC_DRAW)
+		t.lods = append(t.lods, lod)
+	}
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, 0)
+}
+
+/**
+ * Frees the GPU buffers of every patch and level.
+ */
+func (t *ChunkedTerrain) Delete() {
+	for _, patch := range t.patches {
+		patch.m.Delete()
+	}
+	for _, lod := range t.lods {
+		gl.DeleteBuffers(1, &lod.ebo)
+	}
+}
+
+/**
+ * Grid vertices of a patch followed by a copy of its four edges for the skirt.
+ * Skirt vertices are flagged with a y of -1, the vertex shader drops them by the skirt depth.
+ * World X follows the cell y axis and world Z the cell x axis.
+ */
+func (t *ChunkedTerrain) patchVertices(originX, originY int) []float32 {
+	n := t.patchSize + 1
+	vertices := make([]float32, 0, (n*n+4*n)*VertexStride)
+	// The first and last vertices land on the edge cells, sample coords between are fractional.
+	spacingX := float32(t.sourceWidth-1) / float32(t.width)
+	spacingY := float32(t.sourceHeight-1) / float32(t.height)
+
+	addVertex := func(i, j int, skirt bool) {
+		quadX, quadY := originX+i, originY+j
+		var flag float32
+		if skirt {
+			flag = -1
+		}
+		vertices = append(vertices,
+			float32(quadY)*t.quadSize-float32(t.height)*t.quadSize/2, flag, float32(quadX)*t.quadSize-float32(t.width)*t.quadSize/2,
+			0, 1, 0,
+			float32(quadX)/float32(t.width), float32(quadY)/float32(t.height),
+			float32(quadX)*spacingX, float32(quadY)*spacingY)
+	}
+
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			addVertex(i, j, false)
+		}
+	}
+	for edge := 0; edge < 4; edge++ {
+		for k := 0; k < n; k++ {
+			i, j := edgeVertex(edge, k, t.patchSize)
+			addVertex(i, j, true)
+		}
+	}
+	return vertices
+}
+
+/**
+ * Position of the k-th vertex along one edge of a patch (top, bottom, left, right).
+ */
+func edgeVertex(edge, k, patchSize int) (i, j int) {
+	switch edge {
+	case 0:
+		return 0, k
+	case 1:
+		return patchSize, k
+	case 2:
+		return k, 0
+	default:
+		return k, patchSize
+	}
+}
+
+/**
+ * Triangles for one level of detail, using every `step`-th vertex, plus its skirts.
+ */
+func (t *ChunkedTerrain) patchIndices(step int) []uint32 {
+	n := t.patchSize + 1
+	grid := func(i, j int) uint32 {
+		return uint32(i*n + j)
+	}
+	skirt := func(edge, k int) uint32 {
+		return uint32(n*n + edge*n + k)
+	}
+
+	var indices []uint32
+	for i := 0; i < t.patchSize; i += step {
+		for j := 0; j < t.patchSize; j += step {
+			// Counter-clockwise seen from above, so the triangles face up.
+			indices = append(indices,
+				grid(i+step, j+step), grid(i, j+step), grid(i, j),
+				grid(i+step, j), grid(i+step, j+step), grid(i, j))
+		}
+	}
+	for edge := 0; edge < 4; edge++ {
+		for k := 0; k < t.patchSize; k += step {
+			i0, j0 := edgeVertex(edge, k, t.patchSize)
+			i1, j1 := edgeVertex(edge, k+step, t.patchSize)
+			indices = append(indices,
+				grid(i0, j0), grid(i1, j1), skirt(edge, k+step),
+				grid(i0, j0), skirt(edge, k+step), skirt(edge, k))
+		}
+	}
+	return indices
+}
+
+/**
+ * Calls visit with every cell of a width x height heightfield that the patch covers,
+ * including those either side of its edges.
+ */
+func (t *ChunkedTerrain) patchCells(patch *terrainPatch, width, height int, visit func(x, y int)) {
+	spacingX := float64(width-1) / float64(t.width)
+	spacingY := float64(height-1) / float64(t.height)
+	fromX, toX := int(float64(patch.x)*spacingX), int(math.Ceil(float64(patch.x+t.patchSize)*spacingX))
+	fromY, toY := int(float64(patch.y)*spacingY), int(math.Ceil(float64(patch.y+t.patchSize)*spacingY))
+	for x := fromX; x <= toX; x++ {
+		for y := fromY; y <= toY; y++ {
+			visit(x, y)
+		}
+	}
+}
+
+/**
+ * Recomputes the height range of each patch, used for culling and picking a level of detail.
+ */
+func (t *ChunkedTerrain) UpdateBounds(h *heightmap.Heightmap) {
+	for _, patch := range t.patches {
+		patch.minHeight, patch.maxHeight = float32(math.Inf(1)), float32(math.Inf(-1))
+		t.patchCells(patch, h.Width, h.Height, func(x, y int) {
+			v := h.At(x, y)
+			patch.minHeight = float32(math.Min(float64(patch.minHeight), float64(v)))
+			patch.maxHeight = float32(math.Max(float64(patch.maxHeight), float64(v)))
+		})
+	}
+}
+
+/**
+ * Recomputes the highest water surface over each patch, used for culling the water drawn over it.
+ * height and water are the terrain height and water depth, in heightmap units.
+ */
+func (t *ChunkedTerrain) UpdateWaterBounds(height, water *heightmap.Heightmap) {
+	for _, patch := range t.patches {
+		patch.maxWater = float32(math.Inf(-1))
+		t.patchCells(patch, height.Width, height.Height, func(x, y int) {
+			patch.maxWater = float32(math.Max(float64(patch.maxWater), float64(height.At(x, y)+water.At(x, y))))
+		})
+	}
+}
+
+/**
+ * Recomputes the vertex normals of every patch on the CPU from a heightmap, with heights scaled
+ * the same way the vertex shader displaces them.
+ */
+func (t *ChunkedTerrain) UpdateNormals(h *heightmap.Heightmap, heightScale float32) {
+	cellSize, spacing := t.CellSize(), t.SampleSpacing()
+	for _, patch := range t.patches {
+		vertices := patch.m.Vertices
+		for i := 0; i < len(vertices); i += VertexStride {
+			normal := h.NormalAt(vertices[i+SampleCoordOffset], vertices[i+SampleCoordOffset+1], spacing, cellSize, heightScale)
+			copy(vertices[i+NormalOffset:i+NormalOffset+3], normal[:])
+		}
+		patch.m.UpdateVertices()
+	}
+}
+
+/**
+ * World space bounding box of a patch, with heights multiplied by heightScale.
+ */
+func (t *ChunkedTerrain) patchBounds(patch *terrainPatch, heightScale float32) (min, max mgl32.Vec3) {
+	halfX := float32(t.height) * t.quadSize / 2
+	halfZ := float32(t.width) * t.quadSize / 2
+	size := float32(t.patchSize) * t.quadSize
+	min = mgl32.Vec3{
+		float32(patch.y)*t.quadSize - halfX,
+		(patch.minHeight-boundsMargin)*heightScale - t.SkirtDepth,
+		float32(patch.x)*t.quadSize - halfZ,
+	}
+	max = mgl32.Vec3{
+		min[0] + size,
+		(patch.maxHeight + boundsMargin) * heightScale,
+		min[2] + size,
+	}
+	return min, max
+}
+
+/**
+ * World space bounding box of the water over a patch, which can stand above the terrain.
+ */
+func (t *ChunkedTerrain) waterBounds(patch *terrainPatch, heightScale float32) (min, max mgl32.Vec3) {
+	min, max = t.patchBounds(patch, heightScale)
+	if surface := (patch.maxWater + boundsMargin) * heightScale; surface > max[1] {
+		max[1] = surface
+	}
+	return min, max
+}
+
+/**
+ * World space bounding box of the whole terrain, with heights multiplied by heightScale.
+ */
+func (t *ChunkedTerrain) Bounds(heightScale float32) (min, max mgl32.Vec3) {
+	for i, patch := range t.patches {
+		patchMin, patchMax := t.patchBounds(patch, heightScale)
+		if i == 0 {
+			min, max = patchMin, patchMax
+			continue
+		}
+		for axis := 0; axis < 3; axis++ {
+			min[axis] = float32(math.Min(float64(min[axis]), float64(patchMin[axis])))
+			max[axis] = float32(math.Max(float64(max[axis]), float64(patchMax[axis])))
+		}
+	}
+	return min, max
+}
+
+/**
+ * Picks the level of detail for a patch from the camera's distance to its bounding box.
+ */
+func (t *ChunkedTerrain) patchLOD(min, max, cameraPos mgl32.Vec3) int {
+	var offset mgl32.Vec3
+	for i := 0; i < 3; i++ {
+		offset[i] = float32(math.Max(float64(min[i]-cameraPos[i]), math.Max(0, float64(cameraPos[i]-max[i]))))
+	}
+	distance := offset.Len()
+	if distance < t.LODDistance || t.LODDistance <= 0 {
+		return 0
+	}
+	level := int(math.Log2(float64(distance/t.LODDistance))) + 1
+	if level >= len(t.lods) {
+		level = len(t.lods) - 1
+	}
+	return level
+}
+
+/**
+ * Draws every visible patch. The terrain shader program must already be in use,
+ * viewProjection and heightScale should match what it was given.
+ */
+func (t *ChunkedTerrain) Draw(viewProjection mgl32.Mat4, cameraPos mgl32.Vec3, heightScale float32) {
+	t.drawn = t.drawPatches(viewProjection, cameraPos, heightScale, t.patchBounds)
+}
+
+/**
+ * Draws the patches for the water surface, culled against bounds that include the water's depth.
+ * Unlike Draw it leaves the stats alone.
+ */
+func (t *ChunkedTerrain) DrawWater(viewProjection mgl32.Mat4, cameraPos mgl32.Vec3, heightScale float32) {
+	t.drawPatches(viewProjection, cameraPos, heightScale, t.waterBounds)
+}
+
+/**
+ * Draws the patches whose bounds are in view, returning how many were drawn.
+ */
+func (t *ChunkedTerrain) drawPatches(viewProjection mgl32.Mat4, cameraPos mgl32.Vec3, heightScale float32,
+	bounds func(patch *terrainPatch, heightScale float32) (min, max mgl32.Vec3)) int {
+	frustum := NewFrustum(viewProjection)
+	var drawn int
+	for _, patch := range t.patches {
+		min, max := bounds(patch, heightScale)
+		if !frustum.IntersectsBox(min, max) {
+			continue
+		}
+		lod := t.lods[t.patchLOD(min, max, cameraPos)]
+		patch.m.DrawIndexed(lod.ebo, lod.count)
+		drawn++
+	}
+	return drawn
+}
+
+/**
+ * World position of a (fractional) heightfield cell, at height zero.
+ */
+func (t *ChunkedTerrain) CellToWorld(cellX, cellY float32) mgl32.Vec3 {
+	originX, originZ := t.CellOrigin()
+	return mgl32.Vec3{originX + cellY*t.CellSize(), 0, originZ + cellX*t.CellSize()}
+}
+
+/**
+ * Heightfield cell under a world position.
+ */
+func (t *ChunkedTerrain) WorldToCell(position mgl32.Vec3) (cellX, cellY float32) {
+	originX, originZ := t.CellOrigin()
+	return (position[2] - originZ) / t.CellSize(), (position[0] - originX) / t.CellSize()
+}
+
+/**
+ * World X and Z of cell (0, 0).
+ */
+func (t *ChunkedTerrain) CellOrigin() (x, z float32) {
+	return -float32(t.height) * t.quadSize / 2, -float32(t.width) * t.quadSize / 2
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"sort"
+)
+
+// Programs built from files, in the order they were loaded.
+var watched []*Program
+
+func watch(p *Program) {
+	watched = append(watched, p)
+}
+
+func unwatch(p *Program) {
+	for i, w := range watched {
+		if w == p {
+			watched = append(watched[:i], watched[i+1:]...)
+			return
+		}
+	}
+}
+
+/**
+ * The programs built from shader files that haven't been deleted, sorted by name.
+ */
+func WatchedPrograms() []*Program {
+	programs := append([]*Program(nil), watched...)
+	sort.SliceStable(programs, func(i, j int) bool { return programs[i].Name < programs[j].Name })
+	return programs
+}
+
+/**
+ * Reloads every program whose shader files changed on disk since it was last built, returning those it tried.
+ * A program that fails to build keeps running with its old shaders, see Program.Error.
+ */
+func ReloadChangedShaders() []*Program {
+	var reloaded []*Program
+	for _, p := range watched {
+		if p.changed() {
+			p.Reload()
+			reloaded = append(reloaded, p)
+		}
+	}
+	return reloaded
+}
+
+/**
+ * Reloads every program built from files, whether or not they changed.
+ */
+func ReloadShaders() {
+	for _, p := range watched {
+		p.Reload()
+	}
+}
+
+/**
+ * The programs whose last reload failed.
+ */
+func ShaderErrors() []*Program {
+	var failed []*Program
+	for _, p := range WatchedPrograms() {
+		if p.Error() != nil {
+			failed = append(failed, p)
+		}
+	}
+	return failed
+}
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"github.com/go-gl/gl/v4.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+const (
+	waterVertexShaderPath   = "water.vert"
+	waterFragmentShaderPath = "water.frag"
+)
+
+/**
+ * Look of the water surface.
+ */
+type WaterSettings struct {
+	Enabled bool
+	// Colour over shallow water and deep water.
+	ShallowColour, DeepColour [3]float32
+	// How quickly the water darkens and turns opaque with depth, per world unit.
+	Absorption float32
+	// Water shallower than this (in simulation height units) isn't drawn.
+	MinDepth float32
+	// Blinn-Phong exponent of the sun's highlight.
+	Shininess float32
+	// World units per ripple, how strongly they bend the surface normal, and how fast they follow the flow.
+	RippleScale, RippleStrength, FlowSpeed float32
+}
+
+func DefaultWaterSettings() WaterSettings {
+	return WaterSettings{
+		Enabled:        true,
+		ShallowColour:  [3]float32{0.1, 0.45, 0.5},
+		DeepColour:     [3]float32{0.02, 0.1, 0.2},
+		Absorption:     0.8,
+		MinDepth:       0.0005,
+		Shininess:      128,
+		RippleScale:    2,
+		RippleStrength: 0.3,
+		FlowSpeed:      1,
+	}
+}
+
+/**
+ * Draws the simulated water as a surface of its own over the terrain.
+ */
+type Water struct {
+	WaterSettings
+	program *Program
+}
+
+func NewWater() (*Water, error) {
+	program, err := NewProgramFromPath(waterVertexShaderPath, waterFragmentShaderPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Water{WaterSettings: DefaultWaterSettings(), program: program}, nil
+}
+
+/**
+ * Draws the water over the patches of `terrain`, blended over what's already been drawn.
+ * Patches are culled with the water bounds, see ChunkedTerrain.UpdateWaterBounds.
+ * heightTexture and velocityTexture are the sampled simulation state (see GPUEroder.HeightSampleTexture),
+ * time is in seconds and animates the ripples.
+ */
+func (w *Water) Draw(terrain *ChunkedTerrain, projection, camera mgl32.Mat4, cameraPos, lightDir mgl32.Vec3, heightScale, time float32, heightTexture, velocityTexture uint32) {
+	if !w.Enabled {
+		return
+	}
+	p := w.program
+	p.Use()
+	p.SetMat4("projection", projection)
+	p.SetMat4("camera", camera)
+	p.SetFloat("height", heightScale)
+	p.SetFloat("sampleLod", terrain.SampleLOD())
+	p.SetVec3("cameraPos", cameraPos)
+	p.SetFloat("time", time)
+	p.SetVec3("lightDir", lightDir)
+	p.SetVec3("shallowColour", w.ShallowColour)
+	p.SetVec3("deepColour", w.DeepColour)
+	p.SetFloat("absorption", w.Absorption)
+	p.SetFloat("minDepth", w.MinDepth)
+	p.SetFloat("shininess", w.Shininess)
+	p.SetFloat("rippleScale", w.RippleScale)
+	p.SetFloat("rippleStrength", w.RippleStrength)
+	p.SetFloat("flowSpeed", w.FlowSpeed)
+	p.SetFloat("cellSize", terrain.CellSize())
+
+	gl.ActiveTexture(gl.TEXTURE2)
+	gl.BindTexture(gl.TEXTURE_2D, heightTexture)
+	gl.ActiveTexture(gl.TEXTURE4)
+	gl.BindTexture(gl.TEXTURE_2D, velocityTexture)
+	gl.ActiveTexture(gl.TEXTURE0)
+
+	// Water doesn't hide what's behind it from later passes.
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+	gl.DepthMask(false)
+	terrain.DrawWater(projection.Mul4(camera), cameraPos, heightScale)
+	gl.DepthMask(true)
+	gl.Disable(gl.BLEND)
+}
@@ -0,0 +1,171 @@
+package erosion
+
+import (
+	"math"
+)
+
+type BrushTool int32
+
+const (
+	BrushNone BrushTool = iota
+	// Add height, or take it away.
+	BrushRaise
+	BrushLower
+	// Blend towards the average of the neighbouring cells.
+	BrushSmooth
+	// Blend towards the height under the cursor when the stroke started.
+	BrushFlatten
+	// Displace by value noise.
+	BrushNoise
+	// Pour water onto the terrain, so the running simulation erodes there.
+	BrushErode
+)
+
+var BrushToolNames = []string{"None", "Raise", "Lower", "Smooth", "Flatten", "Noise", "Erode Here"}
+
+// Smooth and flatten move this far towards their target per unit of strength per second.
+const brushBlendRate = 10
+
+/**
+ * A sculpting tool, applied to the simulation state around a cell by the eroders' ApplyBrush.
+ */
+type Brush struct {
+	Tool BrushTool
+	// In cells.
+	Radius float32
+	// Height (or water) added per second at the centre of the brush.
+	Strength float32
+	// Fraction of the radius over which the brush fades out, 0 gives a hard edge.
+	Falloff float32
+	// Cells per noise feature.
+	NoiseScale float32
+	// Height the flatten tool works towards, see BeginStroke.
+	Target float32
+}
+
+func NewBrush() *Brush {
+	return &Brush{
+		Tool:       BrushNone,
+		Radius:     10,
+		Strength:   0.1,
+		Falloff:    0.5,
+		NoiseScale: 4,
+	}
+}
+
+/**
+ * Starts a stroke on a cell with the given height, which the flatten tool keeps to.
+ */
+func (b *Brush) BeginStroke(height float32) {
+	b.Target = height
+}
+
+/**
+ * Strength of the brush at `distance` cells from its centre, from 1 inside to 0 at the edge.
+ */
+func (b *Brush) Weight(distance float32) float32 {
+	if b.Radius <= 0 || distance >= b.Radius {
+		return 0
+	}
+	r := distance / b.Radius
+	inner := 1 - b.Falloff
+	if r <= inner {
+		return 1
+	}
+	t := (r - inner) / b.Falloff
+	return 1 - t*t*(3-2*t)
+}
+
+/**
+ * Cells covered by the brush centred on (cellX, cellY), clipped to a width x height grid.
+ * The maximum bounds are exclusive.
+ */
+func (b *Brush) Bounds(cellX, cellY float32, width, height int) (minX, minY, maxX, maxY int) {
+	minX = int(math.Max(0, math.Floor(float64(cellX-b.Radius))))
+	minY = int(math.Max(0, math.Floor(float64(cellY-b.Radius))))
+	maxX = int(math.Min(float64(width), math.Ceil(float64(cellX+b.Radius))+1))
+	maxY = int(math.Min(float64(height), math.Ceil(float64(cellY+b.Radius))+1))
+	return
+}
+
+/**
+ * Applies dt seconds of the brush to a single channel of a width x height grid.
+ * All new values are worked out before any are written, so smoothing only sees the old state.
+ */
+func (b *Brush) apply(at func(x, y int) float32, set func(x, y int, value float32), cellX, cellY, dt float32, width, height int) {
+	minX, minY, maxX, maxY := b.Bounds(cellX, cellY, width, height)
+	if minX >= maxX || minY >= maxY {
+		return
+	}
+	clamped := func(x, y int) float32 {
+		x = int(math.Max(0, math.Min(float64(width-1), float64(x))))
+		y = int(math.Max(0, math.Min(float64(height-1), float64(y))))
+		return at(x, y)
+	}
+
+	values := make([]float32, (maxX-minX)*(maxY-minY))
+	for x := minX; x < maxX; x++ {
+		for y := minY; y < maxY; y++ {
+			value := at(x, y)
+			distance := float32(math.Hypot(float64(float32(x)-cellX), float64(float32(y)-cellY)))
+			values[(x-minX)*(maxY-minY)+y-minY] = b.applyCell(value, x, y, b.Weight(distance)*b.Strength*dt, clamped)
+		}
+	}
+	for x := minX; x < maxX; x++ {
+		for y := minY; y < maxY; y++ {
+			set(x, y, values[(x-minX)*(maxY-minY)+y-minY])
+		}
+	}
+}
+
+/**
+ * New value of a cell after the brush adds `amount` to it. Kept in step with shaders/Brush.comp.
+ */
+func (b *Brush) applyCell(value float32, x, y int, amount float32, at func(x, y int) float32) float32 {
+	if amount <= 0 {
+		return value
+	}
+	blend := float32(math.Min(1, float64(amount*brushBlendRate)))
+	switch b.Tool {
+	case BrushRaise, BrushErode:
+		value += amount
+	case BrushLower:
+		value -= amount
+	case BrushSmooth:
+		var sum float32
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				sum += at(x+dx, y+dy)
+			}
+		}
+		value += (sum/9 - value) * blend
+	case BrushFlatten:
+		value += (b.Target - value) * blend
+	case BrushNoise:
+		value += amount * valueNoise(float32(x)/b.NoiseScale, float32(y)/b.NoiseScale)
+	}
+	return float32(math.Max(0, float64(value)))
+}
+
+/**
+ * Smoothly interpolated lattice noise in [-1, 1].
+ */
+func valueNoise(x, y float32) float32 {
+	x0, y0 := float32(math.Floor(float64(x))), float32(math.Floor(float64(y)))
+	tx, ty := x-x0, y-y0
+	tx, ty = tx*tx*(3-2*tx), ty*ty*(3-2*ty)
+	ix, iy := uint32(int32(x0)), uint32(int32(y0))
+
+	n00, n10 := latticeValue(ix, iy), latticeValue(ix+1, iy)
+	n01, n11 := latticeValue(ix, iy+1), latticeValue(ix+1, iy+1)
+	top := n00 + (n10-n00)*tx
+	bottom := n01 + (n11-n01)*tx
+	return top + (bottom-top)*ty
+}
+
+func latticeValue(x, y uint32) float32 {
+	h := x*374761393 + y*668265263
+	h = (h ^ (h >> 13)) * 1274126177
+	h ^= h >> 16
+	return float32(h&0xffffff)/float32(0xffffff)*2 - 1
+}
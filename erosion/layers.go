@@ -0,0 +1,33 @@
+package erosion
+
+import (
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+/**
+ * Snapshot of every simulation channel, in heightmap layout.
+ */
+type Layers struct {
+	Height, Water, Sediment *heightmap.Heightmap
+	VelocityX, VelocityY    *heightmap.Heightmap
+	// Outflow flux through each pipe: left, right, top, bottom.
+	Outflow [4]*heightmap.Heightmap
+	// Terrain height relative to the terrain the simulation started from, or was last edited to.
+	// Negative values are eroded, positive values are deposited.
+	Delta *heightmap.Heightmap
+}
+
+/**
+ * Implemented by both the CPU and GPU eroders.
+ */
+type LayerSource interface {
+	Layers() *Layers
+}
+
+func delta(current, initial *heightmap.Heightmap) *heightmap.Heightmap {
+	var d = heightmap.New(current.Width, current.Height)
+	for i := range d.Data {
+		d.Data[i] = current.Data[i] - initial.Data[i]
+	}
+	return d
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/go-gl/gl/v4.3-core/gl"
 	"github.com/go-gl/mathgl/mgl32"
 	"github.com/ob6160/Terrain/generators"
+	"github.com/ob6160/Terrain/heightmap"
 	"github.com/ob6160/Terrain/utils"
 	"math"
 	_ "math/rand"
@@ -31,6 +32,7 @@ type CPUEroder struct {
 	WaterHeightBuffer, WaterHeightBufferTexture uint32
 	HeightmapBuffer, HeightmapBufferTexture     uint32
 	heightmap                                   *generators.TerrainGenerator
+	origin                                      *heightmap.Heightmap
 	iterations                                  int
 }
 
@@ -103,6 +105,97 @@ func (t *CPUEroder) newLayerData() *LayerData {
 func (t *CPUEroder) Reset() {
 	t.initial = t.newLayerData()
 	t.swap = t.newLayerData()
+	t.origin = heightmap.FromGenerator(*t.heightmap)
+}
+
+/**
+ * Returns a copy of the current (eroded) terrain height.
+ */
+func (t *CPUEroder) Heightmap() *heightmap.Heightmap {
+	h := heightmap.FromGrid(t.initial.heightmap, t.width, t.height)
+	h.Geo = heightmap.GeoreferenceOf(*t.heightmap)
+	return h
+}
+
+/**
+ * Measures erosion from the current terrain from now on, see GPUEroder.ResetDelta.
+ */
+func (t *CPUEroder) ResetDelta() {
+	t.origin = t.Heightmap()
+}
+
+func (t *CPUEroder) Layers() *Layers {
+	var layers = &Layers{
+		Height:    t.Heightmap(),
+		Water:     heightmap.FromGrid(t.initial.waterHeight, t.width, t.height),
+		Sediment:  heightmap.FromGrid(t.initial.suspendedSediment, t.width, t.height),
+		VelocityX: heightmap.New(t.width, t.height),
+		VelocityY: heightmap.New(t.width, t.height),
+	}
+	for i := range layers.Outflow {
+		layers.Outflow[i] = heightmap.New(t.width, t.height)
+	}
+	for x := 0; x < t.width; x++ {
+		for y := 0; y < t.height; y++ {
+			var i = utils.ToIndex(x, y, t.width)
+			layers.VelocityX.Set(x, y, t.initial.velocity[i].X())
+			layers.VelocityY.Set(x, y, t.initial.velocity[i].Y())
+			for pipe, flux := range t.initial.outflowFlux[i] {
+				layers.Outflow[pipe].Set(x, y, flux)
+			}
+		}
+	}
+	layers.Delta = delta(layers.Height, t.origin)
+	return layers
+}
+
+/**
+ * Sculpts the live state with dt seconds of a brush centred on (cellX, cellY).
+ */
+func (t *CPUEroder) ApplyBrush(b *Brush, cellX, cellY, dt float32) {
+	if b.Tool == BrushNone {
+		return
+	}
+	var channel = func(layer *LayerData) []float32 {
+		if b.Tool == BrushErode {
+			return layer.waterHeight
+		}
+		return layer.heightmap
+	}
+	var current, swap = channel(t.initial), channel(t.swap)
+	b.apply(func(x, y int) float32 {
+		return current[utils.ToIndex(x, y, t.width)]
+	}, func(x, y int, value float32) {
+		// Both layers, so the change survives the next step whichever way round they are.
+		current[utils.ToIndex(x, y, t.width)] = value
+		swap[utils.ToIndex(x, y, t.width)] = value
+	}, cellX, cellY, dt, t.width, t.height)
+}
+
+/**
+ * Terrain height over a rectangle of cells, in heightmap layout.
+ */
+func (t *CPUEroder) Heights(x, y, width, height int) []float32 {
+	var values = make([]float32, width*height)
+	for i := 0; i < width; i++ {
+		for j := 0; j < height; j++ {
+			values[i+j*width] = t.initial.heightmap[utils.ToIndex(x+i, y+j, t.width)]
+		}
+	}
+	return values
+}
+
+/**
+ * Overwrites the terrain height over a rectangle of cells, leaving the water and sediment alone.
+ */
+func (t *CPUEroder) SetHeights(x, y, width, height int, values []float32) {
+	for i := 0; i < width; i++ {
+		for j := 0; j < height; j++ {
+			var index = utils.ToIndex(x+i, y+j, t.width)
+			t.initial.heightmap[index] = values[i+j*width]
+			t.swap.heightmap[index] = values[i+j*width]
+		}
+	}
 }
 
 func (t *CPUEroder) IsRunning() bool {
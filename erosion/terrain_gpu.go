@@ -2,10 +2,13 @@ package erosion
 
 import (
 	"github.com/go-gl/gl/v4.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
 	"github.com/ob6160/Terrain/core"
 	"github.com/ob6160/Terrain/generators"
+	"github.com/ob6160/Terrain/heightmap"
 	"github.com/ob6160/Terrain/utils"
 	_ "github.com/ob6160/Terrain/utils"
+	"math"
 	"math/rand"
 	"unsafe"
 )
@@ -16,12 +19,6 @@ type PackedData struct {
 	outflowData  []float32
 }
 
-type UniformMap map[string]int32 //program -> name -> handle
-type ProgramMap map[uint32]UniformMap
-
-/**
- * TODO: Move program variables into a map like Uniforms?
- */
 type GPUEroder struct {
 	heightmap                                                                                              generators.TerrainGenerator
 	simulationState                                                                                        *PackedData
@@ -33,27 +30,36 @@ type GPUEroder struct {
 	nextOutflowColorBuffer                                                                                 uint32 // o1, o2, o3, o4
 	nextVelocityColorBuffer                                                                                uint32 // vX, vY
 	nextHeightColorBuffer                                                                                  uint32 // landHeight, waterHeight, sediment
-	waterPassProgram, outflowProgram, waterHeightProgram, velocityProgram, erosionProgram, sedimentProgram uint32
-	uniforms           																					   ProgramMap //program -> name -> handle
+	waterPassProgram, outflowProgram, waterHeightProgram, velocityProgram, erosionProgram, sedimentProgram *core.Program
+	normalsProgram, brushProgram                                                                           *core.Program
+	heightSampleTexture                                                                                    uint32 // filtered, mipmapped copy of the height state
+	velocitySampleTexture                                                                                  uint32 // filtered copy of the velocity state
+	outflowSampleTexture                                                                                   uint32 // filtered copy of the outflow state
+	initialHeightTexture                                                                                   uint32 // terrain height erosion is measured from, see ResetDelta
+	initialHeight                                                                                          *heightmap.Heightmap
 	state                                       														   *State
 }
 
-func NewGPUEroder(heightmap generators.TerrainGenerator, state *State) *GPUEroder {
+/**
+ * Fails if the compute shaders don't build, the error is a *core.ShaderError pointing at the problem.
+ */
+func NewGPUEroder(heightmap generators.TerrainGenerator, state *State) (*GPUEroder, error) {
 	var e = new(GPUEroder)
 	e.heightmap = heightmap
 	e.state = state
-	e.uniforms = make(ProgramMap)
+	if err := e.loadComputeShaders(); err != nil {
+		return nil, err
+	}
 	e.Reset()
-	return e
+	return e, nil
 }
 
 func (e *GPUEroder) Reset() {
 	e.packData()
-	e.loadComputeShaders()
-	e.setupUniforms()
 	e.updateUniforms()
 	e.setupTextures()
 	e.setupFramebuffers()
+	e.updateSampleTextures()
 }
 
 func (e *GPUEroder) BindOutflowDrawFramebuffer() {
@@ -92,6 +98,130 @@ func (e *GPUEroder) VelocityDisplayTexture() uint32 {
 	return e.displayTextureVelocity
 }
 
+/**
+ * Full precision copy of the height state with linear filtering and mipmaps,
+ * for sampling the terrain at positions that don't line up with the simulation cells.
+ */
+func (e *GPUEroder) HeightSampleTexture() uint32 {
+	return e.heightSampleTexture
+}
+
+/**
+ * Full precision copy of the velocity state with linear filtering.
+ */
+func (e *GPUEroder) VelocitySampleTexture() uint32 {
+	return e.velocitySampleTexture
+}
+
+/**
+ * Full precision copy of the outflow state with linear filtering.
+ */
+func (e *GPUEroder) OutflowSampleTexture() uint32 {
+	return e.outflowSampleTexture
+}
+
+/**
+ * Terrain height the simulation started from, or was last edited to, in the red channel,
+ * for comparing against the eroded height.
+ */
+func (e *GPUEroder) InitialHeightTexture() uint32 {
+	return e.initialHeightTexture
+}
+
+/**
+ * Reads a packed RGBA state texture back from the GPU.
+ */
+func (e *GPUEroder) readTexture(texture uint32) []float32 {
+	width, height := e.heightmap.Dimensions()
+	data := make([]float32, width*height*4)
+	gl.MemoryBarrier(gl.TEXTURE_UPDATE_BARRIER_BIT)
+	gl.BindTexture(gl.TEXTURE_2D, texture)
+	gl.GetTexImage(gl.TEXTURE_2D, 0, gl.RGBA, gl.FLOAT, gl.Ptr(data))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return data
+}
+
+/**
+ * Returns a copy of the current (eroded) terrain height.
+ */
+func (e *GPUEroder) Heightmap() *heightmap.Heightmap {
+	width, height := e.heightmap.Dimensions()
+	h := heightmap.FromPacked(e.readTexture(e.nextHeightColorBuffer), width, height, 0)
+	h.Geo = heightmap.GeoreferenceOf(e.heightmap)
+	return h
+}
+
+/**
+ * Copies of the current terrain height and water depth, read back together.
+ */
+func (e *GPUEroder) Surface() (height, water *heightmap.Heightmap) {
+	width, h := e.heightmap.Dimensions()
+	data := e.readTexture(e.nextHeightColorBuffer)
+	return heightmap.FromPacked(data, width, h, 0), heightmap.FromPacked(data, width, h, 1)
+}
+
+/**
+ * Measures erosion from the current terrain from now on, so edits like brush strokes and undo
+ * don't show up in the delta as erosion.
+ */
+func (e *GPUEroder) ResetDelta() {
+	width, height := e.heightmap.Dimensions()
+	copy(e.initialHeight.Data, e.Heights(0, 0, width, height))
+	gl.BindTexture(gl.TEXTURE_2D, e.initialHeightTexture)
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, int32(width), int32(height), gl.RED, gl.FLOAT, gl.Ptr(e.initialHeight.Data))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+/**
+ * Terrain height over a rectangle of cells, in heightmap layout.
+ */
+func (e *GPUEroder) Heights(x, y, width, height int) []float32 {
+	values := make([]float32, width*height)
+	gl.MemoryBarrier(gl.FRAMEBUFFER_BARRIER_BIT)
+	e.BindNextHeightReadFramebuffer()
+	gl.ReadPixels(int32(x), int32(y), int32(width), int32(height), gl.RED, gl.FLOAT, gl.Ptr(values))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+	return values
+}
+
+/**
+ * Overwrites the terrain height over a rectangle of cells, leaving the water and sediment alone.
+ */
+func (e *GPUEroder) SetHeights(x, y, width, height int, values []float32) {
+	texels := make([]float32, width*height*4)
+	gl.MemoryBarrier(gl.FRAMEBUFFER_BARRIER_BIT)
+	e.BindNextHeightReadFramebuffer()
+	gl.ReadPixels(int32(x), int32(y), int32(width), int32(height), gl.RGBA, gl.FLOAT, gl.Ptr(texels))
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
+	for i, value := range values {
+		texels[i*4] = value
+	}
+	gl.BindTexture(gl.TEXTURE_2D, e.nextHeightColorBuffer)
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, int32(x), int32(y), int32(width), int32(height), gl.RGBA, gl.FLOAT, gl.Ptr(texels))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	e.updateSampleTextures()
+}
+
+func (e *GPUEroder) Layers() *Layers {
+	width, height := e.heightmap.Dimensions()
+	heightData := e.readTexture(e.nextHeightColorBuffer)
+	outflowData := e.readTexture(e.nextOutflowColorBuffer)
+	velocityData := e.readTexture(e.nextVelocityColorBuffer)
+
+	var layers = &Layers{
+		Height:    heightmap.FromPacked(heightData, width, height, 0),
+		Water:     heightmap.FromPacked(heightData, width, height, 1),
+		Sediment:  heightmap.FromPacked(heightData, width, height, 2),
+		VelocityX: heightmap.FromPacked(velocityData, width, height, 1),
+		VelocityY: heightmap.FromPacked(velocityData, width, height, 2),
+	}
+	for pipe := range layers.Outflow {
+		layers.Outflow[pipe] = heightmap.FromPacked(outflowData, width, height, pipe)
+	}
+	layers.Height.Geo = heightmap.GeoreferenceOf(e.heightmap)
+	layers.Delta = delta(layers.Height, e.initialHeight)
+	return layers
+}
 
 func (e *GPUEroder) packData() {
 	var width, height = e.heightmap.Dimensions()
@@ -191,6 +321,69 @@ func (e *GPUEroder) setupTextures() {
 
 	e.currentVelocityColorBuffer = createStateTexture(width, height, gl.Ptr(e.simulationState.velocityData))
 	gl.BindImageTexture(5, e.currentVelocityColorBuffer, 0, false, 0, gl.READ_ONLY, gl.RGBA32F)
+
+	// Sampled copies of the height and velocity state, refreshed after every pass.
+	levels := int32(math.Log2(math.Max(float64(width), float64(height)))) + 1
+	gl.DeleteTextures(1, &e.heightSampleTexture)
+	gl.GenTextures(1, &e.heightSampleTexture)
+	gl.BindTexture(gl.TEXTURE_2D, e.heightSampleTexture)
+	gl.TexStorage2D(gl.TEXTURE_2D, levels, gl.RGBA32F, int32(width), int32(height))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR_MIPMAP_LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+
+	e.velocitySampleTexture = createSampleTexture(e.velocitySampleTexture, width, height)
+	e.outflowSampleTexture = createSampleTexture(e.outflowSampleTexture, width, height)
+
+	e.initialHeight = heightmap.FromPacked(e.simulationState.heightData, width, height, 0)
+	gl.DeleteTextures(1, &e.initialHeightTexture)
+	gl.GenTextures(1, &e.initialHeightTexture)
+	gl.BindTexture(gl.TEXTURE_2D, e.initialHeightTexture)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, gl.R32F, int32(width), int32(height), 0, gl.RGBA, gl.FLOAT, gl.Ptr(e.simulationState.heightData))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+}
+
+/**
+ * Replaces `texture` with an empty, linearly filtered RGBA32F texture of the given size.
+ */
+func createSampleTexture(texture uint32, width, height int) uint32 {
+	gl.DeleteTextures(1, &texture)
+	gl.GenTextures(1, &texture)
+	gl.BindTexture(gl.TEXTURE_2D, texture)
+	gl.TexStorage2D(gl.TEXTURE_2D, 1, gl.RGBA32F, int32(width), int32(height))
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	return texture
+}
+
+/**
+ * Copies the latest height, velocity and outflow state into the sampled textures and rebuilds the height mipmaps.
+ */
+func (e *GPUEroder) updateSampleTextures() {
+	width, height := e.heightmap.Dimensions()
+	gl.MemoryBarrier(gl.FRAMEBUFFER_BARRIER_BIT | gl.TEXTURE_UPDATE_BARRIER_BIT)
+	e.BindNextHeightReadFramebuffer()
+	gl.BindTexture(gl.TEXTURE_2D, e.heightSampleTexture)
+	gl.CopyTexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, 0, 0, int32(width), int32(height))
+	gl.GenerateMipmap(gl.TEXTURE_2D)
+
+	e.BindNextVelocityReadFramebuffer()
+	gl.BindTexture(gl.TEXTURE_2D, e.velocitySampleTexture)
+	gl.CopyTexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, 0, 0, int32(width), int32(height))
+
+	e.BindNextOutflowReadFramebuffer()
+	gl.BindTexture(gl.TEXTURE_2D, e.outflowSampleTexture)
+	gl.CopyTexSubImage2D(gl.TEXTURE_2D, 0, 0, 0, 0, 0, int32(width), int32(height))
+	gl.BindTexture(gl.TEXTURE_2D, 0)
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, 0)
 }
 
 func createStateTexture(width, height int, data unsafe.Pointer) uint32 {
@@ -283,126 +476,166 @@ func (e *GPUEroder) Pass() {
 	subH := uint32(height / subdivideSize)
 	
 	// Distribute new "water" across the terrain
-	gl.UseProgram(e.waterPassProgram)
+	e.waterPassProgram.Use()
 	gl.DispatchCompute(subW, subH, 1)
 	gl.MemoryBarrier(gl.SHADER_IMAGE_ACCESS_BARRIER_BIT)
 
 	// Calculate the movement of water across each cell of the terrain.
-	gl.UseProgram(e.outflowProgram)
+	e.outflowProgram.Use()
 	gl.DispatchCompute(subW, subH, 1)
 	gl.MemoryBarrier(gl.SHADER_IMAGE_ACCESS_BARRIER_BIT)
 
 	// Calculate the resultant height of water in each cell based on previous step.
-	gl.UseProgram(e.waterHeightProgram)
+	e.waterHeightProgram.Use()
 	gl.DispatchCompute(subW, subH, 1)
 	gl.MemoryBarrier(gl.SHADER_IMAGE_ACCESS_BARRIER_BIT)
 
 	// Calculate the velocity of water as it moves across the terrain.
-	gl.UseProgram(e.velocityProgram)
+	e.velocityProgram.Use()
 	gl.DispatchCompute(subW, subH, 1)
 	gl.MemoryBarrier(gl.SHADER_IMAGE_ACCESS_BARRIER_BIT)
 
 	// Decide whether we're deposition or eroding sediment this timestep.
-	gl.UseProgram(e.erosionProgram)
+	e.erosionProgram.Use()
 	gl.DispatchCompute(subW, subH, 1)
 	gl.MemoryBarrier(gl.SHADER_IMAGE_ACCESS_BARRIER_BIT)
 
 	// Drive the advection of sediment.
-	gl.UseProgram(e.sedimentProgram)
+	e.sedimentProgram.Use()
 	gl.DispatchCompute(subW, subH, 1)
 	gl.MemoryBarrier(gl.SHADER_IMAGE_ACCESS_BARRIER_BIT)
+
+	e.updateSampleTextures()
 }
 
 /**
- * Loads each compute shader in the pipeline.
+ * Sculpts the live state with dt seconds of a brush centred on (cellX, cellY).
+ * Works on the "next" textures, so the following pass carries on from the sculpted terrain.
  */
-func (e *GPUEroder) loadComputeShaders() {
-	var err error
-	e.waterPassProgram, err = core.NewComputeProgramFromPath("./shaders/WaterPass.comp")
-	if err != nil {
-		panic(err)
+func (e *GPUEroder) ApplyBrush(b *Brush, cellX, cellY, dt float32) {
+	if b.Tool == BrushNone {
+		return
 	}
-
-	e.outflowProgram, err = core.NewComputeProgramFromPath("./shaders/OutFlow.comp")
-	if err != nil {
-		panic(err)
+	width, height := e.heightmap.Dimensions()
+	minX, minY, maxX, maxY := b.Bounds(cellX, cellY, width, height)
+	if minX >= maxX || minY >= maxY {
+		return
 	}
 
-	e.waterHeightProgram, err = core.NewComputeProgramFromPath("./shaders/WaterHeight.comp")
-	if err != nil {
-		panic(err)
-	}
+	// The brush reads the current textures, so smoothing never sees cells it has already written.
+	gl.MemoryBarrier(gl.FRAMEBUFFER_BARRIER_BIT | gl.TEXTURE_UPDATE_BARRIER_BIT)
+	e.copyNextToCurrent()
+	gl.MemoryBarrier(gl.SHADER_IMAGE_ACCESS_BARRIER_BIT)
 
-	e.velocityProgram, err = core.NewComputeProgramFromPath("./shaders/Velocity.comp")
-	if err != nil {
-		panic(err)
-	}
+	p := e.brushProgram
+	p.Use()
+	p.SetInt("tool", int32(b.Tool))
+	p.SetIVec2("boundsMin", int32(minX), int32(minY))
+	p.SetVec2("centre", mgl32.Vec2{cellX, cellY})
+	p.SetFloat("radius", b.Radius)
+	p.SetFloat("falloff", b.Falloff)
+	p.SetFloat("amount", b.Strength*dt)
+	p.SetFloat("targetHeight", b.Target)
+	p.SetFloat("noiseScale", b.NoiseScale)
+	gl.DispatchCompute(uint32(maxX-minX+15)/16, uint32(maxY-minY+15)/16, 1)
+	gl.MemoryBarrier(gl.SHADER_IMAGE_ACCESS_BARRIER_BIT)
+
+	e.updateSampleTextures()
+}
 
-	e.erosionProgram, err = core.NewComputeProgramFromPath("./shaders/Erosion.comp")
-	if err != nil {
-		panic(err)
+/**
+ * Recomputes the vertex normals of a mesh from the current terrain height,
+ * writing straight into its vertex buffer. Run after each pass so lighting follows the erosion.
+ * cellSize is the world distance between cells, sampleSpacing the number of cells between
+ * vertices and heightScale the height multiplier used when drawing.
+ */
+func (e *GPUEroder) UpdateNormals(mesh *core.Mesh, cellSize, sampleSpacing, heightScale float32) {
+	vertexCount := int32(len(mesh.Vertices) / core.VertexStride)
+	p := e.normalsProgram
+
+	p.Use()
+	p.SetInt("vertexCount", vertexCount)
+	p.SetInt("vertexStride", core.VertexStride)
+	p.SetInt("normalOffset", core.NormalOffset)
+	p.SetInt("sampleCoordOffset", core.SampleCoordOffset)
+	p.SetFloat("cellSize", cellSize)
+	p.SetFloat("heightScale", heightScale)
+	p.SetFloat("sampleSpacing", sampleSpacing)
+
+	gl.ActiveTexture(gl.TEXTURE2)
+	gl.BindTexture(gl.TEXTURE_2D, e.heightSampleTexture)
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 0, mesh.VertexBuffer())
+	gl.DispatchCompute(uint32((vertexCount+63)/64), 1, 1)
+	gl.MemoryBarrier(gl.VERTEX_ATTRIB_ARRAY_BARRIER_BIT)
+	gl.BindBufferBase(gl.SHADER_STORAGE_BUFFER, 0, 0)
+	gl.ActiveTexture(gl.TEXTURE0)
+}
+
+/**
+ * Loads each compute shader in the pipeline.
+ */
+func (e *GPUEroder) loadComputeShaders() error {
+	for _, shader := range []struct {
+		program **core.Program
+		path    string
+	}{
+		{&e.waterPassProgram, "WaterPass.comp"},
+		{&e.outflowProgram, "OutFlow.comp"},
+		{&e.waterHeightProgram, "WaterHeight.comp"},
+		{&e.velocityProgram, "Velocity.comp"},
+		{&e.erosionProgram, "Erosion.comp"},
+		{&e.sedimentProgram, "Sediment.comp"},
+		{&e.normalsProgram, "Normals.comp"},
+		{&e.brushProgram, "Brush.comp"},
+	} {
+		program, err := core.NewComputeProgramFromPath(shader.path)
+		if err != nil {
+			e.DeletePrograms()
+			return err
+		}
+		*shader.program = program
 	}
+	return nil
+}
 
-	e.sedimentProgram, err = core.NewComputeProgramFromPath("./shaders/Sediment.comp")
-	if err != nil {
-		panic(err)
+/**
+ * Deletes the compute programs, for an eroder that's being replaced.
+ */
+func (e *GPUEroder) DeletePrograms() {
+	for _, program := range []**core.Program{
+		&e.waterPassProgram, &e.outflowProgram, &e.waterHeightProgram, &e.velocityProgram,
+		&e.erosionProgram, &e.sedimentProgram, &e.normalsProgram, &e.brushProgram,
+	} {
+		if *program != nil {
+			(*program).Delete()
+			*program = nil
+		}
 	}
+}
 
-	// Init uniform map
-	e.uniforms[e.waterPassProgram] = make(UniformMap)
-	e.uniforms[e.outflowProgram] = make(UniformMap)
-	e.uniforms[e.waterHeightProgram] = make(UniformMap)
-	e.uniforms[e.velocityProgram] = make(UniformMap)
-	e.uniforms[e.erosionProgram] = make(UniformMap)
-	e.uniforms[e.sedimentProgram] = make(UniformMap)
-}
-
-func (e *GPUEroder) initUniformsForProgram(program uint32) {
-	gl.UseProgram(program)
-
-	isRainingUniform := gl.GetUniformLocation(program, gl.Str("isRaining\x00"))
-	waterIncrementRate := gl.GetUniformLocation(program, gl.Str("waterIncrementRate\x00"))
-	gravitationalConstant := gl.GetUniformLocation(program, gl.Str("gravitationalConstant\x00"))
-	pipeCrossSectionalArea := gl.GetUniformLocation(program, gl.Str("pipeCrossSectionalArea\x00"))
-	evaporationRate := gl.GetUniformLocation(program, gl.Str("evaporationRate\x00"))
-	deltaTime := gl.GetUniformLocation(program, gl.Str("deltaTime\x00"))
-	sedimentCarryCapacity := gl.GetUniformLocation(program, gl.Str("sedimentCarryCapacity\x00"))
-	soilSuspensionRate := gl.GetUniformLocation(program, gl.Str("soilSuspensionRate\x00"))
-	soilDepositionRate := gl.GetUniformLocation(program, gl.Str("sedimentDepositionRate\x00"))
-	maximumErodeDepth := gl.GetUniformLocation(program, gl.Str("maximumErodeDepth\x00"))
-
-	e.uniforms[program]["isRaining"] = isRainingUniform
-	e.uniforms[program]["waterIncrementRate"] = waterIncrementRate
-	e.uniforms[program]["gravitationalConstant"] = gravitationalConstant
-	e.uniforms[program]["pipeCrossSectionalArea"] = pipeCrossSectionalArea
-	e.uniforms[program]["evaporationRate"] = evaporationRate
-	e.uniforms[program]["deltaTime"] = deltaTime
-	e.uniforms[program]["sedimentCarryCapacity"] = sedimentCarryCapacity
-	e.uniforms[program]["soilSuspensionRate"] = soilSuspensionRate
-	e.uniforms[program]["soilDepositionRate"] = soilDepositionRate
-	e.uniforms[program]["maximumErodeDepth"] = maximumErodeDepth
-}
-
-func (e *GPUEroder) updateUniformsForProgram(program uint32) {
+/**
+ * Sets the simulation parameters a pass uses, each pass only has some of them.
+ */
+func (e *GPUEroder) updateUniformsForProgram(program *core.Program) {
 	state := e.state
-	
-	gl.UseProgram(program)
-
-	var rainingVal int32 = 0
-	if state.IsRaining {
-		rainingVal = 1
+	for name, value := range map[string]float32{
+		"waterIncrementRate":     state.WaterIncrementRate,
+		"gravitationalConstant":  state.GravitationalConstant,
+		"pipeCrossSectionalArea": state.PipeCrossSectionalArea,
+		"evaporationRate":        state.EvaporationRate,
+		"deltaTime":              state.TimeStep,
+		"sedimentCarryCapacity":  state.SedimentCarryCapacity,
+		"soilSuspensionRate":     state.SoilSuspensionRate,
+		"sedimentDepositionRate": state.SoilDepositionRate,
+		"maximumErodeDepth":      state.MaximalErodeDepth,
+	} {
+		if program.Has(name) {
+			program.SetFloat(name, value)
+		}
+	}
+	if program.Has("isRaining") {
+		program.SetBool("isRaining", state.IsRaining)
 	}
-
-	gl.Uniform1i(e.uniforms[program]["isRaining"], rainingVal)
-	gl.Uniform1fv(e.uniforms[program]["waterIncrementRate"], 1, &state.WaterIncrementRate)
-	gl.Uniform1fv(e.uniforms[program]["gravitationalConstant"], 1, &state.GravitationalConstant)
-	gl.Uniform1fv(e.uniforms[program]["pipeCrossSectionalArea"], 1, &state.PipeCrossSectionalArea)
-	gl.Uniform1fv(e.uniforms[program]["evaporationRate"], 1, &state.EvaporationRate)
-	gl.Uniform1fv(e.uniforms[program]["deltaTime"], 1, &state.TimeStep)
-	gl.Uniform1fv(e.uniforms[program]["sedimentCarryCapacity"], 1, &state.SedimentCarryCapacity)
-	gl.Uniform1fv(e.uniforms[program]["soilSuspensionRate"], 1, &state.SoilSuspensionRate)
-	gl.Uniform1fv(e.uniforms[program]["soilDepositionRate"], 1, &state.SoilDepositionRate)
-	gl.Uniform1fv(e.uniforms[program]["maximumErodeDepth"], 1, &state.MaximalErodeDepth)
 }
 
 func (e *GPUEroder) updateUniforms() {
@@ -413,12 +646,3 @@ func (e *GPUEroder) updateUniforms() {
 	e.updateUniformsForProgram(e.erosionProgram)
 	e.updateUniformsForProgram(e.sedimentProgram)
 }
-
-func (e *GPUEroder) setupUniforms() {
-	e.initUniformsForProgram(e.waterPassProgram)
-	e.initUniformsForProgram(e.outflowProgram)
-	e.initUniformsForProgram(e.waterHeightProgram)
-	e.initUniformsForProgram(e.velocityProgram)
-	e.initUniformsForProgram(e.erosionProgram)
-	e.initUniformsForProgram(e.sedimentProgram)
-}
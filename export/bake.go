@@ -0,0 +1,203 @@
+package export
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+/**
+ * Settings shared by the texture bakers.
+ *
+ * ZFactor is height units per cell, as for the relief map.
+ * FlipGreen writes normals with green pointing south (DirectX), rather than north (OpenGL).
+ * AORadius is how far out, in cells, terrain can shade a cell, searched along AODirections directions.
+ * CurvatureRadius is the size in cells of the features the curvature picks out.
+ */
+type BakeOptions struct {
+	ZFactor         float32
+	FlipGreen       bool
+	AORadius        float32
+	AODirections    int
+	CurvatureRadius float32
+	Normals, AO     bool
+	Curvature       bool
+}
+
+func DefaultBakeOptions() BakeOptions {
+	return BakeOptions{
+		ZFactor:         100,
+		AORadius:        32,
+		AODirections:    16,
+		CurvatureRadius: 4,
+		Normals:         true,
+		AO:              true,
+		Curvature:       true,
+	}
+}
+
+/**
+ * Tangent-space normal map of the heightmap as a flat surface, red east and blue up.
+ */
+func BakeNormals(h *heightmap.Heightmap, opts BakeOptions) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, h.Width, h.Height))
+	green := float32(1)
+	if opts.FlipGreen {
+		green = -1
+	}
+	forRows(h.Height, func(y int) {
+		for x := 0; x < h.Width; x++ {
+			dx, dy := h.Gradient(x, y)
+			// Image y runs south, so a surface rising southwards tilts the normal north (+green).
+			nx, ny, nz := -dx*opts.ZFactor, dy*opts.ZFactor*green, float32(1)
+			length := float32(math.Sqrt(float64(nx*nx + ny*ny + nz*nz)))
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: toUint8(nx/length*0.5 + 0.5),
+				G: toUint8(ny/length*0.5 + 0.5),
+				B: toUint8(nz/length*0.5 + 0.5),
+				A: 255,
+			})
+		}
+	})
+	return img
+}
+
+/**
+ * Horizon based ambient occlusion, 1 where the whole sky is visible.
+ * The highest horizon along each direction blocks the light below it.
+ */
+func BakeAO(h *heightmap.Heightmap, opts BakeOptions) *heightmap.Heightmap {
+	ao := heightmap.New(h.Width, h.Height)
+	directions := opts.AODirections
+	if directions < 1 {
+		directions = 1
+	}
+	steps := int(math.Ceil(float64(opts.AORadius)))
+	if steps < 1 {
+		steps = 1
+	}
+	dirX := make([]float32, directions)
+	dirY := make([]float32, directions)
+	for i := range dirX {
+		angle := 2 * math.Pi * float64(i) / float64(directions)
+		dirX[i], dirY[i] = float32(math.Cos(angle)), float32(math.Sin(angle))
+	}
+
+	forRows(h.Height, func(y int) {
+		for x := 0; x < h.Width; x++ {
+			centre := h.At(x, y) * opts.ZFactor
+			var occlusion float64
+			for i := range dirX {
+				// Sine of the elevation of the highest point seen, starting level with the horizon.
+				var horizon float64
+				for step := 1; step <= steps; step++ {
+					distance := float32(step) * opts.AORadius / float32(steps)
+					fx, fy := float32(x)+dirX[i]*distance, float32(y)+dirY[i]*distance
+					if fx < 0 || fy < 0 || fx > float32(h.Width-1) || fy > float32(h.Height-1) {
+						break
+					}
+					rise := float64(h.Sample(fx, fy)*opts.ZFactor - centre)
+					if rise <= 0 {
+						continue
+					}
+					if sine := rise / math.Sqrt(rise*rise+float64(distance*distance)); sine > horizon {
+						horizon = sine
+					}
+				}
+				occlusion += horizon
+			}
+			ao.Set(x, y, float32(1-occlusion/float64(directions)))
+		}
+	})
+	return ao
+}
+
+/**
+ * How much higher (convex) or lower (concave) each cell is than the ring CurvatureRadius cells around it,
+ * mapped so 0.5 is flat and the strongest curvature on the map reaches 0 or 1.
+ */
+func BakeCurvature(h *heightmap.Heightmap, opts BakeOptions) *heightmap.Heightmap {
+	curvature := heightmap.New(h.Width, h.Height)
+	radius := opts.CurvatureRadius
+	if radius < 1 {
+		radius = 1
+	}
+	const samples = 8
+	forRows(h.Height, func(y int) {
+		for x := 0; x < h.Width; x++ {
+			var ring float32
+			for i := 0; i < samples; i++ {
+				angle := 2 * math.Pi * float64(i) / samples
+				ring += h.Sample(float32(x)+radius*float32(math.Cos(angle)), float32(y)+radius*float32(math.Sin(angle)))
+			}
+			curvature.Set(x, y, h.At(x, y)-ring/samples)
+		}
+	})
+
+	var largest float32
+	for _, value := range curvature.Data {
+		if a := float32(math.Abs(float64(value))); a > largest {
+			largest = a
+		}
+	}
+	if largest == 0 {
+		largest = 1
+	}
+	for i, value := range curvature.Data {
+		curvature.Data[i] = 0.5 + 0.5*value/largest
+	}
+	return curvature
+}
+
+/**
+ * Runs fn for every row, split over the available CPUs.
+ */
+func forRows(rows int, fn func(y int)) {
+	workers := runtime.NumCPU()
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(first int) {
+			defer wg.Done()
+			for y := first; y < rows; y += workers {
+				fn(y)
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+/**
+ * Bakes the maps selected in opts and writes them as PNGs named `<prefix>_normal`, `<prefix>_ao`
+ * and `<prefix>_curvature`. AO and curvature are 16-bit greyscale. Returns the paths that were written.
+ */
+func WriteBakes(prefix string, h *heightmap.Heightmap, opts BakeOptions) ([]string, error) {
+	var written []string
+	if opts.Normals {
+		path := prefix + "_normal.png"
+		if err := writePNG(path, BakeNormals(h, opts)); err != nil {
+			return written, fmt.Errorf("writing normal map: %v", err)
+		}
+		written = append(written, path)
+	}
+	if opts.AO {
+		path := prefix + "_ao.png"
+		if err := WritePNG16(path, BakeAO(h, opts)); err != nil {
+			return written, fmt.Errorf("writing ambient occlusion: %v", err)
+		}
+		written = append(written, path)
+	}
+	if opts.Curvature {
+		path := prefix + "_curvature.png"
+		if err := WritePNG16(path, BakeCurvature(h, opts)); err != nil {
+			return written, fmt.Errorf("writing curvature: %v", err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
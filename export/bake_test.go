@@ -0,0 +1,133 @@
+package export
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+func TestBakeNormals(t *testing.T) {
+	tests := []struct {
+		name      string
+		h         *heightmap.Heightmap
+		flipGreen bool
+		want      [3]uint8
+	}{
+		{"flat", flat(5, 5, 0.5), false, [3]uint8{128, 128, 255}},
+		// 45 degree slopes, the normal leans back away from the way they rise.
+		{"rising east", filled(5, 5, func(x, y int) float32 { return float32(x) * 0.01 }), false, [3]uint8{37, 128, 218}},
+		{"rising south", filled(5, 5, func(x, y int) float32 { return float32(y) * 0.01 }), false, [3]uint8{128, 218, 218}},
+		{"rising south, green flipped", filled(5, 5, func(x, y int) float32 { return float32(y) * 0.01 }), true, [3]uint8{128, 37, 218}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := BakeNormals(test.h, BakeOptions{ZFactor: 100, FlipGreen: test.flipGreen}).NRGBAAt(2, 2)
+			if got := [3]uint8{c.R, c.G, c.B}; got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+// A 9x9 map with the middle cell raised to `centre`, 1 for a peak and -1 for a pit.
+func spike(centre float32) *heightmap.Heightmap {
+	return filled(9, 9, func(x, y int) float32 {
+		if x == 4 && y == 4 {
+			return centre
+		}
+		return 0
+	})
+}
+
+func TestBakeAO(t *testing.T) {
+	opts := BakeOptions{ZFactor: 1, AORadius: 3, AODirections: 8}
+	tests := []struct {
+		name     string
+		h        *heightmap.Heightmap
+		occluded bool
+	}{
+		{"flat", flat(9, 9, 0.5), false},
+		{"peak", spike(1), false},
+		{"pit", spike(-1), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ao := BakeAO(test.h, opts)
+			if got := ao.At(4, 4); (got < 1) != test.occluded || got < 0 {
+				t.Errorf("middle got %v, want occluded %v", got, test.occluded)
+			}
+			// Away from the middle nothing rises above the horizon.
+			if got := ao.At(0, 8); got != 1 {
+				t.Errorf("corner got %v, want 1", got)
+			}
+		})
+	}
+}
+
+func TestBakeCurvature(t *testing.T) {
+	opts := BakeOptions{CurvatureRadius: 1}
+	tests := []struct {
+		name           string
+		h              *heightmap.Heightmap
+		middle, corner float32
+	}{
+		{"flat", flat(9, 9, 0.5), 0.5, 0.5},
+		// The strongest curvature on the map is scaled to reach 0 or 1.
+		{"peak", spike(1), 1, 0.5},
+		{"pit", spike(-1), 0, 0.5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			curvature := BakeCurvature(test.h, opts)
+			if got := curvature.At(4, 4); got != test.middle {
+				t.Errorf("middle got %v, want %v", got, test.middle)
+			}
+			if got := curvature.At(0, 8); got != test.corner {
+				t.Errorf("corner got %v, want %v", got, test.corner)
+			}
+		})
+	}
+}
+
+func TestWriteBakes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name                   string
+		normals, ao, curvature bool
+		want                   []string
+	}{
+		{"all", true, true, true, []string{"all_normal.png", "all_ao.png", "all_curvature.png"}},
+		{"normals", true, false, false, []string{"normals_normal.png"}},
+		{"ao and curvature", false, true, true, []string{"ao and curvature_ao.png", "ao and curvature_curvature.png"}},
+		{"none", false, false, false, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := DefaultBakeOptions()
+			opts.Normals, opts.AO, opts.Curvature = test.normals, test.ao, test.curvature
+			written, err := WriteBakes(filepath.Join(dir, test.name), spike(1), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(written) != len(test.want) {
+				t.Fatalf("wrote %v, want %v", written, test.want)
+			}
+			for i, path := range written {
+				if path != filepath.Join(dir, test.want[i]) {
+					t.Errorf("wrote %s, want %s", filepath.Base(path), test.want[i])
+				}
+				if _, err := os.Stat(path); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
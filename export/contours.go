@@ -0,0 +1,190 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+type ContourFormat int
+
+const (
+	ContourFormatSVG ContourFormat = iota
+	ContourFormatGeoJSON
+)
+
+var ContourFormatNames = []string{"SVG", "GeoJSON"}
+
+var contourExtensions = []string{".svg", ".geojson"}
+
+func (f ContourFormat) Extension() string {
+	return contourExtensions[f]
+}
+
+// Index contours shorter than this many points aren't labelled, the label would hide them.
+const minLabelledPoints = 24
+
+/**
+ * Writes contours traced from `h` to `path` in the given format.
+ * The file extension is appended if `path` doesn't already have it.
+ */
+func WriteContours(path string, format ContourFormat, h *heightmap.Heightmap, contours []heightmap.Contour) (string, error) {
+	if !strings.HasSuffix(path, format.Extension()) {
+		path += format.Extension()
+	}
+	var err error
+	switch format {
+	case ContourFormatSVG:
+		err = WriteContoursSVG(path, h, contours)
+	case ContourFormatGeoJSON:
+		err = WriteContoursGeoJSON(path, h, contours)
+	default:
+		err = fmt.Errorf("unknown contour format %d", format)
+	}
+	return path, err
+}
+
+/**
+ * Elevation of a contour for labels and properties, in real units when the heightmap is georeferenced.
+ */
+func contourElevation(h *heightmap.Heightmap, level float32) float64 {
+	if h.Geo != nil {
+		return h.Geo.Elevation(level)
+	}
+	return float64(level)
+}
+
+/**
+ * A topographic map with one unit per cell, north up. Index contours are drawn heavier
+ * and labelled with their elevation halfway along, turned to follow the line.
+ */
+func WriteContoursSVG(path string, h *heightmap.Heightmap, contours []heightmap.Contour) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+
+	// The scale is relative to the map so the lines look the same whatever its resolution.
+	size := math.Max(float64(h.Width), float64(h.Height))
+	thin, thick, font := size/1000, size/400, size/80
+
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" viewBox=\"0 0 %d %d\" width=\"%d\" height=\"%d\">\n",
+		h.Width-1, h.Height-1, h.Width-1, h.Height-1)
+	fmt.Fprintf(w, "<rect width=\"100%%\" height=\"100%%\" fill=\"#ffffff\"/>\n")
+	fmt.Fprintf(w, "<g fill=\"none\" stroke=\"#8c5a2b\" stroke-linejoin=\"round\" stroke-linecap=\"round\">\n")
+	for _, c := range contours {
+		width := thin
+		if c.Index {
+			width = thick
+		}
+		fmt.Fprintf(w, "<polyline stroke-width=\"%.3g\" points=\"", width)
+		for i, p := range c.Points {
+			if i > 0 {
+				w.WriteByte(' ')
+			}
+			fmt.Fprintf(w, "%.2f,%.2f", p.X, p.Y)
+		}
+		fmt.Fprintf(w, "\"/>\n")
+	}
+	fmt.Fprintf(w, "</g>\n")
+
+	fmt.Fprintf(w, "<g font-family=\"sans-serif\" font-size=\"%.3g\" fill=\"#8c5a2b\" text-anchor=\"middle\" dominant-baseline=\"middle\""+
+		" stroke=\"#ffffff\" stroke-width=\"%.3g\" paint-order=\"stroke\">\n", font, font/4)
+	for _, c := range contours {
+		if !c.Index || len(c.Points) < minLabelledPoints {
+			continue
+		}
+		middle := len(c.Points) / 2
+		a, b := c.Points[middle-1], c.Points[middle+1]
+		angle := math.Atan2(float64(b.Y-a.Y), float64(b.X-a.X)) * 180 / math.Pi
+		// Keep the text the right way up.
+		if angle > 90 {
+			angle -= 180
+		} else if angle < -90 {
+			angle += 180
+		}
+		p := c.Points[middle]
+		fmt.Fprintf(w, "<text transform=\"translate(%.2f,%.2f) rotate(%.1f)\">%s</text>\n",
+			p.X, p.Y, angle, formatElevation(contourElevation(h, c.Level)))
+	}
+	fmt.Fprintf(w, "</g>\n</svg>\n")
+
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func formatElevation(value float64) string {
+	if math.Abs(value) >= 10 {
+		return fmt.Sprintf("%.0f", value)
+	}
+	return fmt.Sprintf("%.3g", value)
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string       `json:"type"`
+	Coordinates [][2]float64 `json:"coordinates"`
+}
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+/**
+ * A LineString feature per contour, with `elevation` and `index` properties.
+ * Coordinates are those of the heightmap's georeference, or cells (north up) when it has none.
+ */
+func WriteContoursGeoJSON(path string, h *heightmap.Heightmap, contours []heightmap.Contour) error {
+	geo := h.Geo
+	if geo == nil {
+		geo = heightmap.DefaultGeoreference()
+	}
+	var collection = geoJSONFeatureCollection{Type: "FeatureCollection", Features: make([]geoJSONFeature, 0, len(contours))}
+	for _, c := range contours {
+		coordinates := make([][2]float64, len(c.Points))
+		for i, p := range c.Points {
+			// The georeference origin is the corner of cell (0, 0), contour points are on cell centres.
+			coordinates[i] = [2]float64{
+				geo.OriginX + (float64(p.X)+0.5)*geo.CellSizeX,
+				geo.OriginY - (float64(p.Y)+0.5)*geo.CellSizeY,
+			}
+		}
+		collection.Features = append(collection.Features, geoJSONFeature{
+			Type:     "Feature",
+			Geometry: geoJSONGeometry{Type: "LineString", Coordinates: coordinates},
+			Properties: map[string]interface{}{
+				"elevation": contourElevation(h, c.Level),
+				"index":     c.Index,
+			},
+		})
+	}
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
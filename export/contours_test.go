@@ -0,0 +1,166 @@
+package export
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+func line(points int, level float32, index bool) heightmap.Contour {
+	c := heightmap.Contour{Level: level, Index: index}
+	for i := 0; i < points; i++ {
+		c.Points = append(c.Points, heightmap.Point{X: float32(i), Y: 1})
+	}
+	return c
+}
+
+func TestWriteContoursExtension(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contours")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		format     ContourFormat
+		path, want string
+	}{
+		{ContourFormatSVG, "map", "map.svg"},
+		{ContourFormatSVG, "map.svg", "map.svg"},
+		{ContourFormatGeoJSON, "map", "map.geojson"},
+		{ContourFormatGeoJSON, "map.json", "map.json.geojson"},
+	}
+	h := flat(4, 4, 0)
+	for _, test := range tests {
+		path, err := WriteContours(filepath.Join(dir, test.path), test.format, h, []heightmap.Contour{line(2, 0, false)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != filepath.Join(dir, test.want) {
+			t.Errorf("%s as %s wrote %s, want %s", test.path, ContourFormatNames[test.format], filepath.Base(path), test.want)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestContoursGeoJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contours")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name string
+		geo  *heightmap.Georeference
+		// Where cell (0, 1) lands, and the elevation of level 0.5.
+		first     [2]float64
+		elevation float64
+	}{
+		{"cells", nil, [2]float64{0.5, -1.5}, 0.5},
+		{"georeferenced", &heightmap.Georeference{
+			OriginX: 1000, OriginY: 2000, CellSizeX: 10, CellSizeY: 20, ZScale: 100, ZOffset: -10,
+		}, [2]float64{1005, 1970}, 40},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := flat(4, 4, 0)
+			h.Geo = test.geo
+			path := filepath.Join(dir, test.name+".geojson")
+			if err := WriteContoursGeoJSON(path, h, []heightmap.Contour{line(3, 0.5, true), line(2, 0.25, false)}); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var collection geoJSONFeatureCollection
+			if err := json.Unmarshal(data, &collection); err != nil {
+				t.Fatal(err)
+			}
+			if collection.Type != "FeatureCollection" || len(collection.Features) != 2 {
+				t.Fatalf("got a %s of %d features, want a FeatureCollection of 2", collection.Type, len(collection.Features))
+			}
+			feature := collection.Features[0]
+			if feature.Geometry.Type != "LineString" || len(feature.Geometry.Coordinates) != 3 {
+				t.Fatalf("got a %s of %d points, want a LineString of 3", feature.Geometry.Type, len(feature.Geometry.Coordinates))
+			}
+			if got := feature.Geometry.Coordinates[0]; got != test.first {
+				t.Errorf("first point at %v, want %v", got, test.first)
+			}
+			if got := feature.Properties["elevation"]; got != test.elevation {
+				t.Errorf("elevation %v, want %v", got, test.elevation)
+			}
+			if feature.Properties["index"] != true || collection.Features[1].Properties["index"] != false {
+				t.Errorf("index properties %v and %v, want true and false",
+					feature.Properties["index"], collection.Features[1].Properties["index"])
+			}
+		})
+	}
+}
+
+func TestContoursSVG(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contours")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		contours []heightmap.Contour
+		lines    int
+		labels   []string
+	}{
+		{"none", nil, 0, nil},
+		{"labelled index", []heightmap.Contour{line(minLabelledPoints, 0.5, true)}, 1, []string{"0.5"}},
+		{"index too short to label", []heightmap.Contour{line(minLabelledPoints-1, 0.5, true)}, 1, nil},
+		{"plain contours aren't labelled", []heightmap.Contour{line(minLabelledPoints, 0.5, false), line(2, 0.25, false)}, 2, nil},
+		{"large elevations are rounded", []heightmap.Contour{line(minLabelledPoints, 123.4, true)}, 1, []string{"123"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "map.svg")
+			if err := WriteContoursSVG(path, flat(32, 32, 0), test.contours); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var svg struct {
+				Groups []struct {
+					Lines []struct {
+						Points string `xml:"points,attr"`
+					} `xml:"polyline"`
+					Labels []string `xml:"text"`
+				} `xml:"g"`
+			}
+			if err := xml.Unmarshal(data, &svg); err != nil {
+				t.Fatal(err)
+			}
+			if len(svg.Groups) != 2 {
+				t.Fatalf("got %d groups, want lines and labels", len(svg.Groups))
+			}
+			if got := len(svg.Groups[0].Lines); got != test.lines {
+				t.Errorf("got %d lines, want %d", got, test.lines)
+			}
+			labels := svg.Groups[1].Labels
+			if len(labels) != len(test.labels) {
+				t.Fatalf("got labels %v, want %v", labels, test.labels)
+			}
+			for i := range labels {
+				if labels[i] != test.labels[i] {
+					t.Errorf("got labels %v, want %v", labels, test.labels)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+)
+
+// glTF 2.0 enums, see https://github.com/KhronosGroup/glTF/tree/master/specification/2.0
+const (
+	gltfFloat        = 5126
+	gltfUnsignedInt  = 5125
+	gltfArrayBuffer  = 34962
+	gltfElementArray = 34963
+	gltfTriangles    = 4
+
+	glbMagic     = 0x46546C67 // "glTF"
+	glbChunkJSON = 0x4E4F534A // "JSON"
+	glbChunkBIN  = 0x004E4942 // "BIN\0"
+)
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float32 `json:"min,omitempty"`
+	Max           []float32 `json:"max,omitempty"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    int            `json:"indices"`
+	Mode       int            `json:"mode"`
+}
+
+type gltfMesh struct {
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfNode struct {
+	Mesh int    `json:"mesh"`
+	Name string `json:"name"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type gltfBuffer struct {
+	ByteLength int `json:"byteLength"`
+}
+
+type gltfAsset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator"`
+}
+
+type gltfDocument struct {
+	Asset       gltfAsset        `json:"asset"`
+	Scene       int              `json:"scene"`
+	Scenes      []gltfScene      `json:"scenes"`
+	Nodes       []gltfNode       `json:"nodes"`
+	Meshes      []gltfMesh       `json:"meshes"`
+	Buffers     []gltfBuffer     `json:"buffers"`
+	BufferViews []gltfBufferView `json:"bufferViews"`
+	Accessors   []gltfAccessor   `json:"accessors"`
+}
+
+/**
+ * Binary glTF (.glb) with a single mesh, node and scene.
+ * Every attribute gets its own tightly packed buffer view.
+ */
+func writeGLB(w io.Writer, mesh *Mesh) error {
+	var doc = gltfDocument{Asset: gltfAsset{Version: "2.0", Generator: "Terrain"}}
+
+	var bin bytes.Buffer
+	addView := func(data interface{}, target int) (int, error) {
+		offset := bin.Len()
+		if err := binary.Write(&bin, binary.LittleEndian, data); err != nil {
+			return 0, err
+		}
+		doc.BufferViews = append(doc.BufferViews, gltfBufferView{
+			Buffer:     0,
+			ByteOffset: offset,
+			ByteLength: bin.Len() - offset,
+			Target:     target,
+		})
+		return len(doc.BufferViews) - 1, nil
+	}
+	addAccessor := func(view, componentType, count int, kind string) int {
+		doc.Accessors = append(doc.Accessors, gltfAccessor{
+			BufferView:    view,
+			ComponentType: componentType,
+			Count:         count,
+			Type:          kind,
+		})
+		return len(doc.Accessors) - 1
+	}
+
+	primitive := gltfPrimitive{Attributes: map[string]int{}, Mode: gltfTriangles}
+
+	view, err := addView(mesh.Positions, gltfArrayBuffer)
+	if err != nil {
+		return err
+	}
+	position := addAccessor(view, gltfFloat, len(mesh.Positions), "VEC3")
+	min, max := mesh.Bounds()
+	doc.Accessors[position].Min = min[:]
+	doc.Accessors[position].Max = max[:]
+	primitive.Attributes["POSITION"] = position
+
+	if len(mesh.Normals) > 0 {
+		view, err := addView(mesh.Normals, gltfArrayBuffer)
+		if err != nil {
+			return err
+		}
+		primitive.Attributes["NORMAL"] = addAccessor(view, gltfFloat, len(mesh.Normals), "VEC3")
+	}
+	if len(mesh.UVs) > 0 {
+		view, err := addView(mesh.UVs, gltfArrayBuffer)
+		if err != nil {
+			return err
+		}
+		primitive.Attributes["TEXCOORD_0"] = addAccessor(view, gltfFloat, len(mesh.UVs), "VEC2")
+	}
+
+	view, err = addView(mesh.Indices, gltfElementArray)
+	if err != nil {
+		return err
+	}
+	primitive.Indices = addAccessor(view, gltfUnsignedInt, len(mesh.Indices), "SCALAR")
+
+	doc.Meshes = []gltfMesh{{Primitives: []gltfPrimitive{primitive}}}
+	doc.Nodes = []gltfNode{{Mesh: 0, Name: "Terrain"}}
+	doc.Scenes = []gltfScene{{Nodes: []int{0}}}
+	doc.Buffers = []gltfBuffer{{ByteLength: bin.Len()}}
+
+	jsonChunk, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	// Chunks must be 4 byte aligned, JSON is padded with spaces and binary data with zeros.
+	for len(jsonChunk)%4 != 0 {
+		jsonChunk = append(jsonChunk, ' ')
+	}
+	for bin.Len()%4 != 0 {
+		bin.WriteByte(0)
+	}
+
+	totalLength := 12 + 8 + len(jsonChunk) + 8 + bin.Len()
+	header := []uint32{
+		glbMagic, 2, uint32(totalLength),
+		uint32(len(jsonChunk)), glbChunkJSON,
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	if _, err := w.Write(jsonChunk); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, []uint32{uint32(bin.Len()), glbChunkBIN}); err != nil {
+		return err
+	}
+	_, err = w.Write(bin.Bytes())
+	return err
+}
@@ -0,0 +1,181 @@
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+type Format int
+
+const (
+	FormatPNG16 Format = iota
+	FormatRAW16
+	FormatRAW32F
+	FormatPFM
+)
+
+var FormatNames = []string{"PNG (16-bit)", "RAW (R16)", "RAW (R32F)", "PFM"}
+
+var formatExtensions = []string{".png", ".r16", ".r32", ".pfm"}
+
+func (f Format) Extension() string {
+	return formatExtensions[f]
+}
+
+/**
+ * Normalise remaps the heightmap from [Min, Max] to [0, 1] before writing.
+ * When Min == Max the range of the data itself is used.
+ * Integer formats always clamp to [0, 1], so un-normalised values outside that range are lost.
+ */
+type Options struct {
+	Normalise bool
+	Min, Max  float32
+}
+
+func (o Options) apply(h *heightmap.Heightmap) *heightmap.Heightmap {
+	if !o.Normalise {
+		return h
+	}
+	min, max := o.Min, o.Max
+	if min == max {
+		min, max = h.Range()
+	}
+	return h.Normalised(min, max)
+}
+
+/**
+ * Writes the heightmap to `path` in the given format.
+ * The file extension is appended if `path` doesn't already have it.
+ */
+func WriteHeightmap(path string, format Format, h *heightmap.Heightmap, opts Options) (string, error) {
+	if !strings.HasSuffix(path, format.Extension()) {
+		path += format.Extension()
+	}
+	h = opts.apply(h)
+
+	var err error
+	switch format {
+	case FormatPNG16:
+		err = WritePNG16(path, h)
+	case FormatRAW16:
+		err = WriteRAW16(path, h)
+	case FormatRAW32F:
+		err = WriteRAW32F(path, h)
+	case FormatPFM:
+		err = WritePFM(path, h)
+	default:
+		err = fmt.Errorf("unknown export format %d", format)
+	}
+	return path, err
+}
+
+func toUint16(value float32) uint16 {
+	return uint16(math.Round(float64(heightmap.Clamp(value, 0, 1)) * math.MaxUint16))
+}
+
+/**
+ * 16-bit greyscale PNG, values clamped to [0, 1].
+ */
+func WritePNG16(path string, h *heightmap.Heightmap) error {
+	img := image.NewGray16(image.Rect(0, 0, h.Width, h.Height))
+	for y := 0; y < h.Height; y++ {
+		for x := 0; x < h.Width; x++ {
+			img.SetGray16(x, y, color.Gray16{Y: toUint16(h.At(x, y))})
+		}
+	}
+	return writePNG(path, img)
+}
+
+func writePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+/**
+ * Headerless little-endian unsigned 16-bit samples, values clamped to [0, 1].
+ */
+func WriteRAW16(path string, h *heightmap.Heightmap) error {
+	data := make([]uint16, len(h.Data))
+	for i, v := range h.Data {
+		data[i] = toUint16(v)
+	}
+	return writeBinary(path, "", data)
+}
+
+/**
+ * Headerless little-endian 32-bit floats.
+ */
+func WriteRAW32F(path string, h *heightmap.Heightmap) error {
+	return writeBinary(path, "", h.Data)
+}
+
+/**
+ * Portable Float Map. Rows are stored bottom to top, a negative scale marks little-endian data.
+ */
+func WritePFM(path string, h *heightmap.Heightmap) error {
+	return writePFM(path, h)
+}
+
+/**
+ * Writes one or three channel PFM files depending on the number of maps passed.
+ */
+func writePFM(path string, channels ...*heightmap.Heightmap) error {
+	var magic string
+	switch len(channels) {
+	case 1:
+		magic = "Pf"
+	case 3:
+		magic = "PF"
+	default:
+		return fmt.Errorf("pfm supports 1 or 3 channels, got %d", len(channels))
+	}
+	width, height := channels[0].Width, channels[0].Height
+
+	data := make([]float32, 0, width*height*len(channels))
+	for y := height - 1; y >= 0; y-- {
+		for x := 0; x < width; x++ {
+			for _, c := range channels {
+				data = append(data, c.At(x, y))
+			}
+		}
+	}
+	header := fmt.Sprintf("%s\n%d %d\n-1.0\n", magic, width, height)
+	return writeBinary(path, header, data)
+}
+
+func writeBinary(path, header string, data interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if _, err := w.WriteString(header); err != nil {
+		file.Close()
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
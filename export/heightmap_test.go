@@ -0,0 +1,189 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+func readPNG16(t *testing.T, path string, width, height int) []float32 {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray, ok := img.(*image.Gray16)
+	if !ok {
+		t.Fatalf("got a %T, want 16-bit greyscale", img)
+	}
+	if size := gray.Bounds().Size(); size.X != width || size.Y != height {
+		t.Fatalf("image is %v, want %dx%d", size, width, height)
+	}
+	values := make([]float32, 0, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			values = append(values, float32(gray.Gray16At(x, y).Y)/math.MaxUint16)
+		}
+	}
+	return values
+}
+
+func readRAW16(t *testing.T, path string, width, height int) []float32 {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != width*height*2 {
+		t.Fatalf("%d bytes, want %d", len(data), width*height*2)
+	}
+	values := make([]float32, width*height)
+	for i := range values {
+		values[i] = float32(binary.LittleEndian.Uint16(data[i*2:])) / math.MaxUint16
+	}
+	return values
+}
+
+func readRAW32F(t *testing.T, path string, width, height int) []float32 {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make([]float32, width*height)
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, values); err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+/**
+ * Reads a PFM into rows from top to bottom, with the channels of each cell together.
+ */
+func readPFM(t *testing.T, path string, width, height, channels int) []float32 {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var magic string
+	var w, h int
+	var scale float64
+	reader := bytes.NewReader(data)
+	if _, err := fmt.Fscanf(reader, "%s\n%d %d\n%f\n", &magic, &w, &h, &scale); err != nil {
+		t.Fatal(err)
+	}
+	if wantMagic := map[int]string{1: "Pf", 3: "PF"}[channels]; magic != wantMagic || w != width || h != height {
+		t.Fatalf("header %s %dx%d, want %s %dx%d", magic, w, h, wantMagic, width, height)
+	}
+	// A negative scale is little endian.
+	if scale >= 0 {
+		t.Fatalf("scale %v, want negative for little endian data", scale)
+	}
+	stored := make([]float32, width*height*channels)
+	if err := binary.Read(reader, binary.LittleEndian, stored); err != nil {
+		t.Fatal(err)
+	}
+	if reader.Len() != 0 {
+		t.Fatalf("%d bytes left over", reader.Len())
+	}
+	row := width * channels
+	values := make([]float32, 0, len(stored))
+	for y := height - 1; y >= 0; y-- {
+		values = append(values, stored[y*row:(y+1)*row]...)
+	}
+	return values
+}
+
+func TestWriteHeightmapRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heightmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Different on every cell, so flipped or transposed rows show up.
+	inRange := filled(4, 3, func(x, y int) float32 { return float32(x+y*4) / 11 })
+	outOfRange := filled(4, 3, func(x, y int) float32 { return float32(x+y*4)*25 - 100 })
+	const step = 1.0 / math.MaxUint16
+
+	tests := []struct {
+		name   string
+		format Format
+		h      *heightmap.Heightmap
+		opts   Options
+		read   func(t *testing.T, path string, width, height int) []float32
+		// Expected value of cell i, and how far off it may be.
+		want      func(i int) float32
+		tolerance float32
+	}{
+		{"png16", FormatPNG16, inRange, Options{}, readPNG16,
+			func(i int) float32 { return float32(i) / 11 }, step / 2},
+		{"raw16", FormatRAW16, inRange, Options{}, readRAW16,
+			func(i int) float32 { return float32(i) / 11 }, step / 2},
+		{"raw32f", FormatRAW32F, outOfRange, Options{}, readRAW32F,
+			func(i int) float32 { return float32(i)*25 - 100 }, 0},
+		{"pfm", FormatPFM, outOfRange, Options{}, func(t *testing.T, path string, width, height int) []float32 {
+			return readPFM(t, path, width, height, 1)
+		}, func(i int) float32 { return float32(i)*25 - 100 }, 0},
+		// Integer formats clamp anything outside [0, 1].
+		{"raw16 clamped", FormatRAW16, outOfRange, Options{}, readRAW16,
+			func(i int) float32 { return heightmap.Clamp(float32(i)*25-100, 0, 1) }, 0},
+		{"normalised to the data", FormatRAW32F, outOfRange, Options{Normalise: true}, readRAW32F,
+			func(i int) float32 { return float32(i) / 11 }, 1e-6},
+		{"normalised to a range", FormatRAW32F, outOfRange, Options{Normalise: true, Min: -100, Max: 0}, readRAW32F,
+			func(i int) float32 { return heightmap.Clamp(float32(i)*0.25, 0, 1) }, 1e-6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, err := WriteHeightmap(filepath.Join(dir, test.name), test.format, test.h, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if filepath.Ext(path) != test.format.Extension() {
+				t.Errorf("wrote %s, want the %s extension", path, test.format.Extension())
+			}
+			for i, got := range test.read(t, path, test.h.Width, test.h.Height) {
+				if want := test.want(i); math.Abs(float64(got-want)) > float64(test.tolerance) {
+					t.Errorf("cell %d is %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWritePFMChannels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heightmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	red := filled(3, 2, func(x, y int) float32 { return float32(x + y*3) })
+	green := filled(3, 2, func(x, y int) float32 { return -float32(x + y*3) })
+	blue := flat(3, 2, 0.5)
+	path := filepath.Join(dir, "colour.pfm")
+	if err := writePFM(path, red, green, blue); err != nil {
+		t.Fatal(err)
+	}
+	values := readPFM(t, path, 3, 2, 3)
+	for i := 0; i < 6; i++ {
+		if got := values[i*3 : i*3+3]; got[0] != float32(i) || got[1] != -float32(i) || got[2] != 0.5 {
+			t.Errorf("cell %d is %v, want [%d %d 0.5]", i, got, i, -i)
+		}
+	}
+
+	if err := writePFM(path, red, green); err == nil {
+		t.Errorf("wrote a two channel PFM, want an error")
+	}
+}
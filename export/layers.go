@@ -0,0 +1,156 @@
+package export
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/ob6160/Terrain/erosion"
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+/**
+ * A named group of channels written to a single image where the format allows it.
+ * Signed layers are centred so that 0.5 means zero in the integer formats.
+ */
+type layer struct {
+	name     string
+	channels []*heightmap.Heightmap
+	suffixes []string
+	signed   bool
+}
+
+func layersOf(l *erosion.Layers) []layer {
+	return []layer{
+		{name: "water", channels: []*heightmap.Heightmap{l.Water}},
+		{name: "sediment", channels: []*heightmap.Heightmap{l.Sediment}},
+		{
+			name:     "flow",
+			channels: []*heightmap.Heightmap{l.VelocityX, l.VelocityY},
+			suffixes: []string{"x", "y"},
+			signed:   true,
+		},
+		{
+			name:     "outflow",
+			channels: l.Outflow[:],
+			suffixes: []string{"left", "right", "top", "bottom"},
+		},
+		{name: "delta", channels: []*heightmap.Heightmap{l.Delta}, signed: true},
+	}
+}
+
+/**
+ * Writes water height, suspended sediment, flow (velocity), outflow and erosion delta
+ * as individual images named `<prefix>_<layer>`.
+ *
+ * PNG16 packs layers of up to three channels into one RGB image, normalised per layer.
+ * Outflow has four pipes and alpha would hide the cells without bottom outflow,
+ * so it's written one greyscale image per pipe, still sharing the layer's range.
+ * PFM packs the flow map into an RGB image with an empty blue channel.
+ * Anything that can't be packed is split into one file per channel.
+ * Returns the paths that were written.
+ */
+func WriteLayers(prefix string, format Format, layers *erosion.Layers) ([]string, error) {
+	var written []string
+	for _, l := range layersOf(layers) {
+		paths, err := writeLayer(prefix+"_"+l.name, format, l)
+		written = append(written, paths...)
+		if err != nil {
+			return written, fmt.Errorf("writing %s layer: %v", l.name, err)
+		}
+	}
+	return written, nil
+}
+
+func writeLayer(path string, format Format, l layer) ([]string, error) {
+	switch {
+	case format == FormatPNG16 && len(l.channels) <= 3:
+		path += format.Extension()
+		return []string{path}, writePNG16Channels(path, normaliseLayer(l))
+	case format == FormatPNG16:
+		var written []string
+		for i, c := range normaliseLayer(l) {
+			channel := path + "_" + l.suffixes[i] + format.Extension()
+			if err := WritePNG16(channel, c); err != nil {
+				return written, err
+			}
+			written = append(written, channel)
+		}
+		return written, nil
+	case format == FormatPFM && len(l.channels) == 2:
+		path += format.Extension()
+		empty := heightmap.New(l.channels[0].Width, l.channels[0].Height)
+		return []string{path}, writePFM(path, l.channels[0], l.channels[1], empty)
+	case len(l.channels) == 1:
+		if format == FormatRAW16 {
+			l.channels = normaliseLayer(l)
+		}
+		written, err := WriteHeightmap(path, format, l.channels[0], Options{})
+		return []string{written}, err
+	}
+
+	var written []string
+	for i, c := range l.channels {
+		single := layer{name: l.name, channels: []*heightmap.Heightmap{c}, signed: l.signed}
+		paths, err := writeLayer(path+"_"+l.suffixes[i], format, single)
+		written = append(written, paths...)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+/**
+ * Maps every channel of a layer into [0, 1] using a range shared across the layer,
+ * so relative magnitudes between channels are preserved.
+ */
+func normaliseLayer(l layer) []*heightmap.Heightmap {
+	var min, max float32 = 0, 0
+	for _, c := range l.channels {
+		cMin, cMax := c.Range()
+		min = float32(math.Min(float64(min), float64(cMin)))
+		max = float32(math.Max(float64(max), float64(cMax)))
+	}
+	if l.signed {
+		extent := float32(math.Max(math.Abs(float64(min)), math.Abs(float64(max))))
+		if extent == 0 {
+			// All zero, any range centred on zero puts it at the 0.5 midpoint.
+			extent = 1
+		}
+		min, max = -extent, extent
+	} else {
+		min = 0
+	}
+
+	normalised := make([]*heightmap.Heightmap, len(l.channels))
+	for i, c := range l.channels {
+		normalised[i] = c.Normalised(min, max)
+	}
+	return normalised
+}
+
+/**
+ * 16-bit PNG with 1 (grey), 2 or 3 (RGB) channels. Alpha is always opaque, it never carries data.
+ */
+func writePNG16Channels(path string, channels []*heightmap.Heightmap) error {
+	if len(channels) == 1 {
+		return WritePNG16(path, channels[0])
+	}
+	if len(channels) > 3 {
+		return fmt.Errorf("png layers have at most 3 channels, got %d", len(channels))
+	}
+	width, height := channels[0].Width, channels[0].Height
+	img := image.NewNRGBA64(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var values [3]uint16
+			for i, c := range channels {
+				values[i] = toUint16(c.At(x, y))
+			}
+			img.SetNRGBA64(x, y, color.NRGBA64{R: values[0], G: values[1], B: values[2], A: math.MaxUint16})
+		}
+	}
+	return writePNG(path, img)
+}
@@ -0,0 +1,102 @@
+package export
+
+import (
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ob6160/Terrain/erosion"
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+func TestNormaliseLayer(t *testing.T) {
+	tests := []struct {
+		name  string
+		layer layer
+		want  []float32
+	}{
+		{"unsigned", layer{channels: []*heightmap.Heightmap{flat(2, 2, 2), flat(2, 2, 4)}}, []float32{0.5, 1}},
+		{"unsigned, all zero", layer{channels: []*heightmap.Heightmap{flat(2, 2, 0)}}, []float32{0}},
+		// Signed layers share a range centred on zero, so the smaller channel lands nearer the middle.
+		{"signed", layer{channels: []*heightmap.Heightmap{flat(2, 2, -2), flat(2, 2, 1)}, signed: true}, []float32{0, 0.75}},
+		// No change at all is the midpoint, not the most negative value.
+		{"signed, all zero", layer{channels: []*heightmap.Heightmap{flat(2, 2, 0), flat(2, 2, 0)}, signed: true}, []float32{0.5, 0.5}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			normalised := normaliseLayer(test.layer)
+			for i, c := range normalised {
+				if got := c.At(1, 1); got != test.want[i] {
+					t.Errorf("channel %d is %v, want %v", i, got, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteLayersPNG16(t *testing.T) {
+	dir, err := ioutil.TempDir("", "layers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Only the left pipe flows, the others, the bottom one included, are empty.
+	layers := &erosion.Layers{
+		Water:     flat(2, 2, 0.1),
+		Sediment:  flat(2, 2, 0),
+		VelocityX: flat(2, 2, 1),
+		VelocityY: flat(2, 2, -1),
+		Outflow:   [4]*heightmap.Heightmap{flat(2, 2, 1), flat(2, 2, 0), flat(2, 2, 0), flat(2, 2, 0)},
+		Delta:     flat(2, 2, 0),
+	}
+	written, err := WriteLayers(filepath.Join(dir, "sim"), FormatPNG16, layers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// Red of the first pixel, and whether it's an RGB image rather than greyscale.
+		red uint16
+		rgb bool
+	}{
+		{"sim_water.png", 65535, false},
+		{"sim_sediment.png", 0, false},
+		{"sim_flow.png", 65535, true},
+		{"sim_outflow_left.png", 65535, false},
+		{"sim_outflow_right.png", 0, false},
+		{"sim_outflow_top.png", 0, false},
+		{"sim_outflow_bottom.png", 0, false},
+		{"sim_delta.png", 32768, false},
+	}
+	if len(written) != len(tests) {
+		t.Fatalf("wrote %v, want %d files", written, len(tests))
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if filepath.Base(written[i]) != test.name {
+				t.Fatalf("wrote %s, want %s", filepath.Base(written[i]), test.name)
+			}
+			file, err := os.Open(written[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			img, err := png.Decode(file)
+			file.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, gray := img.(*image.Gray16); gray == test.rgb {
+				t.Errorf("got a %T, want RGB %v", img, test.rgb)
+			}
+			r, _, _, a := img.At(0, 0).RGBA()
+			if uint16(r) != test.red || a != 0xFFFF {
+				t.Errorf("got red %d alpha %d, want red %d and opaque", r, a, test.red)
+			}
+		})
+	}
+}
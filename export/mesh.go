@@ -0,0 +1,280 @@
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+type MeshFormat int
+
+const (
+	MeshFormatOBJ MeshFormat = iota
+	MeshFormatPLY
+	MeshFormatSTL
+	MeshFormatGLB
+)
+
+var MeshFormatNames = []string{"Wavefront OBJ", "PLY (binary)", "STL (binary)", "glTF 2.0 (binary)"}
+
+var meshFormatExtensions = []string{".obj", ".ply", ".stl", ".glb"}
+
+func (f MeshFormat) Extension() string {
+	return meshFormatExtensions[f]
+}
+
+/**
+ * Indexed triangle mesh. Normals and UVs are per vertex and may be empty.
+ */
+type Mesh struct {
+	Positions []mgl32.Vec3
+	Normals   []mgl32.Vec3
+	UVs       []mgl32.Vec2
+	Indices   []uint32
+}
+
+/**
+ * HorizontalScale is the distance between neighbouring cells,
+ * VerticalScale multiplies each height sample.
+ */
+type MeshOptions struct {
+	HorizontalScale, VerticalScale float32
+}
+
+/**
+ * Builds the displaced terrain surface, centred on the origin with Y up,
+ * laid out the same way as the rendered core.ChunkedTerrain.
+ */
+func NewTerrainMesh(h *heightmap.Heightmap, opts MeshOptions) *Mesh {
+	var mesh = &Mesh{
+		Positions: make([]mgl32.Vec3, len(h.Data)),
+		Normals:   make([]mgl32.Vec3, len(h.Data)),
+		UVs:       make([]mgl32.Vec2, len(h.Data)),
+		Indices:   make([]uint32, 0, (h.Width-1)*(h.Height-1)*6),
+	}
+	centreX := float32(h.Width-1) / 2
+	centreY := float32(h.Height-1) / 2
+
+	for y := 0; y < h.Height; y++ {
+		for x := 0; x < h.Width; x++ {
+			i := h.Index(x, y)
+			mesh.Positions[i] = mgl32.Vec3{
+				(float32(y) - centreY) * opts.HorizontalScale,
+				h.At(x, y) * opts.VerticalScale,
+				(float32(x) - centreX) * opts.HorizontalScale,
+			}
+			mesh.Normals[i] = h.Normal(x, y, opts.HorizontalScale, opts.VerticalScale)
+			mesh.UVs[i] = mgl32.Vec2{float32(x) / float32(h.Width-1), float32(y) / float32(h.Height-1)}
+		}
+	}
+
+	// Counter-clockwise when seen from above.
+	for y := 0; y < h.Height-1; y++ {
+		for x := 0; x < h.Width-1; x++ {
+			a := uint32(h.Index(x, y))
+			b := uint32(h.Index(x+1, y))
+			c := uint32(h.Index(x, y+1))
+			d := uint32(h.Index(x+1, y+1))
+			mesh.Indices = append(mesh.Indices, a, b, c, b, d, c)
+		}
+	}
+	return mesh
+}
+
+/**
+ * Face normal of triangle `t` (counter-clockwise winding).
+ */
+func (m *Mesh) FaceNormal(t int) mgl32.Vec3 {
+	a := m.Positions[m.Indices[t*3]]
+	b := m.Positions[m.Indices[t*3+1]]
+	c := m.Positions[m.Indices[t*3+2]]
+	n := b.Sub(a).Cross(c.Sub(a))
+	if n.Len() == 0 {
+		return n
+	}
+	return n.Normalize()
+}
+
+/**
+ * Axis aligned bounds of the mesh positions.
+ */
+func (m *Mesh) Bounds() (min, max mgl32.Vec3) {
+	if len(m.Positions) == 0 {
+		return min, max
+	}
+	min, max = m.Positions[0], m.Positions[0]
+	for _, p := range m.Positions {
+		for axis := 0; axis < 3; axis++ {
+			if p[axis] < min[axis] {
+				min[axis] = p[axis]
+			}
+			if p[axis] > max[axis] {
+				max[axis] = p[axis]
+			}
+		}
+	}
+	return min, max
+}
+
+/**
+ * Writes the mesh to `path`, appending the format's extension if it's missing.
+ */
+func WriteMesh(path string, format MeshFormat, mesh *Mesh) (string, error) {
+	if !strings.HasSuffix(path, format.Extension()) {
+		path += format.Extension()
+	}
+
+	var write func(w io.Writer, mesh *Mesh) error
+	switch format {
+	case MeshFormatOBJ:
+		write = writeOBJ
+	case MeshFormatPLY:
+		write = writePLY
+	case MeshFormatSTL:
+		write = writeSTL
+	case MeshFormatGLB:
+		write = writeGLB
+	default:
+		return path, fmt.Errorf("unknown mesh format %d", format)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return path, err
+	}
+	w := bufio.NewWriter(file)
+	if err := write(w, mesh); err != nil {
+		file.Close()
+		return path, err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return path, err
+	}
+	return path, file.Close()
+}
+
+func writeOBJ(w io.Writer, mesh *Mesh) error {
+	if _, err := fmt.Fprintf(w, "# Terrain mesh\n"); err != nil {
+		return err
+	}
+	for _, p := range mesh.Positions {
+		if _, err := fmt.Fprintf(w, "v %f %f %f\n", p.X(), p.Y(), p.Z()); err != nil {
+			return err
+		}
+	}
+	for _, uv := range mesh.UVs {
+		if _, err := fmt.Fprintf(w, "vt %f %f\n", uv.X(), uv.Y()); err != nil {
+			return err
+		}
+	}
+	for _, n := range mesh.Normals {
+		if _, err := fmt.Fprintf(w, "vn %f %f %f\n", n.X(), n.Y(), n.Z()); err != nil {
+			return err
+		}
+	}
+
+	// OBJ indices are 1-based, and each corner references position/uv/normal.
+	corner := func(i uint32) string {
+		i++
+		switch {
+		case len(mesh.UVs) > 0 && len(mesh.Normals) > 0:
+			return fmt.Sprintf("%d/%d/%d", i, i, i)
+		case len(mesh.Normals) > 0:
+			return fmt.Sprintf("%d//%d", i, i)
+		case len(mesh.UVs) > 0:
+			return fmt.Sprintf("%d/%d", i, i)
+		}
+		return fmt.Sprintf("%d", i)
+	}
+	for t := 0; t < len(mesh.Indices); t += 3 {
+		_, err := fmt.Fprintf(w, "f %s %s %s\n",
+			corner(mesh.Indices[t]), corner(mesh.Indices[t+1]), corner(mesh.Indices[t+2]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writePLY(w io.Writer, mesh *Mesh) error {
+	var header strings.Builder
+	header.WriteString("ply\nformat binary_little_endian 1.0\ncomment Terrain mesh\n")
+	fmt.Fprintf(&header, "element vertex %d\n", len(mesh.Positions))
+	header.WriteString("property float x\nproperty float y\nproperty float z\n")
+	if len(mesh.Normals) > 0 {
+		header.WriteString("property float nx\nproperty float ny\nproperty float nz\n")
+	}
+	if len(mesh.UVs) > 0 {
+		header.WriteString("property float s\nproperty float t\n")
+	}
+	fmt.Fprintf(&header, "element face %d\n", len(mesh.Indices)/3)
+	header.WriteString("property list uchar uint vertex_indices\nend_header\n")
+	if _, err := io.WriteString(w, header.String()); err != nil {
+		return err
+	}
+
+	vertex := make([]float32, 0, 8)
+	for i, p := range mesh.Positions {
+		vertex = append(vertex[:0], p[:]...)
+		if len(mesh.Normals) > 0 {
+			vertex = append(vertex, mesh.Normals[i][:]...)
+		}
+		if len(mesh.UVs) > 0 {
+			vertex = append(vertex, mesh.UVs[i][:]...)
+		}
+		if err := binary.Write(w, binary.LittleEndian, vertex); err != nil {
+			return err
+		}
+	}
+
+	type face struct {
+		Count   uint8
+		Indices [3]uint32
+	}
+	for t := 0; t < len(mesh.Indices); t += 3 {
+		f := face{Count: 3, Indices: [3]uint32{mesh.Indices[t], mesh.Indices[t+1], mesh.Indices[t+2]}}
+		if err := binary.Write(w, binary.LittleEndian, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSTL(w io.Writer, mesh *Mesh) error {
+	var header [80]byte
+	copy(header[:], "Terrain mesh")
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	triangles := len(mesh.Indices) / 3
+	if err := binary.Write(w, binary.LittleEndian, uint32(triangles)); err != nil {
+		return err
+	}
+
+	type facet struct {
+		Normal    mgl32.Vec3
+		Vertices  [3]mgl32.Vec3
+		Attribute uint16
+	}
+	for t := 0; t < triangles; t++ {
+		f := facet{
+			Normal: mesh.FaceNormal(t),
+			Vertices: [3]mgl32.Vec3{
+				mesh.Positions[mesh.Indices[t*3]],
+				mesh.Positions[mesh.Indices[t*3+1]],
+				mesh.Positions[mesh.Indices[t*3+2]],
+			},
+		}
+		if err := binary.Write(w, binary.LittleEndian, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,297 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+func TestTerrainMesh(t *testing.T) {
+	h := bumpy(4, 3)
+	mesh := NewTerrainMesh(h, MeshOptions{HorizontalScale: 2, VerticalScale: 10})
+	if len(mesh.Positions) != 12 || len(mesh.Normals) != 12 || len(mesh.UVs) != 12 || len(mesh.Indices) != 3*2*6 {
+		t.Fatalf("got %d positions, %d normals, %d uvs and %d indices, want 12, 12, 12 and 36",
+			len(mesh.Positions), len(mesh.Normals), len(mesh.UVs), len(mesh.Indices))
+	}
+
+	tests := []struct {
+		x, y     int
+		position mgl32.Vec3
+		uv       mgl32.Vec2
+	}{
+		// Centred on the origin, cell y along world X and cell x along world Z.
+		{0, 0, mgl32.Vec3{-2, h.At(0, 0) * 10, -3}, mgl32.Vec2{0, 0}},
+		{3, 0, mgl32.Vec3{-2, h.At(3, 0) * 10, 3}, mgl32.Vec2{1, 0}},
+		{0, 2, mgl32.Vec3{2, h.At(0, 2) * 10, -3}, mgl32.Vec2{0, 1}},
+		{3, 2, mgl32.Vec3{2, h.At(3, 2) * 10, 3}, mgl32.Vec2{1, 1}},
+	}
+	for _, test := range tests {
+		i := h.Index(test.x, test.y)
+		if mesh.Positions[i] != test.position || mesh.UVs[i] != test.uv {
+			t.Errorf("cell (%d, %d) at %v with uv %v, want %v with uv %v",
+				test.x, test.y, mesh.Positions[i], mesh.UVs[i], test.position, test.uv)
+		}
+	}
+	for tri := 0; tri < len(mesh.Indices)/3; tri++ {
+		if n := mesh.FaceNormal(tri); n.Y() <= 0 {
+			t.Errorf("triangle %d faces %v, want up", tri, n)
+		}
+	}
+}
+
+func readOBJ(t *testing.T, path string) *Mesh {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var mesh = &Mesh{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var v mgl32.Vec3
+		switch fields[0] {
+		case "v", "vn":
+			if _, err := fmt.Sscan(strings.Join(fields[1:], " "), &v[0], &v[1], &v[2]); err != nil {
+				t.Fatal(err)
+			}
+			if fields[0] == "v" {
+				mesh.Positions = append(mesh.Positions, v)
+			} else {
+				mesh.Normals = append(mesh.Normals, v)
+			}
+		case "vt":
+			if _, err := fmt.Sscan(strings.Join(fields[1:], " "), &v[0], &v[1]); err != nil {
+				t.Fatal(err)
+			}
+			mesh.UVs = append(mesh.UVs, v.Vec2())
+		case "f":
+			for _, corner := range fields[1:] {
+				// Position, uv and normal are always the same vertex.
+				var p, uv, n uint32
+				if _, err := fmt.Sscanf(corner, "%d/%d/%d", &p, &uv, &n); err != nil || p != uv || p != n {
+					t.Fatalf("corner %q, want matching position/uv/normal indices", corner)
+				}
+				mesh.Indices = append(mesh.Indices, p-1)
+			}
+		}
+	}
+	return mesh
+}
+
+func readPLY(t *testing.T, path string) *Mesh {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	end := bytes.Index(data, []byte("end_header\n"))
+	if end < 0 {
+		t.Fatal("no end_header")
+	}
+	var vertices, faces int
+	var properties []string
+	for _, line := range strings.Split(string(data[:end]), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 3 && fields[0] == "element" && fields[1] == "vertex":
+			fmt.Sscan(fields[2], &vertices)
+		case len(fields) == 3 && fields[0] == "element" && fields[1] == "face":
+			fmt.Sscan(fields[2], &faces)
+		case len(fields) == 3 && fields[0] == "property" && fields[1] == "float":
+			properties = append(properties, fields[2])
+		case len(fields) > 0 && fields[0] == "format" && line != "format binary_little_endian 1.0":
+			t.Fatalf("format %q, want binary little endian", line)
+		}
+	}
+	if want := "x y z nx ny nz s t"; strings.Join(properties, " ") != want {
+		t.Fatalf("vertex properties %v, want %s", properties, want)
+	}
+
+	reader := bytes.NewReader(data[end+len("end_header\n"):])
+	var mesh = &Mesh{}
+	for i := 0; i < vertices; i++ {
+		var vertex [8]float32
+		if err := binary.Read(reader, binary.LittleEndian, &vertex); err != nil {
+			t.Fatal(err)
+		}
+		mesh.Positions = append(mesh.Positions, mgl32.Vec3{vertex[0], vertex[1], vertex[2]})
+		mesh.Normals = append(mesh.Normals, mgl32.Vec3{vertex[3], vertex[4], vertex[5]})
+		mesh.UVs = append(mesh.UVs, mgl32.Vec2{vertex[6], vertex[7]})
+	}
+	for i := 0; i < faces; i++ {
+		var face struct {
+			Count   uint8
+			Indices [3]uint32
+		}
+		if err := binary.Read(reader, binary.LittleEndian, &face); err != nil {
+			t.Fatal(err)
+		}
+		if face.Count != 3 {
+			t.Fatalf("face %d has %d corners, want 3", i, face.Count)
+		}
+		mesh.Indices = append(mesh.Indices, face.Indices[:]...)
+	}
+	if reader.Len() != 0 {
+		t.Fatalf("%d bytes left over", reader.Len())
+	}
+	return mesh
+}
+
+func readSTLMesh(t *testing.T, path string) *Mesh {
+	normals, triangles := readSTL(t, path)
+	var mesh = &Mesh{}
+	for i, tri := range triangles {
+		mesh.Positions = append(mesh.Positions, tri[:]...)
+		mesh.Indices = append(mesh.Indices, uint32(i*3), uint32(i*3+1), uint32(i*3+2))
+		if want := mesh.FaceNormal(i); normals[i] != want {
+			t.Fatalf("facet %d normal %v, want %v", i, normals[i], want)
+		}
+	}
+	return mesh
+}
+
+func readGLB(t *testing.T, path string) *Mesh {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	word := func(at int) int { return int(binary.LittleEndian.Uint32(data[at:])) }
+	if word(0) != glbMagic || word(4) != 2 || word(8) != len(data) {
+		t.Fatalf("header %x version %d length %d, want glTF 2 of %d bytes", word(0), word(4), word(8), len(data))
+	}
+	jsonLength := word(12)
+	if word(16) != glbChunkJSON || jsonLength%4 != 0 {
+		t.Fatalf("first chunk %x of %d bytes, want 4 byte aligned JSON", word(16), jsonLength)
+	}
+	var doc gltfDocument
+	if err := json.Unmarshal(data[20:20+jsonLength], &doc); err != nil {
+		t.Fatal(err)
+	}
+	binStart := 20 + jsonLength
+	binLength := word(binStart)
+	if word(binStart+4) != glbChunkBIN || binLength%4 != 0 || binStart+8+binLength != len(data) {
+		t.Fatalf("second chunk %x of %d bytes, want 4 byte aligned BIN filling the file", word(binStart+4), binLength)
+	}
+	bin := data[binStart+8:]
+	if doc.Buffers[0].ByteLength > binLength {
+		t.Fatalf("buffer of %d bytes in a %d byte chunk", doc.Buffers[0].ByteLength, binLength)
+	}
+
+	primitive := doc.Meshes[0].Primitives[0]
+	if primitive.Mode != gltfTriangles {
+		t.Fatalf("primitive mode %d, want triangles", primitive.Mode)
+	}
+	floats := func(accessor int, size int) []float32 {
+		a := doc.Accessors[accessor]
+		view := doc.BufferViews[a.BufferView]
+		if a.ComponentType != gltfFloat || view.ByteLength != a.Count*size*4 {
+			t.Fatalf("accessor %d is type %d with a %d byte view, want %d floats", accessor, a.ComponentType, view.ByteLength, a.Count*size)
+		}
+		values := make([]float32, a.Count*size)
+		for i := range values {
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(bin[view.ByteOffset+i*4:]))
+		}
+		return values
+	}
+
+	var mesh = &Mesh{}
+	positions := floats(primitive.Attributes["POSITION"], 3)
+	normals := floats(primitive.Attributes["NORMAL"], 3)
+	uvs := floats(primitive.Attributes["TEXCOORD_0"], 2)
+	for i := 0; i < len(positions)/3; i++ {
+		mesh.Positions = append(mesh.Positions, mgl32.Vec3{positions[i*3], positions[i*3+1], positions[i*3+2]})
+		mesh.Normals = append(mesh.Normals, mgl32.Vec3{normals[i*3], normals[i*3+1], normals[i*3+2]})
+		mesh.UVs = append(mesh.UVs, mgl32.Vec2{uvs[i*2], uvs[i*2+1]})
+	}
+	// Viewers use the position bounds to frame the mesh.
+	min, max := mesh.Bounds()
+	accessor := doc.Accessors[primitive.Attributes["POSITION"]]
+	if !min.ApproxEqual(mgl32.Vec3{accessor.Min[0], accessor.Min[1], accessor.Min[2]}) ||
+		!max.ApproxEqual(mgl32.Vec3{accessor.Max[0], accessor.Max[1], accessor.Max[2]}) {
+		t.Errorf("position bounds %v to %v, want %v to %v", accessor.Min, accessor.Max, min, max)
+	}
+
+	indices := doc.Accessors[primitive.Indices]
+	view := doc.BufferViews[indices.BufferView]
+	if indices.ComponentType != gltfUnsignedInt || view.Target != gltfElementArray {
+		t.Fatalf("indices are type %d in a view for %d, want unsigned ints in an element array", indices.ComponentType, view.Target)
+	}
+	for i := 0; i < indices.Count; i++ {
+		mesh.Indices = append(mesh.Indices, binary.LittleEndian.Uint32(bin[view.ByteOffset+i*4:]))
+	}
+	return mesh
+}
+
+func TestWriteMesh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mesh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Odd sizes, so the GLB chunks need padding.
+	mesh := NewTerrainMesh(bumpy(5, 3), MeshOptions{HorizontalScale: 1.5, VerticalScale: 20})
+
+	tests := []struct {
+		format MeshFormat
+		read   func(t *testing.T, path string) *Mesh
+		// Whether the format keeps shared vertices, their normals and UVs.
+		attributes bool
+		// OBJ is text, written to six decimal places.
+		tolerance float32
+	}{
+		{MeshFormatOBJ, readOBJ, true, 1e-5},
+		{MeshFormatPLY, readPLY, true, 0},
+		{MeshFormatSTL, readSTLMesh, false, 0},
+		{MeshFormatGLB, readGLB, true, 0},
+	}
+	for _, test := range tests {
+		t.Run(MeshFormatNames[test.format], func(t *testing.T) {
+			path, err := WriteMesh(filepath.Join(dir, "terrain"), test.format, mesh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if filepath.Ext(path) != test.format.Extension() {
+				t.Errorf("wrote %s, want the %s extension", path, test.format.Extension())
+			}
+			got := test.read(t, path)
+
+			want, read := trianglesOf(mesh), trianglesOf(got)
+			if len(read) != len(want) {
+				t.Fatalf("read %d triangles, want %d", len(read), len(want))
+			}
+			for i := range want {
+				for k := range want[i] {
+					if d := read[i][k].Sub(want[i][k]).Len(); d > test.tolerance {
+						t.Fatalf("triangle %d corner %d at %v, want %v", i, k, read[i][k], want[i][k])
+					}
+				}
+			}
+			if !test.attributes {
+				return
+			}
+			if len(got.Positions) != len(mesh.Positions) || len(got.Normals) != len(mesh.Normals) || len(got.UVs) != len(mesh.UVs) {
+				t.Fatalf("read %d positions, %d normals and %d uvs, want %d of each",
+					len(got.Positions), len(got.Normals), len(got.UVs), len(mesh.Positions))
+			}
+			for i := range mesh.Normals {
+				if got.Normals[i].Sub(mesh.Normals[i]).Len() > test.tolerance || got.UVs[i].Sub(mesh.UVs[i]).Len() > test.tolerance {
+					t.Fatalf("vertex %d has normal %v and uv %v, want %v and %v",
+						i, got.Normals[i], got.UVs[i], mesh.Normals[i], mesh.UVs[i])
+				}
+			}
+		})
+	}
+}
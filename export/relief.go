@@ -0,0 +1,191 @@
+package export
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+type ReliefPalette int32
+
+const (
+	PaletteHypsometric ReliefPalette = iota
+	PaletteDesert
+	PaletteArctic
+	PaletteGreyscale
+)
+
+var ReliefPaletteNames = []string{"Hypsometric", "Desert", "Arctic", "Greyscale"}
+
+type paletteStop struct {
+	at     float32
+	colour [3]float32
+}
+
+// Colours from the lowest to the highest point of the map.
+var reliefPalettes = [][]paletteStop{
+	PaletteHypsometric: {
+		{0.0, [3]float32{0.33, 0.55, 0.37}},
+		{0.2, [3]float32{0.55, 0.71, 0.45}},
+		{0.4, [3]float32{0.87, 0.85, 0.6}},
+		{0.6, [3]float32{0.78, 0.64, 0.45}},
+		{0.8, [3]float32{0.62, 0.5, 0.42}},
+		{1.0, [3]float32{0.97, 0.97, 0.97}},
+	},
+	PaletteDesert: {
+		{0.0, [3]float32{0.93, 0.84, 0.64}},
+		{0.5, [3]float32{0.85, 0.64, 0.42}},
+		{1.0, [3]float32{0.58, 0.36, 0.24}},
+	},
+	PaletteArctic: {
+		{0.0, [3]float32{0.62, 0.7, 0.74}},
+		{0.5, [3]float32{0.85, 0.9, 0.93}},
+		{1.0, [3]float32{1.0, 1.0, 1.0}},
+	},
+	PaletteGreyscale: {
+		{0.0, [3]float32{0.2, 0.2, 0.2}},
+		{1.0, [3]float32{1.0, 1.0, 1.0}},
+	},
+}
+
+func (p ReliefPalette) colour(t float32) [3]float32 {
+	stops := reliefPalettes[p]
+	if t <= stops[0].at {
+		return stops[0].colour
+	}
+	for i := 1; i < len(stops); i++ {
+		if t <= stops[i].at {
+			a, b := stops[i-1], stops[i]
+			f := (t - a.at) / (b.at - a.at)
+			var c [3]float32
+			for k := range c {
+				c[k] = a.colour[k] + (b.colour[k]-a.colour[k])*f
+			}
+			return c
+		}
+	}
+	return stops[len(stops)-1].colour
+}
+
+/**
+ * Light comes from Azimuth (degrees clockwise from north, the top of the image) at Altitude above the horizon.
+ * ZFactor is height units per cell, it sets how steep the terrain looks to the light.
+ * Multidirectional lighting adds three more lights around the first, weighted by the slope's aspect,
+ * so detail facing away from the main light isn't lost.
+ * Shading is how much of the colour the hillshade takes away in full shadow.
+ * Water deeper than WaterMinDepth is tinted with WaterColour, more strongly the deeper it is.
+ */
+type ReliefOptions struct {
+	Palette           ReliefPalette
+	Azimuth, Altitude float32
+	ZFactor           float32
+	Multidirectional  bool
+	Shading           float32
+	Water             bool
+	WaterMinDepth     float32
+	WaterColour       [3]float32
+	WaterOpaqueDepth  float32
+}
+
+func DefaultReliefOptions() ReliefOptions {
+	return ReliefOptions{
+		Palette:          PaletteHypsometric,
+		Azimuth:          315,
+		Altitude:         45,
+		ZFactor:          100,
+		Multidirectional: true,
+		Shading:          0.75,
+		Water:            true,
+		WaterMinDepth:    0.0005,
+		WaterColour:      [3]float32{0.36, 0.6, 0.8},
+		WaterOpaqueDepth: 0.02,
+	}
+}
+
+/**
+ * Renders a top-down, north up map of the heightmap with a pixel per cell,
+ * tinted by height and shaded by the light. water may be nil, it's only drawn when given.
+ */
+func RenderRelief(h *heightmap.Heightmap, water *heightmap.Heightmap, opts ReliefOptions) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, h.Width, h.Height))
+	min, max := h.Range()
+	span := max - min
+	if span == 0 {
+		span = 1
+	}
+
+	azimuths := []float64{float64(opts.Azimuth)}
+	if opts.Multidirectional {
+		azimuths = append(azimuths, float64(opts.Azimuth)-90, float64(opts.Azimuth)-45, float64(opts.Azimuth)+45)
+	}
+	altitude := float64(opts.Altitude) * math.Pi / 180
+
+	for y := 0; y < h.Height; y++ {
+		for x := 0; x < h.Width; x++ {
+			colour := opts.Palette.colour((h.At(x, y) - min) / span)
+			shade := hillshade(h, x, y, azimuths, altitude, float64(opts.ZFactor))
+			light := float32(1 - float64(opts.Shading)*(1-shade))
+			for k := range colour {
+				colour[k] *= light
+			}
+
+			if opts.Water && water != nil {
+				if depth := water.At(x, y); depth > opts.WaterMinDepth {
+					cover := float32(0.35 + 0.65*math.Min(1, float64(depth/opts.WaterOpaqueDepth)))
+					for k := range colour {
+						colour[k] += (opts.WaterColour[k]*light - colour[k]) * cover
+					}
+				}
+			}
+			img.SetRGBA(x, y, color.RGBA{toUint8(colour[0]), toUint8(colour[1]), toUint8(colour[2]), 255})
+		}
+	}
+	return img
+}
+
+/**
+ * Lambertian shade in [0, 1] of the cell at (x, y). With more than one light the results are blended
+ * by how square each light is to the slope's aspect, the weighting of Mark's multidirectional hillshade.
+ */
+func hillshade(h *heightmap.Heightmap, x, y int, azimuths []float64, altitude, zFactor float64) float64 {
+	dx, dy := h.Gradient(x, y)
+	// Image x is east and image y is south, so the surface rises towards +x by dx and towards +y by dy.
+	nx, ny, nz := -float64(dx)*zFactor, -float64(dy)*zFactor, 1.0
+	length := math.Sqrt(nx*nx + ny*ny + nz*nz)
+	nx, ny, nz = nx/length, ny/length, nz/length
+	aspect := math.Atan2(nx, -ny)
+
+	var shade, total float64
+	for _, azimuth := range azimuths {
+		a := azimuth * math.Pi / 180
+		lx := math.Sin(a) * math.Cos(altitude)
+		ly := -math.Cos(a) * math.Cos(altitude)
+		lz := math.Sin(altitude)
+		weight := 1.0
+		if len(azimuths) > 1 {
+			// The floor keeps lights square on to the slope from dropping out entirely.
+			s := math.Sin(aspect - a)
+			weight = s*s + 0.05
+		}
+		shade += weight * math.Max(0, nx*lx+ny*ly+nz*lz)
+		total += weight
+	}
+	return shade / total
+}
+
+func toUint8(value float32) uint8 {
+	return uint8(heightmap.Clamp(value, 0, 1)*255 + 0.5)
+}
+
+/**
+ * Renders the relief map and writes it as a PNG. The extension is appended if `path` doesn't already have it.
+ */
+func WriteRelief(path string, h *heightmap.Heightmap, water *heightmap.Heightmap, opts ReliefOptions) (string, error) {
+	if !strings.HasSuffix(path, ".png") {
+		path += ".png"
+	}
+	return path, writePNG(path, RenderRelief(h, water, opts))
+}
@@ -0,0 +1,145 @@
+package export
+
+import (
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+func filled(width, height int, value func(x, y int) float32) *heightmap.Heightmap {
+	h := heightmap.New(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			h.Set(x, y, value(x, y))
+		}
+	}
+	return h
+}
+
+func flat(width, height int, value float32) *heightmap.Heightmap {
+	return filled(width, height, func(x, y int) float32 { return value })
+}
+
+func TestPaletteColour(t *testing.T) {
+	tests := []struct {
+		palette ReliefPalette
+		t       float32
+		want    float32
+	}{
+		{PaletteGreyscale, 0, 0.2},
+		{PaletteGreyscale, 1, 1},
+		{PaletteGreyscale, 0.5, 0.6},
+		{PaletteGreyscale, -1, 0.2},
+		{PaletteGreyscale, 2, 1},
+		{PaletteArctic, 0.25, (0.62 + 0.85) / 2},
+	}
+	for _, test := range tests {
+		if got := test.palette.colour(test.t)[0]; got-test.want > 1e-6 || test.want-got > 1e-6 {
+			t.Errorf("%s at %v got red %v, want %v", ReliefPaletteNames[test.palette], test.t, got, test.want)
+		}
+	}
+}
+
+func TestReliefShading(t *testing.T) {
+	// Rises east at 45 degrees once scaled by the z factor.
+	ramp := filled(5, 5, func(x, y int) float32 { return float32(x) * 0.01 })
+	tests := []struct {
+		name    string
+		azimuth float32
+		want    uint8
+	}{
+		// Lit square on from the west, away from the east.
+		{"facing the light", 270, toUint8(0.6)},
+		{"facing away", 90, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := ReliefOptions{Palette: PaletteGreyscale, Azimuth: test.azimuth, Altitude: 45, ZFactor: 100, Shading: 1}
+			if got := RenderRelief(ramp, nil, opts).RGBAAt(2, 2).R; got != test.want {
+				t.Errorf("got red %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReliefWater(t *testing.T) {
+	ground := flat(3, 3, 0)
+	opts := ReliefOptions{
+		Palette:          PaletteGreyscale,
+		Altitude:         90,
+		ZFactor:          1,
+		Water:            true,
+		WaterMinDepth:    0.1,
+		WaterColour:      [3]float32{0, 0, 1},
+		WaterOpaqueDepth: 1,
+	}
+	dry := toUint8(0.2)
+	tests := []struct {
+		name  string
+		depth float32
+		water bool
+		want  [3]uint8
+	}{
+		{"too shallow", 0.05, true, [3]uint8{dry, dry, dry}},
+		{"opaque", 1, true, [3]uint8{0, 0, 255}},
+		{"deeper than opaque", 5, true, [3]uint8{0, 0, 255}},
+		// Halfway to opaque the water covers 0.35 + 0.65 * 0.5 of the ground.
+		{"part covered", 0.5, true, [3]uint8{toUint8(0.2 * 0.325), toUint8(0.2 * 0.325), toUint8(0.2 + 0.8*0.675)}},
+		{"water off", 1, false, [3]uint8{dry, dry, dry}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := opts
+			opts.Water = test.water
+			c := RenderRelief(ground, flat(3, 3, test.depth), opts).RGBAAt(1, 1)
+			if got := [3]uint8{c.R, c.G, c.B}; got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	// Without a water map the ground is drawn as it is.
+	if c := RenderRelief(ground, nil, opts).RGBAAt(1, 1); c.R != dry || c.B != dry {
+		t.Errorf("without water got %v, want grey %d", c, dry)
+	}
+}
+
+func TestWriteRelief(t *testing.T) {
+	dir, err := ioutil.TempDir("", "relief")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		path, want string
+	}{
+		{"map", "map.png"},
+		{"other.png", "other.png"},
+	}
+	for _, test := range tests {
+		path, err := WriteRelief(filepath.Join(dir, test.path), flat(7, 4, 0.5), nil, DefaultReliefOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path != filepath.Join(dir, test.want) {
+			t.Errorf("wrote %s, want %s", path, test.want)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(file)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := img.Bounds().Size(); size.X != 7 || size.Y != 4 {
+			t.Errorf("image is %v, want a pixel per cell", size)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package export
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/**
+ * Writes a rendered view as a PNG. The extension is appended if `path` doesn't already have it.
+ */
+func WriteScreenshot(path string, img image.Image) (string, error) {
+	if !strings.HasSuffix(path, ".png") {
+		path += ".png"
+	}
+	return path, writePNG(path, img)
+}
+
+type SequenceMode int32
+
+const (
+	// A frame every Interval simulation steps.
+	SequenceSimulation SequenceMode = iota
+	// A frame per rendered frame while the camera turns about its target.
+	SequenceOrbit
+)
+
+var SequenceModeNames = []string{"Every N Steps", "Camera Orbit"}
+
+/**
+ * Records the view as numbered PNGs, `<Prefix>_00000.png` onwards, for putting together time-lapse videos.
+ */
+type Sequence struct {
+	Mode   SequenceMode
+	Prefix string
+	// Size of each frame in pixels.
+	Width, Height int32
+	// Simulation steps between frames.
+	Interval int32
+	// Frames to record before stopping, zero records until stopped.
+	// An orbit makes one full turn over this many frames.
+	Frames    int32
+	recording bool
+	frame     int
+	lastStep  int
+}
+
+func NewSequence() *Sequence {
+	return &Sequence{Prefix: "frames/frame", Width: 1920, Height: 1080, Interval: 10, Frames: 360}
+}
+
+/**
+ * Starts recording from frame zero, `step` is the current simulation step.
+ */
+func (s *Sequence) Start(step int) {
+	s.recording = true
+	s.frame = 0
+	// The first frame is taken straight away.
+	s.lastStep = step - int(s.Interval)
+}
+
+func (s *Sequence) Stop() {
+	s.recording = false
+}
+
+func (s *Sequence) Recording() bool {
+	return s.recording
+}
+
+/**
+ * Number of frames written since Start.
+ */
+func (s *Sequence) Frame() int {
+	return s.frame
+}
+
+/**
+ * Whether a frame should be taken at simulation step `step`.
+ */
+func (s *Sequence) Due(step int) bool {
+	if !s.recording {
+		return false
+	}
+	if s.Mode == SequenceOrbit {
+		return true
+	}
+	return step-s.lastStep >= int(s.Interval)
+}
+
+/**
+ * Turn of the camera about its target for the next frame of an orbit, in radians.
+ */
+func (s *Sequence) OrbitAngle() float32 {
+	frames := s.Frames
+	if frames <= 0 {
+		frames = 360
+	}
+	return float32(2 * math.Pi * float64(s.frame) / float64(frames))
+}
+
+/**
+ * Writes the next frame, taken at simulation step `step`, and stops once Frames have been written.
+ */
+func (s *Sequence) Write(img image.Image, step int) (string, error) {
+	path := fmt.Sprintf("%s_%05d.png", s.Prefix, s.frame)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = writePNG(path, img)
+	}
+	if err != nil {
+		s.recording = false
+		return path, err
+	}
+	s.frame++
+	s.lastStep = step
+	if s.Frames > 0 && s.frame >= int(s.Frames) {
+		s.recording = false
+	}
+	return path, nil
+}
@@ -0,0 +1,114 @@
+package export
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+/**
+ * Physical dimensions for a printable solid, all in millimetres.
+ *
+ * Size is the length of the longest side of the base.
+ * Base is the thickness below the lowest point of the terrain.
+ * VerticalScale is the height of one unit of terrain height.
+ * Decimation keeps every Nth sample in each direction (1 keeps all of them).
+ */
+type SolidOptions struct {
+	Size, Base, VerticalScale float32
+	Decimation                int
+}
+
+/**
+ * Evenly spaced sample positions along an axis, always including the last sample
+ * so the solid covers the whole map.
+ */
+func decimatedAxis(length, step int) []int {
+	if step < 1 {
+		step = 1
+	}
+	var samples []int
+	for i := 0; i < length-1; i += step {
+		samples = append(samples, i)
+	}
+	return append(samples, length-1)
+}
+
+/**
+ * Builds a closed, manifold solid from the heightmap: the terrain surface on top,
+ * a vertical wall down each side and a flat base. Z is up, with the base at Z = 0,
+ * as expected by slicers. Faces wind counter-clockwise seen from outside.
+ */
+func NewSolidMesh(h *heightmap.Heightmap, opts SolidOptions) *Mesh {
+	xs := decimatedAxis(h.Width, opts.Decimation)
+	ys := decimatedAxis(h.Height, opts.Decimation)
+	nx, ny := len(xs), len(ys)
+
+	longest := h.Width - 1
+	if h.Height > h.Width {
+		longest = h.Height - 1
+	}
+	cellSize := opts.Size / float32(longest)
+	min, _ := h.Range()
+
+	var mesh = &Mesh{}
+	top := func(i, j int) uint32 {
+		return uint32(i + j*nx)
+	}
+
+	// Top surface.
+	for _, y := range ys {
+		for _, x := range xs {
+			z := opts.Base + (h.At(x, y)-min)*opts.VerticalScale
+			mesh.Positions = append(mesh.Positions, mgl32.Vec3{float32(x) * cellSize, float32(y) * cellSize, z})
+		}
+	}
+	for j := 0; j < ny-1; j++ {
+		for i := 0; i < nx-1; i++ {
+			a, b, c, d := top(i, j), top(i+1, j), top(i, j+1), top(i+1, j+1)
+			mesh.Indices = append(mesh.Indices, a, b, c, b, d, c)
+		}
+	}
+
+	// Walk the edge of the surface counter-clockwise (seen from above).
+	var perimeter []uint32
+	for i := 0; i < nx-1; i++ {
+		perimeter = append(perimeter, top(i, 0))
+	}
+	for j := 0; j < ny-1; j++ {
+		perimeter = append(perimeter, top(nx-1, j))
+	}
+	for i := nx - 1; i > 0; i-- {
+		perimeter = append(perimeter, top(i, ny-1))
+	}
+	for j := ny - 1; j > 0; j-- {
+		perimeter = append(perimeter, top(0, j))
+	}
+
+	// Each perimeter vertex gets a twin on the base.
+	bottom := make([]uint32, len(perimeter))
+	for k, index := range perimeter {
+		p := mesh.Positions[index]
+		bottom[k] = uint32(len(mesh.Positions))
+		mesh.Positions = append(mesh.Positions, mgl32.Vec3{p.X(), p.Y(), 0})
+	}
+
+	// The base is a fan around its centre, which avoids degenerate triangles along the straight edges.
+	centre := uint32(len(mesh.Positions))
+	mesh.Positions = append(mesh.Positions, mgl32.Vec3{
+		float32(xs[nx-1]) * cellSize / 2,
+		float32(ys[ny-1]) * cellSize / 2,
+		0,
+	})
+
+	for k := range perimeter {
+		next := (k + 1) % len(perimeter)
+		// Wall
+		mesh.Indices = append(mesh.Indices,
+			perimeter[k], bottom[k], bottom[next],
+			perimeter[k], bottom[next], perimeter[next])
+		// Base
+		mesh.Indices = append(mesh.Indices, centre, bottom[next], bottom[k])
+	}
+
+	return mesh
+}
@@ -0,0 +1,165 @@
+package export
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+func bumpy(width, height int) *heightmap.Heightmap {
+	return filled(width, height, func(x, y int) float32 {
+		return float32(math.Sin(float64(x)*0.7)*math.Cos(float64(y)*0.4)+1) / 2
+	})
+}
+
+func trianglesOf(mesh *Mesh) [][3]mgl32.Vec3 {
+	triangles := make([][3]mgl32.Vec3, len(mesh.Indices)/3)
+	for t := range triangles {
+		for k := range triangles[t] {
+			triangles[t][k] = mesh.Positions[mesh.Indices[t*3+k]]
+		}
+	}
+	return triangles
+}
+
+/**
+ * Checks the triangles close up: every edge, matched by position as a slicer would,
+ * is used once in each direction, so it's shared by exactly two faces winding opposite ways.
+ */
+func checkClosed(t *testing.T, triangles [][3]mgl32.Vec3) {
+	type edge struct{ from, to mgl32.Vec3 }
+	directed := make(map[edge]int)
+	for i, tri := range triangles {
+		if tri[1].Sub(tri[0]).Cross(tri[2].Sub(tri[0])).Len() == 0 {
+			t.Errorf("triangle %d %v is degenerate", i, tri)
+		}
+		for k := range tri {
+			directed[edge{tri[k], tri[(k+1)%3]}]++
+		}
+	}
+	for e, count := range directed {
+		if reverse := directed[edge{e.to, e.from}]; count != 1 || reverse != 1 {
+			t.Fatalf("edge %v to %v is used %d times and reversed %d times, want once each", e.from, e.to, count, reverse)
+		}
+	}
+}
+
+/**
+ * Checks each face points away from the solid: up on the surface, down on the base
+ * and away from the middle on the walls, with a positive enclosed volume overall.
+ */
+func checkOutward(t *testing.T, triangles [][3]mgl32.Vec3, centre mgl32.Vec3) {
+	var volume float32
+	for i, tri := range triangles {
+		n := tri[1].Sub(tri[0]).Cross(tri[2].Sub(tri[0]))
+		volume += tri[0].Dot(tri[1].Cross(tri[2])) / 6
+		middle := tri[0].Add(tri[1]).Add(tri[2]).Mul(1.0 / 3)
+		var outward bool
+		switch {
+		case tri[0].Z() == 0 && tri[1].Z() == 0 && tri[2].Z() == 0:
+			outward = n.Z() < 0
+		case n.Z() == 0:
+			away := middle.Sub(centre)
+			outward = n.X()*away.X()+n.Y()*away.Y() > 0
+		default:
+			outward = n.Z() > 0
+		}
+		if !outward {
+			t.Fatalf("triangle %d %v faces inwards, normal %v", i, tri, n)
+		}
+	}
+	if volume <= 0 {
+		t.Errorf("enclosed volume is %v, want it positive", volume)
+	}
+}
+
+var solidTests = []struct {
+	name          string
+	width, height int
+	decimation    int
+}{
+	{"full resolution", 9, 9, 1},
+	{"not square", 12, 7, 1},
+	{"decimated", 17, 17, 4},
+	// The last row and column don't fall on the step, they're kept anyway.
+	{"decimated unevenly", 14, 11, 3},
+	{"decimated past the size", 5, 5, 8},
+}
+
+func TestSolidMeshClosed(t *testing.T) {
+	for _, test := range solidTests {
+		t.Run(test.name, func(t *testing.T) {
+			mesh := NewSolidMesh(bumpy(test.width, test.height), SolidOptions{Size: 100, Base: 2, VerticalScale: 10, Decimation: test.decimation})
+			min, max := mesh.Bounds()
+			if min.Z() != 0 || max.X() != 100 && max.Y() != 100 {
+				t.Errorf("bounds %v to %v, want the base at zero and the longest side 100", min, max)
+			}
+			triangles := trianglesOf(mesh)
+			checkClosed(t, triangles)
+			checkOutward(t, triangles, mgl32.Vec3{max.X() / 2, max.Y() / 2, 0})
+		})
+	}
+}
+
+func TestSolidSTL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "solid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range solidTests {
+		t.Run(test.name, func(t *testing.T) {
+			mesh := NewSolidMesh(bumpy(test.width, test.height), SolidOptions{Size: 100, Base: 2, VerticalScale: 10, Decimation: test.decimation})
+			path, err := WriteMesh(filepath.Join(dir, "solid"), MeshFormatSTL, mesh)
+			if err != nil {
+				t.Fatal(err)
+			}
+			normals, triangles := readSTL(t, path)
+			if len(triangles) != len(mesh.Indices)/3 {
+				t.Fatalf("read %d facets, want %d", len(triangles), len(mesh.Indices)/3)
+			}
+			// STL has no shared vertices, the solid has to close up by position alone.
+			checkClosed(t, triangles)
+			for i, tri := range triangles {
+				if n := tri[1].Sub(tri[0]).Cross(tri[2].Sub(tri[0])); n.Dot(normals[i]) <= 0 {
+					t.Fatalf("facet %d normal %v disagrees with its winding", i, normals[i])
+				}
+			}
+		})
+	}
+}
+
+func readSTL(t *testing.T, path string) (normals []mgl32.Vec3, triangles [][3]mgl32.Vec3) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const header, facetSize = 84, 50
+	if len(data) < header {
+		t.Fatalf("%d bytes is too short for an STL", len(data))
+	}
+	count := int(binary.LittleEndian.Uint32(data[80:]))
+	if len(data) != header+count*facetSize {
+		t.Fatalf("%d bytes for %d facets, want %d", len(data), count, header+count*facetSize)
+	}
+	vec := func(b []byte) mgl32.Vec3 {
+		var v mgl32.Vec3
+		for k := range v {
+			v[k] = math.Float32frombits(binary.LittleEndian.Uint32(b[k*4:]))
+		}
+		return v
+	}
+	for i := 0; i < count; i++ {
+		facet := data[header+i*facetSize:]
+		normals = append(normals, vec(facet))
+		triangles = append(triangles, [3]mgl32.Vec3{vec(facet[12:]), vec(facet[24:]), vec(facet[36:])})
+	}
+	return normals, triangles
+}
@@ -0,0 +1,154 @@
+package gis
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+const defaultNoData = -9999
+
+/**
+ * Reads an ESRI ASCII grid (.asc). Both corner and centre registered headers are accepted,
+ * as is the non-square `dx`/`dy` extension written by GDAL.
+ * Elevations are returned as is, with ZScale 1 and ZOffset 0.
+ */
+func ReadASCIIGrid(path string) (*heightmap.Heightmap, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	scanner.Split(bufio.ScanWords)
+
+	header := make(map[string]float64)
+	var first string
+	for scanner.Scan() {
+		key := strings.ToLower(scanner.Text())
+		if _, err := strconv.ParseFloat(key, 64); err == nil {
+			// Header is over, this is the first sample.
+			first = key
+			break
+		}
+		if !scanner.Scan() {
+			break
+		}
+		value, err := strconv.ParseFloat(scanner.Text(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad header value for %s: %v", path, key, err)
+		}
+		header[key] = value
+	}
+
+	cols, rows := int(header["ncols"]), int(header["nrows"])
+	if cols <= 0 || rows <= 0 {
+		return nil, fmt.Errorf("%s: missing ncols/nrows", path)
+	}
+
+	geo := heightmap.DefaultGeoreference()
+	if size, ok := header["cellsize"]; ok {
+		geo.CellSizeX, geo.CellSizeY = size, size
+	} else {
+		geo.CellSizeX, geo.CellSizeY = header["dx"], header["dy"]
+	}
+	if geo.CellSizeX <= 0 || geo.CellSizeY <= 0 {
+		return nil, fmt.Errorf("%s: missing or invalid cell size", path)
+	}
+
+	// The header locates the lower left corner (or centre of the lower left cell).
+	lowerLeftX, cornerX := header["xllcorner"]
+	lowerLeftY, cornerY := header["yllcorner"]
+	if !cornerX {
+		lowerLeftX = header["xllcenter"] - geo.CellSizeX/2
+	}
+	if !cornerY {
+		lowerLeftY = header["yllcenter"] - geo.CellSizeY/2
+	}
+	geo.OriginX = lowerLeftX
+	geo.OriginY = lowerLeftY + float64(rows)*geo.CellSizeY
+	if noData, ok := header["nodata_value"]; ok {
+		geo.NoData, geo.HasNoData = noData, true
+	}
+
+	var h = heightmap.New(cols, rows)
+	h.Geo = geo
+	for i := range h.Data {
+		var token string
+		if i == 0 && first != "" {
+			token = first
+		} else if scanner.Scan() {
+			token = scanner.Text()
+		} else {
+			return nil, fmt.Errorf("%s: expected %d samples, found %d", path, len(h.Data), i)
+		}
+		value, err := strconv.ParseFloat(token, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad sample %d: %v", path, i, err)
+		}
+		h.Data[i] = float32(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+/**
+ * Writes an ESRI ASCII grid with a corner registered header.
+ * Samples are converted back to elevations using the heightmap's georeference.
+ */
+func WriteASCIIGrid(path string, h *heightmap.Heightmap) error {
+	geo := h.Geo
+	if geo == nil {
+		geo = heightmap.DefaultGeoreference()
+	}
+	noData := float64(defaultNoData)
+	if geo.HasNoData {
+		noData = geo.NoData
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	fmt.Fprintf(w, "ncols %d\nnrows %d\n", h.Width, h.Height)
+	fmt.Fprintf(w, "xllcorner %s\n", formatFloat(geo.OriginX))
+	fmt.Fprintf(w, "yllcorner %s\n", formatFloat(geo.OriginY-float64(h.Height)*geo.CellSizeY))
+	if geo.CellSizeX == geo.CellSizeY {
+		fmt.Fprintf(w, "cellsize %s\n", formatFloat(geo.CellSizeX))
+	} else {
+		fmt.Fprintf(w, "dx %s\ndy %s\n", formatFloat(geo.CellSizeX), formatFloat(geo.CellSizeY))
+	}
+	fmt.Fprintf(w, "NODATA_value %s\n", formatFloat(noData))
+
+	for y := 0; y < h.Height; y++ {
+		for x := 0; x < h.Width; x++ {
+			if x > 0 {
+				w.WriteByte(' ')
+			}
+			w.WriteString(formatFloat(geo.Elevation(h.At(x, y))))
+		}
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func formatFloat(value float64) string {
+	if value == math.Trunc(value) && math.Abs(value) < 1e15 {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(value, 'g', 9, 64)
+}
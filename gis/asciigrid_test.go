@@ -0,0 +1,133 @@
+package gis
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+func TestReadASCIIGrid(t *testing.T) {
+	tests := []struct {
+		name, text string
+		// Top left corner and cell sizes.
+		originX, originY     float64
+		cellSizeX, cellSizeY float64
+		noData               bool
+	}{
+		{"corner", "ncols 3\nnrows 2\nxllcorner 100\nyllcorner 200\ncellsize 10\n1 2 3\n4 5 6\n",
+			100, 220, 10, 10, false},
+		{"centre", "NCOLS 3\nNROWS 2\nXLLCENTER 105\nYLLCENTER 205\nCELLSIZE 10\n1 2 3 4 5 6\n",
+			100, 220, 10, 10, false},
+		{"dx and dy", "ncols 3\nnrows 2\nxllcorner 100\nyllcorner 200\ndx 10\ndy 5\nNODATA_value -9999\n1 2 3\n4 5 6\n",
+			100, 210, 10, 5, true},
+	}
+	dir, err := ioutil.TempDir("", "asciigrid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "grid.asc")
+			if err := ioutil.WriteFile(path, []byte(test.text), 0644); err != nil {
+				t.Fatal(err)
+			}
+			h, err := ReadDEM(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Width != 3 || h.Height != 2 || h.At(0, 0) != 1 || h.At(2, 1) != 6 {
+				t.Errorf("read %dx%d samples %v, want 3x2 samples 1 to 6", h.Width, h.Height, h.Data)
+			}
+			geo := h.Geo
+			if geo.OriginX != test.originX || geo.OriginY != test.originY ||
+				geo.CellSizeX != test.cellSizeX || geo.CellSizeY != test.cellSizeY {
+				t.Errorf("origin %v, %v with cells %v x %v, want %v, %v with cells %v x %v",
+					geo.OriginX, geo.OriginY, geo.CellSizeX, geo.CellSizeY,
+					test.originX, test.originY, test.cellSizeX, test.cellSizeY)
+			}
+			if geo.HasNoData != test.noData {
+				t.Errorf("has nodata %v, want %v", geo.HasNoData, test.noData)
+			}
+		})
+	}
+}
+
+func TestReadASCIIGridMalformed(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"empty", "", "missing ncols/nrows"},
+		{"no rows", "ncols 3\ncellsize 1\n1 2 3\n", "missing ncols/nrows"},
+		{"bad header value", "ncols three\nnrows 2\n", "bad header value for ncols"},
+		{"header without a value", "ncols 3\nnrows", "missing ncols/nrows"},
+		{"no cell size", "ncols 1\nnrows 1\n5\n", "missing or invalid cell size"},
+		{"negative cell size", "ncols 1\nnrows 1\ncellsize -1\n5\n", "missing or invalid cell size"},
+		{"too few samples", "ncols 2\nnrows 2\ncellsize 1\n1 2 3\n", "expected 4 samples, found 3"},
+		{"bad sample", "ncols 2\nnrows 1\ncellsize 1\n1 x\n", "bad sample 1"},
+	}
+	dir, err := ioutil.TempDir("", "asciigrid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, "grid.asc")
+			if err := ioutil.WriteFile(path, []byte(test.text), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ReadASCIIGrid(path)
+			if err == nil {
+				t.Fatalf("read without an error, want %q", test.want)
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %q, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestASCIIGridRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "asciigrid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name string
+		geo  *heightmap.Georeference
+	}{
+		{"square cells", testDEM().Geo},
+		{"dx and dy", &heightmap.Georeference{OriginX: -20.5, OriginY: 60.25, CellSizeX: 0.5, CellSizeY: 0.25, ZScale: 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := testDEM()
+			want.Geo = test.geo
+			path := filepath.Join(dir, "grid.asc")
+			if err := WriteDEM(path, want, SampleFloat32); err != nil {
+				t.Fatal(err)
+			}
+			h, err := ReadDEM(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range want.Data {
+				if h.Data[i] != want.Data[i] {
+					t.Fatalf("got samples %v, want %v", h.Data, want.Data)
+				}
+			}
+			geo := h.Geo
+			if geo.OriginX != test.geo.OriginX || geo.OriginY != test.geo.OriginY ||
+				geo.CellSizeX != test.geo.CellSizeX || geo.CellSizeY != test.geo.CellSizeY {
+				t.Errorf("got georeference %+v, want %+v", geo, test.geo)
+			}
+		})
+	}
+}
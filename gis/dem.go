@@ -0,0 +1,143 @@
+package gis
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ob6160/Terrain/heightmap"
+	"github.com/ob6160/Terrain/utils"
+)
+
+/**
+ * Reads a DEM, picking the format from the file extension (.tif, .tiff or .asc).
+ */
+func ReadDEM(path string) (*heightmap.Heightmap, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tif", ".tiff":
+		return ReadGeoTIFF(path)
+	case ".asc":
+		return ReadASCIIGrid(path)
+	}
+	return nil, fmt.Errorf("%s: unknown DEM format, expected .tif, .tiff or .asc", path)
+}
+
+/**
+ * Writes a DEM, picking the format from the file extension (.tif, .tiff or .asc).
+ * The sample type only applies to GeoTIFF.
+ */
+func WriteDEM(path string, h *heightmap.Heightmap, sampleType SampleType) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tif", ".tiff":
+		return WriteGeoTIFF(path, h, sampleType)
+	case ".asc":
+		return WriteASCIIGrid(path, h)
+	}
+	return fmt.Errorf("%s: unknown DEM format, expected .tif, .tiff or .asc", path)
+}
+
+/**
+ * A terrain generator backed by an imported DEM.
+ *
+ * The DEM is resampled to the simulation resolution and normalised into [0, 1];
+ * its georeference records the new cell size and how to recover real elevations,
+ * so anything derived from this generator lines up with the source DEM.
+ */
+type DEM struct {
+	width, height int
+	source        []float32
+	heightmap     []float32
+	geo           *heightmap.Georeference
+}
+
+func NewDEM(dem *heightmap.Heightmap, width, height int) *DEM {
+	filled := fillNoData(dem)
+	resized := filled.Resized(width, height)
+	min, max := resized.Range()
+	normalised := resized.Normalised(min, max)
+
+	geo := *resized.Geo
+	geo.ZOffset = geo.Elevation(min)
+	geo.ZScale = geo.ZScale * float64(max-min)
+
+	var d = &DEM{
+		width:     width,
+		height:    height,
+		source:    make([]float32, (width+1)*(height+1)),
+		heightmap: make([]float32, (width+1)*(height+1)),
+		geo:       &geo,
+	}
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			d.source[utils.ToIndex(x, y, width)] = normalised.At(x, y)
+		}
+	}
+	copy(d.heightmap, d.source)
+	return d
+}
+
+/**
+ * Reads a DEM from disk and wraps it in a generator of the given size.
+ */
+func ImportDEM(path string, width, height int) (*DEM, error) {
+	dem, err := ReadDEM(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewDEM(dem, width, height), nil
+}
+
+/**
+ * Replaces nodata cells with the lowest valid elevation, so they don't
+ * turn into cliffs when the DEM is resampled and eroded.
+ */
+func fillNoData(dem *heightmap.Heightmap) *heightmap.Heightmap {
+	filled := dem.Copy()
+	if dem.Geo == nil || !dem.Geo.HasNoData {
+		if filled.Geo == nil {
+			filled.Geo = heightmap.DefaultGeoreference()
+		}
+		return filled
+	}
+	noData := float32(dem.Geo.NoData)
+	var lowest float32
+	found := false
+	for _, v := range dem.Data {
+		if v != noData && (!found || v < lowest) {
+			lowest, found = v, true
+		}
+	}
+	for i, v := range filled.Data {
+		if v == noData {
+			filled.Data[i] = lowest
+		}
+	}
+	return filled
+}
+
+/**
+ * Restores the imported heights, the DEM has no parameters to vary.
+ */
+func (d *DEM) Generate(spread, reduce float32) {
+	copy(d.heightmap, d.source)
+}
+
+func (d *DEM) Heightmap() []float32 {
+	return d.heightmap
+}
+
+func (d *DEM) Get(p utils.Point) (float32, string) {
+	lookupInd := p.ToIndex(d.width)
+	if lookupInd >= len(d.heightmap) || lookupInd < 0 {
+		return 0, "Out of bounds."
+	}
+	return d.heightmap[lookupInd], ""
+}
+
+func (d *DEM) Dimensions() (int, int) {
+	return d.width, d.height
+}
+
+func (d *DEM) Georeference() *heightmap.Georeference {
+	return d.geo
+}
@@ -0,0 +1,44 @@
+package gis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ob6160/Terrain/utils"
+)
+
+func TestDEMFormat(t *testing.T) {
+	for _, path := range []string{"dem.png", "dem"} {
+		if _, err := ReadDEM(path); err == nil || !strings.Contains(err.Error(), "unknown DEM format") {
+			t.Errorf("reading %s got error %v, want an unknown format", path, err)
+		}
+		if err := WriteDEM(path, testDEM(), SampleFloat32); err == nil || !strings.Contains(err.Error(), "unknown DEM format") {
+			t.Errorf("writing %s got error %v, want an unknown format", path, err)
+		}
+	}
+}
+
+func TestNewDEM(t *testing.T) {
+	dem := testDEM()
+	dem.Data[0] = float32(dem.Geo.NoData)
+	d := NewDEM(dem, 3, 2)
+
+	// The nodata cell is filled with the lowest valid elevation, 0, and the rest normalised from there.
+	min, max := float32(0), float32(250.25)
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			want := dem.At(x, y)
+			if x == 0 && y == 0 {
+				want = min
+			}
+			want = (want - min) / (max - min)
+			if value := d.Heightmap()[utils.ToIndex(x, y, 3)]; value != want {
+				t.Errorf("cell (%d, %d) is %v, want %v", x, y, value, want)
+			}
+		}
+	}
+	geo := d.Georeference()
+	if geo.Elevation(0) != 0 || geo.Elevation(1) != 250.25 {
+		t.Errorf("normalised 0 and 1 are %v and %v, want 0 and 250.25", geo.Elevation(0), geo.Elevation(1))
+	}
+}
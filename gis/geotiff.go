@@ -0,0 +1,582 @@
+package gis
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+// Baseline TIFF and GeoTIFF tags, see https://www.awaresystems.be/imaging/tiff/tifftags.html
+const (
+	tagImageWidth      = 256
+	tagImageLength     = 257
+	tagBitsPerSample   = 258
+	tagCompression     = 259
+	tagPhotometric     = 262
+	tagStripOffsets    = 273
+	tagSamplesPerPixel = 277
+	tagRowsPerStrip    = 278
+	tagStripByteCounts = 279
+	tagPlanarConfig    = 284
+	tagPredictor       = 317
+	tagTileWidth       = 322
+	tagTileLength      = 323
+	tagTileOffsets     = 324
+	tagTileByteCounts  = 325
+	tagSampleFormat    = 339
+	tagModelPixelScale = 33550
+	tagModelTiepoint   = 33922
+	tagGeoKeyDirectory = 34735
+	tagGeoDoubleParams = 34736
+	tagGeoASCIIParams  = 34737
+	tagGDALNoData      = 42113
+
+	compressionNone        = 1
+	compressionDeflate     = 8
+	compressionDeflateOld  = 32946
+	predictorNone          = 1
+	predictorHorizontal    = 2
+	sampleFormatUint       = 1
+	sampleFormatInt        = 2
+	sampleFormatFloat      = 3
+	geoKeyRasterType       = 1025
+	rasterPixelIsArea      = 1
+	rasterPixelIsPoint     = 2
+	typeByte               = 1
+	typeShort              = 3
+	typeLong               = 4
+	typeASCII              = 2
+	typeDouble             = 12
+	tiffEntrySize          = 12
+	tiffLittleEndianMarker = "II"
+	tiffBigEndianMarker    = "MM"
+)
+
+type SampleType int
+
+const (
+	SampleFloat32 SampleType = iota
+	SampleInt16
+)
+
+var SampleTypeNames = []string{"Float32", "Int16"}
+
+type tiffEntry struct {
+	tag, kind uint16
+	count     uint32
+	// Raw value bytes, either inline or read from the offset.
+	data []byte
+}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+	tags  map[uint16]tiffEntry
+}
+
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 16: 8}
+
+/**
+ * Reads a single band GeoTIFF holding float32, int16 or uint16 samples.
+ * Supports strips or tiles, uncompressed or Deflate with an optional horizontal predictor.
+ * Elevations are returned as is, with ZScale 1 and ZOffset 0.
+ */
+func ReadGeoTIFF(path string) (*heightmap.Heightmap, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, fmt.Errorf("%s: too short to be a TIFF", path)
+	}
+
+	var r = tiffReader{data: data, tags: make(map[uint16]tiffEntry)}
+	switch string(data[0:2]) {
+	case tiffLittleEndianMarker:
+		r.order = binary.LittleEndian
+	case tiffBigEndianMarker:
+		r.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("%s: not a TIFF file", path)
+	}
+	if r.order.Uint16(data[2:4]) != 42 {
+		return nil, fmt.Errorf("%s: unsupported TIFF version (BigTIFF?)", path)
+	}
+	if err := r.readIFD(r.order.Uint32(data[4:8])); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	h, err := r.decode()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return h, nil
+}
+
+func (r *tiffReader) readIFD(offset uint32) error {
+	if int(offset)+2 > len(r.data) {
+		return fmt.Errorf("invalid IFD offset")
+	}
+	count := int(r.order.Uint16(r.data[offset:]))
+	for i := 0; i < count; i++ {
+		start := int(offset) + 2 + i*tiffEntrySize
+		if start+tiffEntrySize > len(r.data) {
+			return fmt.Errorf("truncated IFD")
+		}
+		entry := r.data[start : start+tiffEntrySize]
+		e := tiffEntry{
+			tag:   r.order.Uint16(entry[0:2]),
+			kind:  r.order.Uint16(entry[2:4]),
+			count: r.order.Uint32(entry[4:8]),
+		}
+		typeSize, ok := tiffTypeSizes[e.kind]
+		if !ok {
+			return fmt.Errorf("tag %d has unknown field type %d", e.tag, e.kind)
+		}
+		size := typeSize * int(e.count)
+		if size <= 4 {
+			e.data = entry[8 : 8+size]
+		} else {
+			valueOffset := int(r.order.Uint32(entry[8:12]))
+			if valueOffset+size > len(r.data) {
+				return fmt.Errorf("tag %d points outside the file", e.tag)
+			}
+			e.data = r.data[valueOffset : valueOffset+size]
+		}
+		r.tags[e.tag] = e
+	}
+	return nil
+}
+
+/**
+ * Checks the entry holds `count` values of `size` bytes.
+ */
+func (e tiffEntry) check(size int) error {
+	if len(e.data) < int(e.count)*size {
+		return fmt.Errorf("tag %d is truncated", e.tag)
+	}
+	return nil
+}
+
+/**
+ * Returns every value of an integer tag, or nil if the tag is missing.
+ */
+func (r *tiffReader) ints(tag uint16) ([]int, error) {
+	e, ok := r.tags[tag]
+	if !ok {
+		return nil, nil
+	}
+	var size int
+	switch e.kind {
+	case typeShort:
+		size = 2
+	case typeLong:
+		size = 4
+	case typeByte:
+		size = 1
+	default:
+		return nil, fmt.Errorf("tag %d has type %d, expected an integer", e.tag, e.kind)
+	}
+	if err := e.check(size); err != nil {
+		return nil, err
+	}
+	values := make([]int, e.count)
+	for i := range values {
+		switch e.kind {
+		case typeShort:
+			values[i] = int(r.order.Uint16(e.data[i*2:]))
+		case typeLong:
+			values[i] = int(r.order.Uint32(e.data[i*4:]))
+		default:
+			values[i] = int(e.data[i])
+		}
+	}
+	return values, nil
+}
+
+func (r *tiffReader) int(tag uint16, fallback int) (int, error) {
+	values, err := r.ints(tag)
+	if len(values) == 0 {
+		return fallback, err
+	}
+	return values[0], nil
+}
+
+func (r *tiffReader) doubles(tag uint16) ([]float64, error) {
+	e, ok := r.tags[tag]
+	if !ok || e.kind != typeDouble {
+		return nil, nil
+	}
+	if err := e.check(8); err != nil {
+		return nil, err
+	}
+	values := make([]float64, e.count)
+	for i := range values {
+		values[i] = math.Float64frombits(r.order.Uint64(e.data[i*8:]))
+	}
+	return values, nil
+}
+
+func (r *tiffReader) ascii(tag uint16) string {
+	e, ok := r.tags[tag]
+	if !ok {
+		return ""
+	}
+	return strings.TrimRight(string(e.data), "\x00")
+}
+
+func (r *tiffReader) decode() (*heightmap.Heightmap, error) {
+	// Read up front, a malformed tag is reported as the first error.
+	var err error
+	integer := func(tag uint16, fallback int) int {
+		value, tagErr := r.int(tag, fallback)
+		if err == nil {
+			err = tagErr
+		}
+		return value
+	}
+	integers := func(tag uint16) []int {
+		values, tagErr := r.ints(tag)
+		if err == nil {
+			err = tagErr
+		}
+		return values
+	}
+	width := integer(tagImageWidth, 0)
+	height := integer(tagImageLength, 0)
+	samples := integer(tagSamplesPerPixel, 1)
+	bits := integer(tagBitsPerSample, 1)
+	format := integer(tagSampleFormat, sampleFormatUint)
+	compression := integer(tagCompression, compressionNone)
+	predictor := integer(tagPredictor, predictorNone)
+	// Strips are treated as tiles spanning the full width of the image.
+	blockWidth, blockHeight := width, integer(tagRowsPerStrip, height)
+	offsets, counts := integers(tagStripOffsets), integers(tagStripByteCounts)
+	if _, tiled := r.tags[tagTileWidth]; tiled {
+		blockWidth, blockHeight = integer(tagTileWidth, 0), integer(tagTileLength, 0)
+		offsets, counts = integers(tagTileOffsets), integers(tagTileByteCounts)
+	} else if blockHeight > height {
+		// Writers often give 2^32 - 1 for a single strip.
+		blockHeight = height
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("missing image dimensions")
+	}
+	if samples != 1 {
+		return nil, fmt.Errorf("only single band images are supported, found %d bands", samples)
+	}
+
+	// The horizontal predictor stores each integer sample as the difference from its left neighbour,
+	// so integer samples are accumulated as raw bits before being converted.
+	var sample func(b []byte, previous uint16) (float32, uint16)
+	switch {
+	case format == sampleFormatFloat && bits == 32:
+		sample = func(b []byte, _ uint16) (float32, uint16) {
+			return math.Float32frombits(r.order.Uint32(b)), 0
+		}
+	case format == sampleFormatInt && bits == 16:
+		sample = func(b []byte, previous uint16) (float32, uint16) {
+			raw := r.order.Uint16(b) + previous
+			return float32(int16(raw)), raw
+		}
+	case format == sampleFormatUint && bits == 16:
+		sample = func(b []byte, previous uint16) (float32, uint16) {
+			raw := r.order.Uint16(b) + previous
+			return float32(raw), raw
+		}
+	default:
+		return nil, fmt.Errorf("unsupported sample type: %d bit, format %d", bits, format)
+	}
+	bytesPerSample := bits / 8
+
+	if predictor != predictorNone && (predictor != predictorHorizontal || format == sampleFormatFloat) {
+		return nil, fmt.Errorf("unsupported predictor %d", predictor)
+	}
+
+	if len(offsets) == 0 || len(offsets) != len(counts) || blockWidth == 0 || blockHeight == 0 {
+		return nil, fmt.Errorf("missing or inconsistent image data offsets")
+	}
+	blocksAcross := (width + blockWidth - 1) / blockWidth
+
+	var h = heightmap.New(width, height)
+	for block, offset := range offsets {
+		if offset+counts[block] > len(r.data) {
+			return nil, fmt.Errorf("image data block %d is truncated", block)
+		}
+		raw := r.data[offset : offset+counts[block]]
+		switch compression {
+		case compressionNone:
+		case compressionDeflate, compressionDeflateOld:
+			z, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				return nil, err
+			}
+			raw, err = ioutil.ReadAll(z)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported compression %d", compression)
+		}
+
+		originX := (block % blocksAcross) * blockWidth
+		originY := (block / blocksAcross) * blockHeight
+		for row := 0; row < blockHeight && row*blockWidth*bytesPerSample < len(raw); row++ {
+			var previous uint16
+			for col := 0; col < blockWidth; col++ {
+				at := (row*blockWidth + col) * bytesPerSample
+				if at+bytesPerSample > len(raw) {
+					break
+				}
+				value, bits := sample(raw[at:], previous)
+				if predictor == predictorHorizontal {
+					previous = bits
+				}
+				x, y := originX+col, originY+row
+				if x < width && y < height {
+					h.Set(x, y, value)
+				}
+			}
+		}
+	}
+
+	geo, err := r.georeference()
+	if err != nil {
+		return nil, err
+	}
+	h.Geo = geo
+	return h, nil
+}
+
+func (r *tiffReader) georeference() (*heightmap.Georeference, error) {
+	geo := heightmap.DefaultGeoreference()
+	scale, err := r.doubles(tagModelPixelScale)
+	if err != nil {
+		return nil, err
+	}
+	tie, err := r.doubles(tagModelTiepoint)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := r.ints(tagGeoKeyDirectory)
+	if err != nil {
+		return nil, err
+	}
+	if geo.GeoDoubles, err = r.doubles(tagGeoDoubleParams); err != nil {
+		return nil, err
+	}
+
+	if len(scale) >= 2 {
+		geo.CellSizeX, geo.CellSizeY = scale[0], scale[1]
+	}
+	if keys != nil {
+		geo.GeoKeys = make([]uint16, len(keys))
+		for i, k := range keys {
+			geo.GeoKeys[i] = uint16(k)
+		}
+	}
+	if len(tie) >= 6 {
+		// Raster point (i, j) maps to world point (x, y).
+		geo.OriginX = tie[3] - tie[0]*geo.CellSizeX
+		geo.OriginY = tie[4] + tie[1]*geo.CellSizeY
+		if rasterType(geo.GeoKeys) == rasterPixelIsPoint {
+			// The raster point is the centre of a cell, move the origin out to the corner.
+			geo.OriginX -= geo.CellSizeX / 2
+			geo.OriginY += geo.CellSizeY / 2
+		}
+	}
+	geo.GeoASCII = r.ascii(tagGeoASCIIParams)
+	if noData := strings.TrimSpace(r.ascii(tagGDALNoData)); noData != "" {
+		if value, err := strconv.ParseFloat(noData, 64); err == nil {
+			geo.NoData, geo.HasNoData = value, true
+		}
+	}
+	return geo, nil
+}
+
+/**
+ * The GTRasterTypeGeoKey in a GeoTIFF key directory, PixelIsArea when it isn't given.
+ */
+func rasterType(keys []uint16) uint16 {
+	// A four value header, the last being the key count, then four values per key.
+	if len(keys) < 4 {
+		return rasterPixelIsArea
+	}
+	for i := 0; i < int(keys[3]) && 4+i*4+3 < len(keys); i++ {
+		key := keys[4+i*4:]
+		// A location of 0 means the value is stored in the entry itself.
+		if key[0] == geoKeyRasterType && key[1] == 0 {
+			return key[3]
+		}
+	}
+	return rasterPixelIsArea
+}
+
+type tiffTag struct {
+	tag, kind uint16
+	count     uint32
+	value     []byte
+}
+
+/**
+ * Writes a single band, uncompressed, single strip GeoTIFF.
+ * Samples are converted back to elevations using the heightmap's georeference,
+ * maps without one are written with one unit per cell.
+ * Int16 needs a georeference, without one the samples are in [0, 1] and would round to 0 or 1.
+ */
+func WriteGeoTIFF(path string, h *heightmap.Heightmap, sampleType SampleType) error {
+	geo := h.Geo
+	if geo == nil {
+		if sampleType == SampleInt16 {
+			return fmt.Errorf("%s: terrain without real elevations can't be written as Int16, use Float32", path)
+		}
+		geo = heightmap.DefaultGeoreference()
+	}
+	order := binary.LittleEndian
+
+	var pixels bytes.Buffer
+	bits, format := 32, sampleFormatFloat
+	if sampleType == SampleInt16 {
+		bits, format = 16, sampleFormatInt
+	}
+	for _, v := range h.Data {
+		elevation := geo.Elevation(v)
+		if sampleType == SampleInt16 {
+			clamped := math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(elevation)))
+			_ = binary.Write(&pixels, order, int16(clamped))
+		} else {
+			_ = binary.Write(&pixels, order, float32(elevation))
+		}
+	}
+
+	short := func(tag uint16, values ...uint16) tiffTag {
+		var b bytes.Buffer
+		_ = binary.Write(&b, order, values)
+		return tiffTag{tag: tag, kind: typeShort, count: uint32(len(values)), value: b.Bytes()}
+	}
+	long := func(tag uint16, value uint32) tiffTag {
+		var b [4]byte
+		order.PutUint32(b[:], value)
+		return tiffTag{tag: tag, kind: typeLong, count: 1, value: b[:]}
+	}
+	double := func(tag uint16, values ...float64) tiffTag {
+		var b bytes.Buffer
+		_ = binary.Write(&b, order, values)
+		return tiffTag{tag: tag, kind: typeDouble, count: uint32(len(values)), value: b.Bytes()}
+	}
+	ascii := func(tag uint16, value string) tiffTag {
+		value += "\x00"
+		return tiffTag{tag: tag, kind: typeASCII, count: uint32(len(value)), value: []byte(value)}
+	}
+
+	geoKeys := geo.GeoKeys
+	if len(geoKeys) == 0 {
+		// Header (version 1.1.0, one key) followed by the raster type.
+		geoKeys = []uint16{1, 1, 0, 1, geoKeyRasterType, 0, 1, rasterPixelIsArea}
+	}
+	// Keys kept from a point registered DEM tie the centre of the first cell, not its corner.
+	tieX, tieY := geo.OriginX, geo.OriginY
+	if rasterType(geoKeys) == rasterPixelIsPoint {
+		tieX, tieY = tieX+geo.CellSizeX/2, tieY-geo.CellSizeY/2
+	}
+
+	tags := []tiffTag{
+		long(tagImageWidth, uint32(h.Width)),
+		long(tagImageLength, uint32(h.Height)),
+		short(tagBitsPerSample, uint16(bits)),
+		short(tagCompression, compressionNone),
+		short(tagPhotometric, 1),
+		long(tagStripOffsets, 0), // Patched once the layout is known.
+		short(tagSamplesPerPixel, 1),
+		long(tagRowsPerStrip, uint32(h.Height)),
+		long(tagStripByteCounts, uint32(pixels.Len())),
+		short(tagPlanarConfig, 1),
+		short(tagSampleFormat, uint16(format)),
+		double(tagModelPixelScale, geo.CellSizeX, geo.CellSizeY, 0),
+		double(tagModelTiepoint, 0, 0, 0, tieX, tieY, 0),
+		short(tagGeoKeyDirectory, geoKeys...),
+	}
+	if len(geo.GeoDoubles) > 0 {
+		tags = append(tags, double(tagGeoDoubleParams, geo.GeoDoubles...))
+	}
+	if geo.GeoASCII != "" {
+		tags = append(tags, ascii(tagGeoASCIIParams, geo.GeoASCII))
+	}
+	if geo.HasNoData {
+		tags = append(tags, ascii(tagGDALNoData, strconv.FormatFloat(geo.NoData, 'g', -1, 64)))
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].tag < tags[j].tag })
+
+	// Layout: header, IFD, out of line tag values, pixel data.
+	const headerSize = 8
+	ifdSize := 2 + len(tags)*tiffEntrySize + 4
+	valuesOffset := headerSize + ifdSize
+	var values bytes.Buffer
+	offsets := make([]uint32, len(tags))
+	for i, t := range tags {
+		if len(t.value) > 4 {
+			offsets[i] = uint32(valuesOffset + values.Len())
+			values.Write(t.value)
+			if values.Len()%2 == 1 {
+				values.WriteByte(0)
+			}
+		}
+	}
+	pixelOffset := uint32(valuesOffset + values.Len())
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	write := func(data interface{}) {
+		if err == nil {
+			err = binary.Write(w, order, data)
+		}
+	}
+
+	write([]byte(tiffLittleEndianMarker))
+	write(uint16(42))
+	write(uint32(headerSize))
+	write(uint16(len(tags)))
+	for i, t := range tags {
+		write(t.tag)
+		write(t.kind)
+		write(t.count)
+		var inline [4]byte
+		switch {
+		case t.tag == tagStripOffsets:
+			order.PutUint32(inline[:], pixelOffset)
+		case len(t.value) > 4:
+			order.PutUint32(inline[:], offsets[i])
+		default:
+			copy(inline[:], t.value)
+		}
+		write(inline)
+	}
+	write(uint32(0)) // No further IFDs.
+	write(values.Bytes())
+	write(pixels.Bytes())
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
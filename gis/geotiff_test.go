@@ -0,0 +1,392 @@
+package gis
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ob6160/Terrain/heightmap"
+)
+
+func testDEM() *heightmap.Heightmap {
+	h := heightmap.New(3, 2)
+	copy(h.Data, []float32{-12, 0, 3.5, 100, 250.25, 7})
+	h.Geo = &heightmap.Georeference{
+		OriginX: 500000, OriginY: 4000000, CellSizeX: 30, CellSizeY: 25, ZScale: 1,
+		NoData: -9999, HasNoData: true,
+	}
+	return h
+}
+
+func TestGeoTIFFRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geotiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		sampleType SampleType
+		want       []float32
+	}{
+		{SampleFloat32, []float32{-12, 0, 3.5, 100, 250.25, 7}},
+		// Rounded to the nearest whole unit.
+		{SampleInt16, []float32{-12, 0, 4, 100, 250, 7}},
+	}
+	for _, test := range tests {
+		t.Run(SampleTypeNames[test.sampleType], func(t *testing.T) {
+			path := filepath.Join(dir, SampleTypeNames[test.sampleType]+".tif")
+			if err := WriteDEM(path, testDEM(), test.sampleType); err != nil {
+				t.Fatal(err)
+			}
+			h, err := ReadDEM(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Width != 3 || h.Height != 2 {
+				t.Fatalf("read %dx%d, want 3x2", h.Width, h.Height)
+			}
+			for i, want := range test.want {
+				if h.Data[i] != want {
+					t.Errorf("sample %d is %v, want %v", i, h.Data[i], want)
+				}
+			}
+			geo, want := h.Geo, testDEM().Geo
+			if geo.OriginX != want.OriginX || geo.OriginY != want.OriginY ||
+				geo.CellSizeX != want.CellSizeX || geo.CellSizeY != want.CellSizeY {
+				t.Errorf("origin %v, %v with cells %v x %v, want %v, %v with cells %v x %v",
+					geo.OriginX, geo.OriginY, geo.CellSizeX, geo.CellSizeY,
+					want.OriginX, want.OriginY, want.CellSizeX, want.CellSizeY)
+			}
+			if !geo.HasNoData || geo.NoData != want.NoData {
+				t.Errorf("nodata %v (%v), want %v", geo.NoData, geo.HasNoData, want.NoData)
+			}
+			if len(geo.GeoKeys) == 0 {
+				t.Errorf("geo keys weren't kept")
+			}
+		})
+	}
+}
+
+/**
+ * Lays out a TIFF with its IFD straight after the header and out of line values after that,
+ * then `blocks` of image data. Offsets tags are filled in with where each block ends up.
+ */
+func buildTIFF(order binary.ByteOrder, tags []tiffTag, blocks [][]byte) []byte {
+	ifdSize := 2 + len(tags)*tiffEntrySize + 4
+	var valuesSize int
+	for _, t := range tags {
+		if len(t.value) > 4 {
+			valuesSize += len(t.value)
+		}
+	}
+	blockOffset := 8 + ifdSize + valuesSize
+
+	var out bytes.Buffer
+	if order == binary.BigEndian {
+		out.WriteString(tiffBigEndianMarker)
+	} else {
+		out.WriteString(tiffLittleEndianMarker)
+	}
+	binary.Write(&out, order, uint16(42))
+	binary.Write(&out, order, uint32(8))
+	binary.Write(&out, order, uint16(len(tags)))
+	valueOffset := 8 + ifdSize
+	for _, t := range tags {
+		if t.tag == tagStripOffsets || t.tag == tagTileOffsets {
+			var offsets bytes.Buffer
+			at := blockOffset
+			for _, block := range blocks {
+				binary.Write(&offsets, order, uint32(at))
+				at += len(block)
+			}
+			copy(t.value, offsets.Bytes())
+		}
+		binary.Write(&out, order, t.tag)
+		binary.Write(&out, order, t.kind)
+		binary.Write(&out, order, t.count)
+		var inline [4]byte
+		if len(t.value) > 4 {
+			order.PutUint32(inline[:], uint32(valueOffset))
+			valueOffset += len(t.value)
+		} else {
+			copy(inline[:], t.value)
+		}
+		out.Write(inline[:])
+	}
+	binary.Write(&out, order, uint32(0))
+	for _, t := range tags {
+		if len(t.value) > 4 {
+			out.Write(t.value)
+		}
+	}
+	for _, block := range blocks {
+		out.Write(block)
+	}
+	return out.Bytes()
+}
+
+func TestGeoTIFFTiledDeflate(t *testing.T) {
+	order := binary.BigEndian
+	short := func(tag uint16, value uint16) tiffTag {
+		var b [2]byte
+		order.PutUint16(b[:], value)
+		return tiffTag{tag: tag, kind: typeShort, count: 1, value: b[:]}
+	}
+	longs := func(tag uint16, values ...uint32) tiffTag {
+		b := make([]byte, 4*len(values))
+		for i, v := range values {
+			order.PutUint32(b[i*4:], v)
+		}
+		return tiffTag{tag: tag, kind: typeLong, count: uint32(len(values)), value: b}
+	}
+	// Two 2x2 tiles of int16 stored as differences from the left, the second half off the image.
+	tile := func(values ...int16) []byte {
+		var raw bytes.Buffer
+		binary.Write(&raw, order, values)
+		var compressed bytes.Buffer
+		z := zlib.NewWriter(&compressed)
+		z.Write(raw.Bytes())
+		z.Close()
+		return compressed.Bytes()
+	}
+	blocks := [][]byte{tile(-5, 15, 7, 0), tile(300, -300, -1, 1)}
+	data := buildTIFF(order, []tiffTag{
+		short(tagImageWidth, 3),
+		short(tagImageLength, 2),
+		short(tagBitsPerSample, 16),
+		short(tagCompression, compressionDeflate),
+		short(tagPredictor, predictorHorizontal),
+		short(tagTileWidth, 2),
+		short(tagTileLength, 2),
+		longs(tagTileOffsets, 0, 0),
+		longs(tagTileByteCounts, uint32(len(blocks[0])), uint32(len(blocks[1]))),
+		short(tagSampleFormat, sampleFormatInt),
+	}, blocks)
+
+	dir, err := ioutil.TempDir("", "geotiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tiled.tif")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := ReadGeoTIFF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float32{-5, 10, 300, 7, 7, -1}
+	for i := range want {
+		if h.Data[i] != want[i] {
+			t.Fatalf("got samples %v, want %v", h.Data, want)
+		}
+	}
+	// Without any georeferencing tags it has one unit per cell.
+	if h.Geo.CellSizeX != 1 || h.Geo.OriginX != 0 || h.Geo.HasNoData {
+		t.Errorf("got georeference %+v, want the default", h.Geo)
+	}
+}
+
+/**
+ * Start of the IFD entry for `tag` in a little endian TIFF with its IFD straight after the header.
+ */
+func entryAt(t *testing.T, data []byte, tag uint16) int {
+	count := int(binary.LittleEndian.Uint16(data[8:]))
+	for i := 0; i < count; i++ {
+		start := 10 + i*tiffEntrySize
+		if binary.LittleEndian.Uint16(data[start:]) == tag {
+			return start
+		}
+	}
+	t.Fatalf("no tag %d", tag)
+	return 0
+}
+
+func TestGeoTIFFMalformed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geotiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	valid := filepath.Join(dir, "valid.tif")
+	if err := WriteGeoTIFF(valid, testDEM(), SampleFloat32); err != nil {
+		t.Fatal(err)
+	}
+	original, err := ioutil.ReadFile(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setValue := func(tag uint16, value uint32) func(t *testing.T, data []byte) []byte {
+		return func(t *testing.T, data []byte) []byte {
+			entry := entryAt(t, data, tag)
+			if binary.LittleEndian.Uint16(data[entry+2:]) == typeShort {
+				binary.LittleEndian.PutUint16(data[entry+8:], uint16(value))
+			} else {
+				binary.LittleEndian.PutUint32(data[entry+8:], value)
+			}
+			return data
+		}
+	}
+	setType := func(tag, kind uint16) func(t *testing.T, data []byte) []byte {
+		return func(t *testing.T, data []byte) []byte {
+			binary.LittleEndian.PutUint16(data[entryAt(t, data, tag)+2:], kind)
+			return data
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(t *testing.T, data []byte) []byte
+		want   string
+	}{
+		{"too short", func(t *testing.T, data []byte) []byte { return data[:6] }, "too short to be a TIFF"},
+		{"bad byte order", func(t *testing.T, data []byte) []byte { copy(data, "XX"); return data }, "not a TIFF file"},
+		{"BigTIFF", func(t *testing.T, data []byte) []byte {
+			binary.LittleEndian.PutUint16(data[2:], 43)
+			return data
+		}, "unsupported TIFF version"},
+		{"IFD outside the file", func(t *testing.T, data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[4:], uint32(len(data)))
+			return data
+		}, "invalid IFD offset"},
+		{"truncated IFD", func(t *testing.T, data []byte) []byte { return data[:10+tiffEntrySize] }, "truncated IFD"},
+		{"unknown field type", setType(tagImageWidth, 99), "tag 256 has unknown field type 99"},
+		{"tag outside the file", func(t *testing.T, data []byte) []byte {
+			return setValue(tagModelTiepoint, uint32(len(data)))(t, data)
+		}, "tag 33922 points outside the file"},
+		{"integer tag of another type", setType(tagSamplesPerPixel, typeASCII), "tag 277 has type 2, expected an integer"},
+		{"no width", setValue(tagImageWidth, 0), "missing image dimensions"},
+		{"several bands", setValue(tagSamplesPerPixel, 3), "only single band images are supported, found 3 bands"},
+		{"unsupported sample type", setValue(tagBitsPerSample, 8), "unsupported sample type: 8 bit, format 3"},
+		{"predictor on floats", func(t *testing.T, data []byte) []byte {
+			// Reuse the photometric entry, it's a short the reader ignores.
+			binary.LittleEndian.PutUint16(data[entryAt(t, data, tagPhotometric):], tagPredictor)
+			return setValue(tagPredictor, predictorHorizontal)(t, data)
+		}, "unsupported predictor 2"},
+		{"unsupported compression", setValue(tagCompression, 5), "unsupported compression 5"},
+		{"truncated image data", func(t *testing.T, data []byte) []byte { return data[:len(data)-1] }, "image data block 0 is truncated"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.change(t, append([]byte(nil), original...))
+			path := filepath.Join(dir, "malformed.tif")
+			if err := ioutil.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ReadGeoTIFF(path)
+			if err == nil {
+				t.Fatalf("read without an error, want %q", test.want)
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %q, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestGeoTIFFSingleStripRows(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geotiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "strip.tif")
+	if err := WriteGeoTIFF(path, testDEM(), SampleFloat32); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The "whole image in one strip" value many writers use.
+	binary.LittleEndian.PutUint32(data[entryAt(t, data, tagRowsPerStrip)+8:], 0xFFFFFFFF)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := ReadGeoTIFF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testDEM()
+	for i := range want.Data {
+		if h.Data[i] != want.Data[i] {
+			t.Fatalf("got samples %v, want %v", h.Data, want.Data)
+		}
+	}
+}
+
+func TestGeoTIFFInt16NeedsElevations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geotiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := testDEM()
+	h.Geo = nil
+	path := filepath.Join(dir, "generated.tif")
+	if err := WriteGeoTIFF(path, h, SampleInt16); err == nil || !strings.Contains(err.Error(), "use Float32") {
+		t.Errorf("got error %v, want Int16 refused", err)
+	}
+	if err := WriteGeoTIFF(path, h, SampleFloat32); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGeoTIFFRasterType(t *testing.T) {
+	dir, err := ioutil.TempDir("", "geotiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name string
+		keys []uint16
+		// Where the written tiepoint puts the first cell, its corner or its centre.
+		tieX, tieY float64
+	}{
+		{"no keys", nil, 500000, 4000000},
+		{"pixel is area", []uint16{1, 1, 0, 1, geoKeyRasterType, 0, 1, rasterPixelIsArea}, 500000, 4000000},
+		{"pixel is point", []uint16{1, 1, 0, 2, 1024, 0, 1, 1, geoKeyRasterType, 0, 1, rasterPixelIsPoint}, 500015, 3999987.5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := testDEM()
+			want.Geo.GeoKeys = test.keys
+			path := filepath.Join(dir, "dem.tif")
+			if err := WriteGeoTIFF(path, want, SampleFloat32); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tie := data[binary.LittleEndian.Uint32(data[entryAt(t, data, tagModelTiepoint)+8:]):]
+			x := math.Float64frombits(binary.LittleEndian.Uint64(tie[24:]))
+			y := math.Float64frombits(binary.LittleEndian.Uint64(tie[32:]))
+			if x != test.tieX || y != test.tieY {
+				t.Errorf("tiepoint at %v, %v, want %v, %v", x, y, test.tieX, test.tieY)
+			}
+
+			// Read back, the origin is the corner of the first cell whichever way it was tied.
+			h, err := ReadGeoTIFF(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if h.Geo.OriginX != want.Geo.OriginX || h.Geo.OriginY != want.Geo.OriginY {
+				t.Errorf("origin %v, %v, want %v, %v", h.Geo.OriginX, h.Geo.OriginY, want.Geo.OriginX, want.Geo.OriginY)
+			}
+		})
+	}
+}
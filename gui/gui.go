@@ -21,6 +21,7 @@ type State struct {
 	CameraWindowOpen, SimulationWindowOpen, TerrainWindowOpen, GPUDebugWindowOpen bool
 	ButtonsPressed                                                                [3]bool
 	Time                                                                          float64
+	UIScale                                                                       float32 // See GUI.SetUIScale
 }
 
 type GUI struct {
@@ -29,6 +30,53 @@ type GUI struct {
 	renderer *renderers.OpenGL3
 	state    *State
 	io       imgui.IO
+	input    Input
+	scroll   float32    // Accumulated between updates
+	pressed  []KeyPress // Accumulated between updates
+	// Window size in screen coordinates, and its framebuffer in pixels. They differ on HiDPI displays.
+	width, height                       int
+	framebufferWidth, framebufferHeight int
+	// Where the window was before going fullscreen, to go back to.
+	windowedX, windowedY          int
+	windowedWidth, windowedHeight int
+	uiScale                       float32
+}
+
+// Smallest the window can be resized to.
+const (
+	minWindowWidth  = 320
+	minWindowHeight = 240
+)
+
+/**
+ * Mouse state for the scene, gathered once per frame in Update.
+ * The WantCapture flags are set when imgui is using the mouse or keyboard, the scene should ignore them then.
+ */
+type Input struct {
+	MouseX, MouseY           float32
+	MouseDeltaX, MouseDeltaY float32
+	Scroll                   float32
+	WantCaptureMouse         bool
+	WantCaptureKeyboard      bool
+	// Keys pressed (or repeated) since the last update, for shortcuts.
+	KeysPressed []KeyPress
+}
+
+type KeyPress struct {
+	Key  glfw.Key
+	Mods glfw.ModifierKey
+}
+
+/**
+ * Whether a key was pressed this frame with exactly the given modifiers held.
+ */
+func (i Input) Pressed(key glfw.Key, mods glfw.ModifierKey) bool {
+	for _, press := range i.KeysPressed {
+		if press.Key == key && press.Mods == mods {
+			return true
+		}
+	}
+	return false
 }
 
 func NewGUI(windowWidth, windowHeight int) (*GUI, error) {
@@ -47,8 +95,13 @@ func NewGUI(windowWidth, windowHeight int) (*GUI, error) {
 
 	// Setup glew, glfw
 	g.window = g.InitialiseGLFW(windowWidth, windowHeight)
+	g.width, g.height = g.window.GetSize()
+	g.framebufferWidth, g.framebufferHeight = g.window.GetFramebufferSize()
+	gl.Viewport(0, 0, int32(g.framebufferWidth), int32(g.framebufferHeight))
 
 	g.installCallbacks()
+	g.uiScale, g.state.UIScale = 1, 1
+	g.SetUIScale(monitorScale(glfw.GetPrimaryMonitor()))
 
 	// Setup imgui renderer
 	renderer, err := renderers.NewOpenGL3(g.io)
@@ -68,23 +121,147 @@ func (g *GUI) SwapBuffers() {
 	g.window.SwapBuffers()
 }
 
+/**
+ * Window size in screen coordinates, those of the mouse.
+ */
 func (g *GUI) GetSize() (int, int) {
-	return g.window.GetSize()
+	return g.width, g.height
+}
+
+/**
+ * Size in pixels of what's drawn to the window, larger than GetSize on HiDPI displays. Zero while minimised.
+ */
+func (g *GUI) FramebufferSize() (int, int) {
+	return g.framebufferWidth, g.framebufferHeight
+}
+
+func (g *GUI) Fullscreen() bool {
+	return g.window.GetMonitor() != nil
+}
+
+/**
+ * Switches between fullscreen on the primary monitor, at its current video mode, and the window as it was.
+ */
+func (g *GUI) SetFullscreen(fullscreen bool) {
+	if fullscreen == g.Fullscreen() {
+		return
+	}
+	if fullscreen {
+		g.windowedX, g.windowedY = g.window.GetPos()
+		g.windowedWidth, g.windowedHeight = g.window.GetSize()
+		monitor := glfw.GetPrimaryMonitor()
+		mode := monitor.GetVideoMode()
+		g.window.SetMonitor(monitor, 0, 0, mode.Width, mode.Height, mode.RefreshRate)
+	} else {
+		g.window.SetMonitor(nil, g.windowedX, g.windowedY, g.windowedWidth, g.windowedHeight, 0)
+	}
+}
+
+func (g *GUI) UIScale() float32 {
+	return g.uiScale
+}
+
+/**
+ * Scales the UI's text and spacing, for displays with more pixels to the inch than usual.
+ * Spacing is scaled by PushStyleScale with State.UIScale.
+ */
+func (g *GUI) SetUIScale(scale float32) {
+	if scale <= 0 || scale == g.uiScale {
+		return
+	}
+	g.io.SetFontGlobalScale(scale)
+	g.uiScale = scale
+	g.state.UIScale = scale
+}
+
+/**
+ * ImGui's default style sizes, at a scale of 1. The style can't be read back from the wrapper,
+ * and scaling it in place rounds the sizes down each time, so they are scaled from these instead.
+ */
+var baseStyle = []struct {
+	id     imgui.StyleVarID
+	value  imgui.Vec2
+	isVec2 bool
+}{
+	{imgui.StyleVarWindowPadding, imgui.Vec2{X: 8, Y: 8}, true},
+	{imgui.StyleVarWindowRounding, imgui.Vec2{X: 7}, false},
+	{imgui.StyleVarWindowMinSize, imgui.Vec2{X: 32, Y: 32}, true},
+	{imgui.StyleVarFramePadding, imgui.Vec2{X: 4, Y: 3}, true},
+	{imgui.StyleVarItemSpacing, imgui.Vec2{X: 8, Y: 4}, true},
+	{imgui.StyleVarItemInnerSpacing, imgui.Vec2{X: 4, Y: 4}, true},
+	{imgui.StyleVarIndentSpacing, imgui.Vec2{X: 21}, false},
+	{imgui.StyleVarScrollbarSize, imgui.Vec2{X: 14}, false},
+	{imgui.StyleVarScrollbarRounding, imgui.Vec2{X: 9}, false},
+	{imgui.StyleVarGrabMinSize, imgui.Vec2{X: 10}, false},
+	{imgui.StyleVarTabRounding, imgui.Vec2{X: 4}, false},
+}
+
+/**
+ * Pushes the style sizes scaled from ImGui's defaults, between NewFrame and PopStyleScale.
+ */
+func PushStyleScale(scale float32) {
+	scaled := func(v float32) float32 {
+		return float32(math.Floor(float64(v * scale)))
+	}
+	for _, style := range baseStyle {
+		if style.isVec2 {
+			imgui.PushStyleVarVec2(style.id, imgui.Vec2{X: scaled(style.value.X), Y: scaled(style.value.Y)})
+		} else {
+			imgui.PushStyleVarFloat(style.id, scaled(style.value.X))
+		}
+	}
+}
+
+func PopStyleScale() {
+	imgui.PopStyleVarV(len(baseStyle))
+}
+
+/**
+ * A UI scale for the monitor's pixel density, in steps of a half, taking 96 dpi as 1.
+ * Monitors that don't report their size get 1.
+ */
+func monitorScale(monitor *glfw.Monitor) float32 {
+	if monitor == nil {
+		return 1
+	}
+	widthMM, _ := monitor.GetPhysicalSize()
+	mode := monitor.GetVideoMode()
+	if widthMM <= 0 || mode == nil {
+		return 1
+	}
+	dpi := float64(mode.Width) / (float64(widthMM) / 25.4)
+	scale := math.Round(dpi/96*2) / 2
+	return float32(math.Max(1, math.Min(scale, 3)))
+}
+
+/**
+ * Scene input for this frame.
+ */
+func (g *GUI) Input() Input {
+	return g.input
+}
+
+/**
+ * Whether a mouse button (0 left, 1 right, 2 middle) is held down.
+ */
+func (g *GUI) MouseButtonDown(button int) bool {
+	return g.window.GetMouseButton(glfwButtonIDByIndex[button]) == glfw.Press
+}
+
+func (g *GUI) KeyDown(key glfw.Key) bool {
+	return g.window.GetKey(key) == glfw.Press
 }
 
 func (g *GUI) Render(renderUI func(state *State)) {
-	w, h := g.window.GetSize()
-	displaySize := [2]float32{float32(w), float32(h)}
-	fw, fh := g.window.GetFramebufferSize()
-	fbSize := [2]float32{float32(fw), float32(fh)}
+	displaySize := [2]float32{float32(g.width), float32(g.height)}
+	fbSize := [2]float32{float32(g.framebufferWidth), float32(g.framebufferHeight)}
 	renderUI(g.state)
 	g.renderer.Render(displaySize, fbSize, imgui.RenderedDrawData())
 }
 
 func (g *GUI) Update() {
 	state := *g.state
-	w, h := g.window.GetSize()
-	g.io.SetDisplaySize(imgui.Vec2{X: float32(w), Y: float32(h)})
+	g.io.SetDisplaySize(imgui.Vec2{X: float32(g.width), Y: float32(g.height)})
 
 	// Setup Time step
 	currentTime := glfw.GetTime()
@@ -97,7 +274,11 @@ func (g *GUI) Update() {
 	if g.window.GetAttrib(glfw.Focused) != 0 {
 		x, y := g.window.GetCursorPos()
 		g.io.SetMousePosition(imgui.Vec2{X: float32(x), Y: float32(y)})
+		g.input.MouseDeltaX = float32(x) - g.input.MouseX
+		g.input.MouseDeltaY = float32(y) - g.input.MouseY
+		g.input.MouseX, g.input.MouseY = float32(x), float32(y)
 	} else {
+		g.input.MouseDeltaX, g.input.MouseDeltaY = 0, 0
 		g.io.SetMousePosition(imgui.Vec2{X: -math.MaxFloat32, Y: -math.MaxFloat32})
 	}
 
@@ -106,6 +287,14 @@ func (g *GUI) Update() {
 		g.io.SetMouseButtonDown(i, down)
 		state.ButtonsPressed[i] = false
 	}
+
+	// Capture flags are from the last imgui frame, the latest available before this one is built.
+	g.input.Scroll = g.scroll
+	g.scroll = 0
+	g.input.KeysPressed = g.pressed
+	g.pressed = nil
+	g.input.WantCaptureMouse = g.io.WantCaptureMouse()
+	g.input.WantCaptureKeyboard = g.io.WantCaptureKeyboard()
 }
 
 func (g *GUI) Dispose() {
@@ -119,7 +308,7 @@ func (g *GUI) InitialiseGLFW(windowWidth, windowHeight int) *glfw.Window {
 	if err := glfw.Init(); err != nil {
 		log.Fatalln("failed to initialize GLFW:", err)
 	}
-	glfw.WindowHint(glfw.Resizable, glfw.False)
+	glfw.WindowHint(glfw.Resizable, glfw.True)
 	glfw.WindowHint(glfw.ContextVersionMajor, 4)
 	glfw.WindowHint(glfw.ContextVersionMinor, 3)
 	glfw.WindowHint(glfw.OpenGLProfile, glfw.OpenGLCoreProfile)
@@ -129,6 +318,7 @@ func (g *GUI) InitialiseGLFW(windowWidth, windowHeight int) *glfw.Window {
 		panic(err)
 	}
 	window.MakeContextCurrent()
+	window.SetSizeLimits(minWindowWidth, minWindowHeight, glfw.DontCare, glfw.DontCare)
 	// Initialize Glow
 	if err := gl.Init(); err != nil {
 		panic(err)
@@ -152,10 +342,23 @@ func (g *GUI) installCallbacks() {
 	g.window.SetScrollCallback(g.mouseScrollChange)
 	g.window.SetKeyCallback(g.keyChange)
 	g.window.SetCharCallback(g.charChange)
+	g.window.SetSizeCallback(g.sizeChange)
+	g.window.SetFramebufferSizeCallback(g.framebufferSizeChange)
+}
+
+func (g *GUI) sizeChange(w *glfw.Window, width int, height int) {
+	g.width, g.height = width, height
+	g.io.SetDisplaySize(imgui.Vec2{X: float32(width), Y: float32(height)})
+}
+
+func (g *GUI) framebufferSizeChange(w *glfw.Window, width int, height int) {
+	g.framebufferWidth, g.framebufferHeight = width, height
+	gl.Viewport(0, 0, int32(width), int32(height))
 }
 
 func (g *GUI) mouseScrollChange(w *glfw.Window, xoff float64, yoff float64) {
 	g.io.AddMouseWheelDelta(float32(xoff), float32(yoff))
+	g.scroll += float32(yoff)
 }
 
 var glfwButtonIndexByID = map[glfw.MouseButton]int{
@@ -182,6 +385,9 @@ func (g *GUI) keyChange(w *glfw.Window, key glfw.Key, scancode int, action glfw.
 	if action == glfw.Press {
 		g.io.KeyPress(int(key))
 	}
+	if action == glfw.Press || action == glfw.Repeat {
+		g.pressed = append(g.pressed, KeyPress{Key: key, Mods: mods})
+	}
 	if action == glfw.Release {
 		g.io.KeyRelease(int(key))
 	}
@@ -259,6 +259,7 @@ const int RED = 1;
 const int GREEN = 2;
 const int BLUE = 4;
 const int ALPHA = 8;
+const int COLOUR = 16;
 
 void main()
 {
@@ -280,7 +281,11 @@ void main()
 		imageMask = vec4(pixel.a);
 	}
 
-	if (ImageType >= 1)
+	if ((ImageType & COLOUR) >= 1)
+	{
+		Out_Color = Frag_Color * pixel;
+	}
+	else if (ImageType >= 1)
 	{
 		Out_Color = Frag_Color * imageMask;
 	}
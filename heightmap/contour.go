@@ -0,0 +1,187 @@
+package heightmap
+
+import (
+	"math"
+)
+
+/**
+ * A position on the heightmap in cells, the centre of cell (x, y) is at (x, y).
+ */
+type Point struct {
+	X, Y float32
+}
+
+/**
+ * One line of constant height. Closed contours end where they started,
+ * open ones run from one edge of the map to another.
+ */
+type Contour struct {
+	Level float32
+	// Index contours are the emphasised, labelled ones, every IndexEvery levels.
+	Index  bool
+	Closed bool
+	Points []Point
+}
+
+/**
+ * Contours are drawn at Base + k * Interval for every whole k inside the map's range.
+ * Every IndexEvery'th level (counting from Base) is an index contour, zero turns them off.
+ */
+type ContourOptions struct {
+	Interval, Base float32
+	IndexEvery     int
+}
+
+/**
+ * Traces the contours of the heightmap with marching squares.
+ */
+func (h *Heightmap) Contours(opts ContourOptions) []Contour {
+	if opts.Interval <= 0 || h.Width < 2 || h.Height < 2 {
+		return nil
+	}
+	min, max := h.Range()
+	first := int(math.Ceil(float64((min - opts.Base) / opts.Interval)))
+	last := int(math.Floor(float64((max - opts.Base) / opts.Interval)))
+
+	var contours []Contour
+	for k := first; k <= last; k++ {
+		level := opts.Base + float32(k)*opts.Interval
+		index := opts.IndexEvery > 0 && k%opts.IndexEvery == 0
+		for _, c := range h.contoursAt(level) {
+			c.Index = index
+			contours = append(contours, c)
+		}
+	}
+	return contours
+}
+
+/**
+ * A piece of contour crossing one square of four samples, between two of its edges.
+ */
+type contourSegment struct {
+	a, b int
+}
+
+// Edges crossed for each case of the four corners being above the level, bit 0 is the corner at (x, y),
+// then (x+1, y), (x+1, y+1) and (x, y+1). Edges are numbered 0 top, 1 right, 2 bottom, 3 left.
+// The saddles (5 and 10) are listed with the centre below the level, and flipped when it isn't.
+var contourCases = [16][][2]int{
+	{}, {{3, 0}}, {{0, 1}}, {{3, 1}},
+	{{1, 2}}, {{3, 0}, {1, 2}}, {{0, 2}}, {{3, 2}},
+	{{2, 3}}, {{2, 0}}, {{0, 1}, {2, 3}}, {{2, 1}},
+	{{1, 3}}, {{1, 0}}, {{0, 3}}, {},
+}
+
+func (h *Heightmap) contoursAt(level float32) []Contour {
+	points := make(map[int]Point)
+	var segments []contourSegment
+
+	// Crossings are keyed by the grid edge they lie on, so neighbouring squares share them.
+	crossing := func(x0, y0, x1, y1 int) int {
+		key := (y0*h.Width + x0) * 2
+		if x0 == x1 {
+			key++
+		}
+		if _, ok := points[key]; !ok {
+			a, b := h.At(x0, y0), h.At(x1, y1)
+			t := (level - a) / (b - a)
+			points[key] = Point{float32(x0) + t*float32(x1-x0), float32(y0) + t*float32(y1-y0)}
+		}
+		return key
+	}
+
+	for y := 0; y < h.Height-1; y++ {
+		for x := 0; x < h.Width-1; x++ {
+			corners := [4]float32{h.At(x, y), h.At(x+1, y), h.At(x+1, y+1), h.At(x, y+1)}
+			var square int
+			for i, value := range corners {
+				if value >= level {
+					square |= 1 << uint(i)
+				}
+			}
+			pairs := contourCases[square]
+			if square == 5 || square == 10 {
+				centre := (corners[0] + corners[1] + corners[2] + corners[3]) / 4
+				if centre >= level {
+					pairs = contourCases[15-square]
+				}
+			}
+			for _, pair := range pairs {
+				var keys [2]int
+				for i, edge := range pair {
+					switch edge {
+					case 0:
+						keys[i] = crossing(x, y, x+1, y)
+					case 1:
+						keys[i] = crossing(x+1, y, x+1, y+1)
+					case 2:
+						keys[i] = crossing(x, y+1, x+1, y+1)
+					case 3:
+						keys[i] = crossing(x, y, x, y+1)
+					}
+				}
+				segments = append(segments, contourSegment{keys[0], keys[1]})
+			}
+		}
+	}
+	return joinSegments(level, segments, points)
+}
+
+/**
+ * Chains segments that share crossings into polylines.
+ */
+func joinSegments(level float32, segments []contourSegment, points map[int]Point) []Contour {
+	ends := make(map[int][]int, len(points))
+	for i, s := range segments {
+		ends[s.a] = append(ends[s.a], i)
+		ends[s.b] = append(ends[s.b], i)
+	}
+	used := make([]bool, len(segments))
+
+	trace := func(start, from int) Contour {
+		keys := []int{from}
+		current, at := start, from
+		for {
+			used[current] = true
+			next := segments[current].a
+			if next == at {
+				next = segments[current].b
+			}
+			keys = append(keys, next)
+			found := false
+			for _, s := range ends[next] {
+				if !used[s] {
+					current, at, found = s, next, true
+					break
+				}
+			}
+			if !found {
+				break
+			}
+		}
+		var c = Contour{Level: level, Closed: keys[0] == keys[len(keys)-1], Points: make([]Point, len(keys))}
+		for i, key := range keys {
+			c.Points[i] = points[key]
+		}
+		return c
+	}
+
+	var contours []Contour
+	// Open lines start at the edge of the map, whatever's left over is a loop.
+	for i, s := range segments {
+		if used[i] {
+			continue
+		}
+		if len(ends[s.a]) == 1 {
+			contours = append(contours, trace(i, s.a))
+		} else if len(ends[s.b]) == 1 {
+			contours = append(contours, trace(i, s.b))
+		}
+	}
+	for i, s := range segments {
+		if !used[i] {
+			contours = append(contours, trace(i, s.a))
+		}
+	}
+	return contours
+}
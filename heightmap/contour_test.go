@@ -0,0 +1,177 @@
+package heightmap
+
+import (
+	"sort"
+	"testing"
+)
+
+func fromRows(rows ...[]float32) *Heightmap {
+	h := New(len(rows[0]), len(rows))
+	for y, row := range rows {
+		for x, value := range row {
+			h.Set(x, y, value)
+		}
+	}
+	return h
+}
+
+/**
+ * The edge of the unit square a crossing lies on: 0 top, 1 right, 2 bottom, 3 left.
+ */
+func squareEdge(t *testing.T, p Point) int {
+	switch {
+	case p.Y == 0:
+		return 0
+	case p.X == 1:
+		return 1
+	case p.Y == 1:
+		return 2
+	case p.X == 0:
+		return 3
+	}
+	t.Fatalf("point %v isn't on an edge of the square", p)
+	return -1
+}
+
+/**
+ * The edges each contour joins, as "ab" with a < b, sorted.
+ */
+func joinedEdges(t *testing.T, contours []Contour) []string {
+	var joined []string
+	for _, c := range contours {
+		if len(c.Points) != 2 {
+			t.Fatalf("contour across one square has %d points, want 2", len(c.Points))
+		}
+		a, b := squareEdge(t, c.Points[0]), squareEdge(t, c.Points[1])
+		if a > b {
+			a, b = b, a
+		}
+		joined = append(joined, string(rune('0'+a))+string(rune('0'+b)))
+	}
+	sort.Strings(joined)
+	return joined
+}
+
+func TestContourCases(t *testing.T) {
+	tests := []struct {
+		name string
+		// Corners (0, 0), (1, 0), (1, 1) and (0, 1).
+		corners [4]float32
+		level   float32
+		want    []string
+	}{
+		{"none above", [4]float32{0, 0, 0, 0}, 0.5, nil},
+		{"all above", [4]float32{1, 1, 1, 1}, 0.5, nil},
+		{"top left", [4]float32{1, 0, 0, 0}, 0.5, []string{"03"}},
+		{"top right", [4]float32{0, 1, 0, 0}, 0.5, []string{"01"}},
+		{"bottom right", [4]float32{0, 0, 1, 0}, 0.5, []string{"12"}},
+		{"bottom left", [4]float32{0, 0, 0, 1}, 0.5, []string{"23"}},
+		{"top half", [4]float32{1, 1, 0, 0}, 0.5, []string{"13"}},
+		{"right half", [4]float32{0, 1, 1, 0}, 0.5, []string{"02"}},
+		{"all but top left", [4]float32{0, 1, 1, 1}, 0.5, []string{"03"}},
+		{"all but bottom right", [4]float32{1, 1, 0, 1}, 0.5, []string{"12"}},
+		// Saddles: with the centre below the level the high corners are cut off on their own,
+		// with it above they're joined across the middle and the low corners are cut off instead.
+		{"saddle 5, centre below", [4]float32{1, 0, 1, 0}, 0.6, []string{"03", "12"}},
+		{"saddle 5, centre above", [4]float32{1, 0, 1, 0}, 0.4, []string{"01", "23"}},
+		{"saddle 10, centre below", [4]float32{0, 1, 0, 1}, 0.6, []string{"01", "23"}},
+		{"saddle 10, centre above", [4]float32{0, 1, 0, 1}, 0.4, []string{"03", "12"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := test.corners
+			h := fromRows([]float32{c[0], c[1]}, []float32{c[3], c[2]})
+			got := joinedEdges(t, h.contoursAt(test.level))
+			if len(got) != len(test.want) {
+				t.Fatalf("got edges %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("got edges %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestContourCrossingInterpolated(t *testing.T) {
+	h := fromRows([]float32{0, 4}, []float32{0, 4})
+	contours := h.contoursAt(1)
+	if len(contours) != 1 {
+		t.Fatalf("got %d contours, want 1", len(contours))
+	}
+	for _, p := range contours[0].Points {
+		if p.X != 0.25 {
+			t.Errorf("crossing at x %v, want 0.25", p.X)
+		}
+	}
+}
+
+func TestContourJoining(t *testing.T) {
+	tests := []struct {
+		name   string
+		h      *Heightmap
+		closed bool
+		points int
+	}{
+		// A peak in the middle is ringed by one loop through the four edges around it, back to the start.
+		{"peak", fromRows(
+			[]float32{0, 0, 0},
+			[]float32{0, 1, 0},
+			[]float32{0, 0, 0},
+		), true, 5},
+		// A slope is crossed by one line from edge to edge.
+		{"slope", fromRows(
+			[]float32{0, 1, 2},
+			[]float32{0, 1, 2},
+			[]float32{0, 1, 2},
+		), false, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			contours := test.h.contoursAt(0.5)
+			if len(contours) != 1 {
+				t.Fatalf("got %d contours, want 1", len(contours))
+			}
+			c := contours[0]
+			if c.Closed != test.closed || len(c.Points) != test.points {
+				t.Errorf("got closed %v with %d points, want closed %v with %d", c.Closed, len(c.Points), test.closed, test.points)
+			}
+			if c.Closed && c.Points[0] != c.Points[len(c.Points)-1] {
+				t.Errorf("closed contour ends at %v, not its start %v", c.Points[len(c.Points)-1], c.Points[0])
+			}
+		})
+	}
+}
+
+func TestContourLevels(t *testing.T) {
+	h := fromRows(
+		[]float32{0, 1, 2, 3, 4},
+		[]float32{0, 1, 2, 3, 4},
+	)
+	tests := []struct {
+		name  string
+		opts  ContourOptions
+		want  []float32
+		index []bool
+	}{
+		{"every level", ContourOptions{Interval: 1, Base: 0.5, IndexEvery: 2},
+			[]float32{0.5, 1.5, 2.5, 3.5}, []bool{true, false, true, false}},
+		{"no index contours", ContourOptions{Interval: 2, Base: 0.5},
+			[]float32{0.5, 2.5}, []bool{false, false}},
+		{"no interval", ContourOptions{Interval: 0}, nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			contours := h.Contours(test.opts)
+			if len(contours) != len(test.want) {
+				t.Fatalf("got %d contours, want %d", len(contours), len(test.want))
+			}
+			for i, c := range contours {
+				if c.Level != test.want[i] || c.Index != test.index[i] {
+					t.Errorf("contour %d at %v (index %v), want %v (index %v)", i, c.Level, c.Index, test.want[i], test.index[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package heightmap
+
+import (
+	"github.com/ob6160/Terrain/generators"
+)
+
+/**
+ * Places a heightmap in world coordinates.
+ *
+ * The origin is the top-left corner of cell (0, 0), x grows east and y grows south,
+ * so northings decrease by CellSizeY for each row.
+ * Samples are stored normalised, the real elevation is `value * ZScale + ZOffset`.
+ */
+type Georeference struct {
+	OriginX, OriginY     float64
+	CellSizeX, CellSizeY float64
+	ZScale, ZOffset      float64
+	NoData               float64
+	HasNoData            bool
+	// Raw GeoTIFF key directory and parameters, kept so the coordinate system survives a round trip.
+	GeoKeys    []uint16
+	GeoDoubles []float64
+	GeoASCII   string
+}
+
+/**
+ * The georeference used for terrain that didn't come from a DEM: one unit per cell, origin at zero.
+ */
+func DefaultGeoreference() *Georeference {
+	return &Georeference{CellSizeX: 1, CellSizeY: 1, ZScale: 1}
+}
+
+/**
+ * Implemented by generators backed by real world data.
+ */
+type Georeferenced interface {
+	Georeference() *Georeference
+}
+
+/**
+ * Returns the generator's georeference, or nil if it doesn't have one.
+ */
+func GeoreferenceOf(generator generators.TerrainGenerator) *Georeference {
+	if g, ok := generator.(Georeferenced); ok {
+		return g.Georeference()
+	}
+	return nil
+}
+
+/**
+ * Converts a stored sample into an elevation.
+ */
+func (g *Georeference) Elevation(value float32) float64 {
+	return float64(value)*g.ZScale + g.ZOffset
+}
+
+/**
+ * Copy of the georeference for the same extent sampled at a different resolution.
+ */
+func (g *Georeference) Resampled(fromWidth, fromHeight, toWidth, toHeight int) *Georeference {
+	var r = *g
+	r.CellSizeX = g.CellSizeX * float64(fromWidth) / float64(toWidth)
+	r.CellSizeY = g.CellSizeY * float64(fromHeight) / float64(toHeight)
+	return &r
+}
@@ -0,0 +1,175 @@
+package heightmap
+
+import (
+	"math"
+
+	"github.com/ob6160/Terrain/generators"
+	"github.com/ob6160/Terrain/utils"
+)
+
+/**
+ * A single channel grid of samples, stored row by row.
+ * Cell (x, y) matches texel (x, y) of the GPU state textures and
+ * `utils.ToIndex(x, y, width)` in the generators and CPU eroder.
+ * Geo is nil unless the map came from (or was derived from) a DEM.
+ */
+type Heightmap struct {
+	Width, Height int
+	Data          []float32
+	Geo           *Georeference
+}
+
+func New(width, height int) *Heightmap {
+	return &Heightmap{
+		Width:  width,
+		Height: height,
+		Data:   make([]float32, width*height),
+	}
+}
+
+/**
+ * Copies the current output of a generator into a new heightmap.
+ */
+func FromGenerator(generator generators.TerrainGenerator) *Heightmap {
+	width, height := generator.Dimensions()
+	h := FromGrid(generator.Heightmap(), width, height)
+	h.Geo = GeoreferenceOf(generator)
+	return h
+}
+
+/**
+ * Converts a grid using the `utils.ToIndex` layout (as used by the generators and CPU eroder).
+ */
+func FromGrid(grid []float32, width, height int) *Heightmap {
+	var h = New(width, height)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			index := utils.ToIndex(x, y, width)
+			if index < len(grid) {
+				h.Data[h.Index(x, y)] = grid[index]
+			}
+		}
+	}
+	return h
+}
+
+/**
+ * Extracts one channel of a packed RGBA buffer (as read back from the GPU state textures).
+ */
+func FromPacked(packed []float32, width, height, channel int) *Heightmap {
+	var h = New(width, height)
+	for i := range h.Data {
+		h.Data[i] = packed[i*4+channel]
+	}
+	return h
+}
+
+func (h *Heightmap) Index(x, y int) int {
+	return x + y*h.Width
+}
+
+/**
+ * Returns the sample at (x, y), clamping coordinates to the edges of the map.
+ */
+func (h *Heightmap) At(x, y int) float32 {
+	if x < 0 {
+		x = 0
+	} else if x >= h.Width {
+		x = h.Width - 1
+	}
+	if y < 0 {
+		y = 0
+	} else if y >= h.Height {
+		y = h.Height - 1
+	}
+	return h.Data[h.Index(x, y)]
+}
+
+func (h *Heightmap) Set(x, y int, value float32) {
+	h.Data[h.Index(x, y)] = value
+}
+
+/**
+ * Bilinearly interpolated lookup in cell coordinates.
+ */
+func (h *Heightmap) Sample(fx, fy float32) float32 {
+	x0 := int(math.Floor(float64(fx)))
+	y0 := int(math.Floor(float64(fy)))
+	dx := fx - float32(x0)
+	dy := fy - float32(y0)
+
+	q00 := h.At(x0, y0)
+	q10 := h.At(x0+1, y0)
+	q01 := h.At(x0, y0+1)
+	q11 := h.At(x0+1, y0+1)
+
+	return q00*(1-dx)*(1-dy) +
+		q10*dx*(1-dy) +
+		q01*(1-dx)*dy +
+		q11*dx*dy
+}
+
+/**
+ * Returns the smallest and largest sample in the map.
+ */
+func (h *Heightmap) Range() (min, max float32) {
+	min = float32(math.Inf(1))
+	max = float32(math.Inf(-1))
+	for _, v := range h.Data {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	return min, max
+}
+
+func (h *Heightmap) Copy() *Heightmap {
+	var c = New(h.Width, h.Height)
+	copy(c.Data, h.Data)
+	c.Geo = h.Geo
+	return c
+}
+
+/**
+ * Bilinearly resamples the map to a new resolution covering the same extent.
+ */
+func (h *Heightmap) Resized(width, height int) *Heightmap {
+	var r = New(width, height)
+	scaleX := float32(h.Width) / float32(width)
+	scaleY := float32(h.Height) / float32(height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Sample at cell centres so the edges of both grids line up.
+			fx := (float32(x)+0.5)*scaleX - 0.5
+			fy := (float32(y)+0.5)*scaleY - 0.5
+			r.Set(x, y, h.Sample(fx, fy))
+		}
+	}
+	if h.Geo != nil {
+		r.Geo = h.Geo.Resampled(h.Width, h.Height, width, height)
+	}
+	return r
+}
+
+/**
+ * Remaps every sample from [min, max] to [0, 1], clamping anything outside the range.
+ */
+func (h *Heightmap) Normalised(min, max float32) *Heightmap {
+	var n = New(h.Width, h.Height)
+	diff := max - min
+	for i, v := range h.Data {
+		if diff == 0 {
+			n.Data[i] = 0
+			continue
+		}
+		n.Data[i] = Clamp((v-min)/diff, 0, 1)
+	}
+	return n
+}
+
+func Clamp(value, min, max float32) float32 {
+	return float32(math.Max(float64(min), math.Min(float64(max), float64(value))))
+}
@@ -0,0 +1,43 @@
+package heightmap
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+/**
+ * Central difference gradient at (x, y), in height per cell.
+ */
+func (h *Heightmap) Gradient(x, y int) (dx, dy float32) {
+	dx = (h.At(x+1, y) - h.At(x-1, y)) / 2.0
+	dy = (h.At(x, y+1) - h.At(x, y-1)) / 2.0
+	return dx, dy
+}
+
+/**
+ * Surface normal at (x, y) once the map is laid out as a mesh with cells `cellSize` apart
+ * and heights multiplied by `heightScale`.
+ *
+ * World X runs along the cell y axis and world Z along the cell x axis, the same layout
+ * core.ChunkedTerrain uses when rendering, with Y up.
+ */
+func (h *Heightmap) Normal(x, y int, cellSize, heightScale float32) mgl32.Vec3 {
+	dx, dy := h.Gradient(x, y)
+	slopeZ := dx * heightScale / cellSize
+	slopeX := dy * heightScale / cellSize
+	return mgl32.Vec3{-slopeX, 1, -slopeZ}.Normalize()
+}
+
+/**
+ * Surface normal at a fractional cell position, from bilinear samples `spacing` cells either side.
+ * Used by meshes coarser or finer than the heightmap, where a vertex falls between cells.
+ */
+func (h *Heightmap) NormalAt(fx, fy, spacing, cellSize, heightScale float32) mgl32.Vec3 {
+	if spacing < 1 {
+		spacing = 1
+	}
+	dx := (h.Sample(fx+spacing, fy) - h.Sample(fx-spacing, fy)) / (2 * spacing)
+	dy := (h.Sample(fx, fy+spacing) - h.Sample(fx, fy-spacing)) / (2 * spacing)
+	slopeZ := dx * heightScale / cellSize
+	slopeX := dy * heightScale / cellSize
+	return mgl32.Vec3{-slopeX, 1, -slopeZ}.Normalize()
+}
@@ -0,0 +1,327 @@
+package history
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+/**
+ * Anything whose terrain height can be read and written a rectangle at a time, like the eroders.
+ * Values are in heightmap layout, x + y*width.
+ */
+type Target interface {
+	Heights(x, y, width, height int) []float32
+	SetHeights(x, y, width, height int, values []float32)
+}
+
+type Kind int
+
+const (
+	// Heights before and after are stored whole, for changes like regenerating the terrain.
+	Snapshot Kind = iota
+	// Only the change in height is stored, for brush strokes. Undoing takes it away again,
+	// which keeps whatever the simulation has done to the same cells since.
+	Delta
+)
+
+/**
+ * Rectangle of cells an entry covers.
+ */
+type Region struct {
+	X, Y, Width, Height int
+}
+
+func (r Region) Empty() bool {
+	return r.Width <= 0 || r.Height <= 0
+}
+
+/**
+ * Smallest region covering both.
+ */
+func (r Region) Union(other Region) Region {
+	if r.Empty() {
+		return other
+	}
+	if other.Empty() {
+		return r
+	}
+	minX, minY := min(r.X, other.X), min(r.Y, other.Y)
+	maxX, maxY := max(r.X+r.Width, other.X+other.Width), max(r.Y+r.Height, other.Y+other.Height)
+	return Region{minX, minY, maxX - minX, maxY - minY}
+}
+
+/**
+ * The heights one target had before and after an edit, compressed.
+ * For a Delta, `after` holds the difference and `before` is empty.
+ */
+type change struct {
+	target        Target
+	before, after []byte
+}
+
+/**
+ * A single undoable edit, applied to one or more targets.
+ */
+type Entry struct {
+	Name    string
+	Kind    Kind
+	Region  Region
+	changes []change
+}
+
+/**
+ * Compressed size in bytes.
+ */
+func (e *Entry) Size() int {
+	var size int
+	for _, c := range e.changes {
+		size += len(c.before) + len(c.after)
+	}
+	return size
+}
+
+func (e *Entry) apply(undo bool) error {
+	r := e.Region
+	for _, c := range e.changes {
+		switch e.Kind {
+		case Snapshot:
+			data := c.after
+			if undo {
+				data = c.before
+			}
+			values, err := decompress(data, r.Width*r.Height)
+			if err != nil {
+				return err
+			}
+			c.target.SetHeights(r.X, r.Y, r.Width, r.Height, values)
+		case Delta:
+			delta, err := decompress(c.after, r.Width*r.Height)
+			if err != nil {
+				return err
+			}
+			values := c.target.Heights(r.X, r.Y, r.Width, r.Height)
+			for i := range values {
+				if undo {
+					values[i] -= delta[i]
+				} else {
+					values[i] += delta[i]
+				}
+			}
+			c.target.SetHeights(r.X, r.Y, r.Width, r.Height, values)
+		}
+	}
+	return nil
+}
+
+/**
+ * An edit in progress. Heights of the whole width x height map are read from each target
+ * when recording starts, since the area a brush stroke will cover isn't known until it ends.
+ */
+type Recording struct {
+	name    string
+	kind    Kind
+	width   int
+	targets []Target
+	before  [][]float32
+}
+
+func Record(name string, kind Kind, width, height int, targets ...Target) *Recording {
+	r := &Recording{name: name, kind: kind, width: width, targets: targets}
+	for _, target := range targets {
+		r.before = append(r.before, target.Heights(0, 0, width, height))
+	}
+	return r
+}
+
+/**
+ * Ends the recording, comparing the heights over `region` with those at the start.
+ * Returns nil if nothing changed.
+ */
+func (r *Recording) Finish(region Region) *Entry {
+	if region.Empty() {
+		return nil
+	}
+	entry := &Entry{Name: r.name, Kind: r.kind, Region: region}
+	for i, target := range r.targets {
+		after := target.Heights(region.X, region.Y, region.Width, region.Height)
+		before := make([]float32, len(after))
+		changed := false
+		for y := 0; y < region.Height; y++ {
+			for x := 0; x < region.Width; x++ {
+				index := x + y*region.Width
+				before[index] = r.before[i][region.X+x+(region.Y+y)*r.width]
+				if before[index] != after[index] {
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			continue
+		}
+		if r.kind == Delta {
+			for index := range after {
+				after[index] -= before[index]
+			}
+			entry.changes = append(entry.changes, change{target: target, after: compress(after)})
+		} else {
+			entry.changes = append(entry.changes, change{target: target, before: compress(before), after: compress(after)})
+		}
+	}
+	if len(entry.changes) == 0 {
+		return nil
+	}
+	return entry
+}
+
+/**
+ * Linear undo history. Pushing an entry after undoing throws away the entries that could have been redone.
+ */
+type History struct {
+	entries []*Entry
+	// Entries before this index have been applied, the rest can be redone.
+	position int
+	// The oldest entries are dropped once the compressed total goes over this many bytes.
+	MaxBytes int
+}
+
+func New(maxBytes int) *History {
+	return &History{MaxBytes: maxBytes}
+}
+
+func (h *History) Entries() []*Entry {
+	return h.entries
+}
+
+/**
+ * Number of entries currently applied.
+ */
+func (h *History) Position() int {
+	return h.position
+}
+
+/**
+ * Compressed size of every entry in bytes.
+ */
+func (h *History) Size() int {
+	var size int
+	for _, entry := range h.entries {
+		size += entry.Size()
+	}
+	return size
+}
+
+/**
+ * Adds an applied entry, nil entries are ignored.
+ */
+func (h *History) Push(entry *Entry) {
+	if entry == nil {
+		return
+	}
+	h.entries = append(h.entries[:h.position], entry)
+	h.position = len(h.entries)
+	for len(h.entries) > 1 && h.Size() > h.MaxBytes {
+		h.entries = h.entries[1:]
+		h.position--
+	}
+}
+
+func (h *History) CanUndo() bool {
+	return h.position > 0
+}
+
+func (h *History) CanRedo() bool {
+	return h.position < len(h.entries)
+}
+
+func (h *History) Undo() error {
+	if !h.CanUndo() {
+		return nil
+	}
+	if err := h.entries[h.position-1].apply(true); err != nil {
+		return fmt.Errorf("undo %s: %v", h.entries[h.position-1].Name, err)
+	}
+	h.position--
+	return nil
+}
+
+func (h *History) Redo() error {
+	if !h.CanRedo() {
+		return nil
+	}
+	if err := h.entries[h.position].apply(false); err != nil {
+		return fmt.Errorf("redo %s: %v", h.entries[h.position].Name, err)
+	}
+	h.position++
+	return nil
+}
+
+/**
+ * Undoes or redoes until `position` entries are applied.
+ */
+func (h *History) GoTo(position int) error {
+	for h.position > position {
+		if err := h.Undo(); err != nil {
+			return err
+		}
+	}
+	for h.position < position && h.CanRedo() {
+		if err := h.Redo(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *History) Clear() {
+	h.entries = nil
+	h.position = 0
+}
+
+func compress(values []float32) []byte {
+	var buffer bytes.Buffer
+	writer, err := flate.NewWriter(&buffer, flate.BestSpeed)
+	if err != nil {
+		panic(err)
+	}
+	raw := make([]byte, len(values)*4)
+	for i, value := range values {
+		binary.LittleEndian.PutUint32(raw[i*4:], math.Float32bits(value))
+	}
+	// Writes to a bytes.Buffer can't fail.
+	_, _ = writer.Write(raw)
+	_ = writer.Close()
+	return buffer.Bytes()
+}
+
+func decompress(data []byte, count int) ([]float32, error) {
+	raw, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != count*4 {
+		return nil, fmt.Errorf("expected %d values, got %d", count, len(raw)/4)
+	}
+	values := make([]float32, count)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+	}
+	return values, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
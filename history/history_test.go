@@ -0,0 +1,154 @@
+package history
+
+import (
+	"testing"
+)
+
+// A width x height map of heights in memory.
+type grid struct {
+	width  int
+	values []float32
+}
+
+func newGrid(width, height int, value float32) *grid {
+	g := &grid{width: width, values: make([]float32, width*height)}
+	for i := range g.values {
+		g.values[i] = value
+	}
+	return g
+}
+
+func (g *grid) Heights(x, y, width, height int) []float32 {
+	values := make([]float32, width*height)
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			values[i+j*width] = g.values[x+i+(y+j)*g.width]
+		}
+	}
+	return values
+}
+
+func (g *grid) SetHeights(x, y, width, height int, values []float32) {
+	for j := 0; j < height; j++ {
+		for i := 0; i < width; i++ {
+			g.values[x+i+(y+j)*g.width] = values[i+j*width]
+		}
+	}
+}
+
+func (g *grid) at(x, y int) float32 {
+	return g.values[x+y*g.width]
+}
+
+func TestUndoRedo(t *testing.T) {
+	tests := []struct {
+		name string
+		kind Kind
+		// Applied to cell (1, 1) after the edit and before undoing, as the simulation might.
+		between float32
+		// Cell (1, 1) after undoing and after redoing.
+		undone, redone float32
+	}{
+		{"snapshot", Snapshot, 0, 1, 3},
+		{"delta", Delta, 0, 1, 3},
+		// A snapshot restores the heights it recorded, a delta only takes its own change away.
+		{"snapshot over later changes", Snapshot, 0.5, 1, 3},
+		{"delta over later changes", Delta, 0.5, 1.5, 3.5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := newGrid(4, 4, 1)
+			h := New(1 << 20)
+			recording := Record("edit", test.kind, 4, 4, g)
+			g.values[1+1*4] = 3
+			h.Push(recording.Finish(Region{X: 1, Y: 1, Width: 2, Height: 2}))
+			g.values[1+1*4] += test.between
+
+			if err := h.Undo(); err != nil {
+				t.Fatal(err)
+			}
+			if got := g.at(1, 1); got != test.undone {
+				t.Errorf("after undo got %v, want %v", got, test.undone)
+			}
+			if err := h.Redo(); err != nil {
+				t.Fatal(err)
+			}
+			if got := g.at(1, 1); got != test.redone {
+				t.Errorf("after redo got %v, want %v", got, test.redone)
+			}
+			// Cells outside the region are never touched.
+			if got := g.at(0, 0); got != 1 {
+				t.Errorf("cell outside the region got %v, want 1", got)
+			}
+		})
+	}
+}
+
+func TestFinishUnchanged(t *testing.T) {
+	g := newGrid(4, 4, 1)
+	if entry := Record("edit", Delta, 4, 4, g).Finish(Region{Width: 4, Height: 4}); entry != nil {
+		t.Errorf("got an entry for an edit that changed nothing")
+	}
+	if entry := Record("edit", Snapshot, 4, 4, g).Finish(Region{}); entry != nil {
+		t.Errorf("got an entry for an empty region")
+	}
+}
+
+func TestPushDropsRedo(t *testing.T) {
+	g := newGrid(2, 2, 0)
+	h := New(1 << 20)
+	for i := 1; i <= 3; i++ {
+		recording := Record("edit", Snapshot, 2, 2, g)
+		g.values[0] = float32(i)
+		h.Push(recording.Finish(Region{Width: 2, Height: 2}))
+	}
+	if err := h.GoTo(1); err != nil {
+		t.Fatal(err)
+	}
+	if g.values[0] != 1 {
+		t.Fatalf("after going back got %v, want 1", g.values[0])
+	}
+
+	recording := Record("branch", Snapshot, 2, 2, g)
+	g.values[0] = 10
+	h.Push(recording.Finish(Region{Width: 2, Height: 2}))
+	if len(h.Entries()) != 2 || h.Position() != 2 || h.CanRedo() {
+		t.Errorf("got %d entries at %d, want the redone entries dropped", len(h.Entries()), h.Position())
+	}
+	if err := h.GoTo(0); err != nil {
+		t.Fatal(err)
+	}
+	if g.values[0] != 0 {
+		t.Errorf("after undoing everything got %v, want 0", g.values[0])
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	g := newGrid(8, 8, 0)
+	h := New(1)
+	for i := 1; i <= 3; i++ {
+		recording := Record("edit", Snapshot, 8, 8, g)
+		g.values[0] = float32(i)
+		h.Push(recording.Finish(Region{Width: 8, Height: 8}))
+	}
+	// The newest entry is always kept, however big.
+	if len(h.Entries()) != 1 || h.Position() != 1 {
+		t.Errorf("got %d entries at %d, want only the newest", len(h.Entries()), h.Position())
+	}
+}
+
+func TestRegionUnion(t *testing.T) {
+	tests := []struct {
+		a, b, want Region
+	}{
+		{Region{}, Region{1, 2, 3, 4}, Region{1, 2, 3, 4}},
+		{Region{1, 2, 3, 4}, Region{}, Region{1, 2, 3, 4}},
+		{Region{0, 0, 2, 2}, Region{4, 4, 2, 2}, Region{0, 0, 6, 6}},
+		{Region{2, 2, 4, 4}, Region{3, 3, 1, 1}, Region{2, 2, 4, 4}},
+	}
+	for _, test := range tests {
+		if got := test.a.Union(test.b); got != test.want {
+			t.Errorf("%v.Union(%v) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -2,42 +2,103 @@ package main
 
 import "C"
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"image"
+	"log"
 	"github.com/go-gl/gl/v4.3-core/gl"
 	"github.com/go-gl/glfw/v3.2/glfw"
 	"github.com/go-gl/mathgl/mgl32"
 	"github.com/inkyblackness/imgui-go/v2"
 	"github.com/ob6160/Terrain/core"
 	"github.com/ob6160/Terrain/erosion"
+	"github.com/ob6160/Terrain/export"
 	"github.com/ob6160/Terrain/generators"
+	"github.com/ob6160/Terrain/gis"
 	"github.com/ob6160/Terrain/gui"
+	"github.com/ob6160/Terrain/heightmap"
+	"github.com/ob6160/Terrain/history"
 	"github.com/ob6160/Terrain/utils"
 	_ "github.com/ob6160/Terrain/utils"
 	"github.com/xlab/closer"
 	"math"
+	"strings"
 	"time"
 )
 
 const (
 	windowWidth      = 1200
 	windowHeight     = 800
-	vertexShaderPath = "./shaders/main.vert"
-	fragShaderPath   = "./shaders/main.frag"
+	vertexShaderPath = "main.vert"
+	fragShaderPath   = "main.frag"
+	// World units covered by the terrain, whatever the mesh and simulation resolution.
+	terrainWorldSize = 512
+	terrainPatchSize = 64
+	// Camera bookmarks are saved alongside the binary.
+	cameraBookmarksPath = "camera_bookmarks.json"
+	// Undo history is trimmed once its compressed size goes over this.
+	historyMaxBytes = 256 << 20
+	defaultScenePath = "scene.json"
+	shadowMapSize    = 2048
+	// How often the ambient occlusion is rebaked while the terrain erodes.
+	aoBakeInterval = time.Second
+	// How often the shader files are checked for changes.
+	shaderCheckInterval = 500 * time.Millisecond
+	// How often the terrain and water are read back to refresh the patch bounds used for culling,
+	// erosion and flowing water move them between edits.
+	boundsInterval = time.Second
 )
 
+var meshResolutions = []int{128, 256, 512, 1024, 2048}
+var meshResolutionNames = []string{"128", "256", "512", "1024", "2048"}
+
 type State struct {
-	Program            uint32
-	Uniforms           map[string]int32 //name -> handle
+	Program            *core.Program
 	Projection         mgl32.Mat4
 	Camera             mgl32.Mat4
 	CameraPos          mgl32.Vec3
-	WorldPos           mgl32.Vec3
+	WorldPos           mgl32.Vec3 // Where the camera starts, and returns to on reset
+	CameraControl      *core.Camera
 	TerrainHitPos      mgl32.Vec3
+	TerrainHit         core.TerrainHit // Under the cursor, for tools and the inspector
+	Picker             *core.Picker
+	pickedView         mgl32.Mat4 // View projection of the last pick, to tell when the view moved
+	CursorRadius       float32 // World units, drawn as a ring around the hit
+	Brush              *erosion.Brush
+	Materials          *core.MaterialSet
+	Water              *core.Water
+	Overlay            *core.Overlay
+	Lighting           core.LightingSettings
+	ShadowMap          *core.ShadowMap
+	AO                 *core.HorizonAO
+	aoBaked            time.Time // Zero when the occlusion needs baking
+	boundsUpdated      time.Time
+	ReloadShaders      bool      // Rebuild shaders when their files change
+	Fullscreen         bool      // Applied at the start of the next frame, outside the UI
+	wasFullscreen      bool      // As last applied
+	UIScale            float32
+	framebufferSize    [2]int // Of the last frame, for the UI
+	shadersChecked     time.Time
+	ScenePath          string
+	Capture            *export.Sequence
+	ScreenshotPath     string
+	screenshotPending  bool               // Taken at the end of the frame, outside the UI
+	captureTarget      *core.RenderTarget // Kept between frames of a sequence
+	orbitPose          core.CameraPose    // Where an orbit recording started, and returns to
+	History            *history.History
+	stroke             *history.Recording // The brush stroke in progress, if any
+	strokeRegion       history.Region     // Cells the stroke has touched so far
+	simulationRun      *history.Recording // Started with the CPU simulation
+	ErosionPaused      bool               // GPU erosion, paused by undo and redo so the history stays put
+	erosionRun         *history.Recording // GPU erosion since the last edit, added to the history as one entry
 	Model              mgl32.Mat4
 	MousePos           mgl32.Vec4
-	Angle, Height, FOV, LightingDir float32
-	Plane              *core.Plane
+	Height, FOV        float32
+	Terrain            *core.ChunkedTerrain
+	MeshResolution     int32 // Index into meshResolutions
 	MidpointGen        *generators.MidpointDisplacement
+	Generator          generators.TerrainGenerator // Either MidpointGen or an imported DEM
 	TerrainEroder      *erosion.CPUEroder
 	GPUEroder          *erosion.GPUEroder
 	ErosionState       *erosion.State
@@ -46,66 +107,56 @@ type State struct {
 	DebugField      []byte
 	DebugFieldLen   int32
 	InfoValueString string
+	BookmarkName    string
+	Export          ExportSettings
+	lastFrame       time.Time
 	iterations int
 }
 
-func setupUniforms(state *State) {
-	var program = state.Program
+const (
+	SourceGenerator int32 = iota
+	SourceCPUErosion
+	SourceGPUErosion
+)
 
-	// Uniforms
-	gl.UseProgram(program)
+var sourceNames = []string{"Generator", "CPU Erosion", "GPU Erosion"}
 
-	state.Projection = mgl32.Perspective(mgl32.DegToRad(state.FOV), float32(windowWidth)/windowHeight, 0.01, 10000.0)
-	//state.Projection = mgl32.Ortho(-state.Scale, state.Scale, -state.Scale, state.Scale, 0.01, 10000.0)
-	projectionUniform := gl.GetUniformLocation(program, gl.Str("projection\x00"))
-	gl.UniformMatrix4fv(projectionUniform, 1, false, &state.Projection[0])
+type ExportSettings struct {
+	Source, Format, MeshFormat int32
+	Path                       string
+	Options                    export.Options
+	Mesh                       export.MeshOptions
+	Solid                      export.SolidOptions
+	DEMPath                    string
+	DEMSampleType              int32
+	ContourFormat              int32
+	Relief                     export.ReliefOptions
+	Bake                       export.BakeOptions
+}
 
-	state.Camera = mgl32.LookAtV(state.CameraPos, mgl32.Vec3{0, 0, 0}, mgl32.Vec3{0, 1, 0})
-	cameraUniform := gl.GetUniformLocation(program, gl.Str("camera\x00"))
-	gl.UniformMatrix4fv(cameraUniform, 1, false, &state.Camera[0])
+func setupUniforms(state *State) {
+	var program = state.Program
 
+	state.CameraPos = state.CameraControl.Eye()
+	state.Camera = state.CameraControl.View()
 	state.Model = mgl32.Ident4()
-	modelUniform := gl.GetUniformLocation(program, gl.Str("model\x00"))
-	gl.UniformMatrix4fv(modelUniform, 1, false, &state.Model[0])
+	program.SetMat4("model", state.Model)
 
 	state.TerrainHitPos = mgl32.Vec3{0, 0, 0}
-	terrainHitPos := gl.GetUniformLocation(program, gl.Str("hitpos\x00"))
-	gl.Uniform3fv(terrainHitPos, 1, &state.TerrainHitPos[0])
-
-	textureUniform := gl.GetUniformLocation(program, gl.Str("tex\x00"))
-	gl.Uniform1i(textureUniform, 0)
-
-	angleUniform := gl.GetUniformLocation(program, gl.Str("angle\x00"))
-	gl.Uniform1fv(angleUniform, 1, &state.Angle)
-
-	heightUniform := gl.GetUniformLocation(program, gl.Str("height\x00"))
-	gl.Uniform1fv(heightUniform, 1, &state.Height)
-
-	lightingDirUniform := gl.GetUniformLocation(program, gl.Str("lightingDir\x00"))
-	gl.Uniform1fv(lightingDirUniform, 1, &state.LightingDir)
-
-	waterHeightUniform := gl.GetUniformLocation(program, gl.Str("tboWaterHeight\x00"))
-	gl.Uniform1i(waterHeightUniform, 0)
-
-	heightmapUniform := gl.GetUniformLocation(program, gl.Str("tboHeightmap\x00"))
-	gl.Uniform1i(heightmapUniform, 1)
-
-	state.Uniforms["heightUniform"] = heightUniform
-	state.Uniforms["projectionUniform"] = projectionUniform
-	state.Uniforms["cameraUniform"] = cameraUniform
-	state.Uniforms["modelUniform"] = modelUniform
-	state.Uniforms["angleUniform"] = angleUniform
-	state.Uniforms["terrainUniform"] = terrainHitPos
-	state.Uniforms["waterHeightUniform"] = waterHeightUniform
-	state.Uniforms["heightmapUniform"] = heightmapUniform
-	state.Uniforms["lightingDirUniform"] = lightingDirUniform
+	program.SetVec3("hitpos", state.TerrainHitPos)
+	program.SetFloat("cursorRadius", 0)
+	program.SetInt("tboHeightmap", 1)
 }
 
 func main() {
+	flag.StringVar(&core.ShaderDir, "shaders", core.ShaderDir,
+		"directory shaders are read (and reloaded) from, ahead of the built-in copies, empty for only the built-in ones")
+	flag.Parse()
+
 	var newGUI, _ = gui.NewGUI(windowWidth, windowHeight)
 	defer newGUI.Dispose()
 
-	var testPlane = core.NewPlane(512, 512)
+	var terrain = core.NewChunkedTerrain(512, 512, terrainPatchSize, terrainWorldSize/512.0)
 	var midpointDisp = generators.NewMidPointDisplacement(512, 512)
 	midpointDisp.Generate(0.5, 0.5)
 	midpointDisp.Generate(0.5, 0.5)
@@ -130,25 +181,36 @@ func main() {
 		MaximalErodeDepth:      0.001,
 	}
 	var terrainEroder = erosion.NewCPUEroder(midpointDisp, &erosionState)
-	var gpuEroder = erosion.NewGPUEroder(midpointDisp, &erosionState)
+	gpuEroder, err := erosion.NewGPUEroder(midpointDisp, &erosionState)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// TODO: Move defaults into configurable constants.
 	var state = &State{
-		Program:         0,
-		Uniforms:        make(map[string]int32),
 		Projection:      mgl32.Mat4{},
 		Camera:          mgl32.Mat4{},
 		CameraPos:       mgl32.Vec3{},
 		WorldPos:        mgl32.Vec3{-200, 200, -200},
+		CameraControl:   core.NewCamera(core.PoseLookingAt(mgl32.Vec3{-200, 200, -200}, mgl32.Vec3{})),
+		CursorRadius:    5,
+		Brush:           erosion.NewBrush(),
+		History:         history.New(historyMaxBytes),
+		Materials:       core.NewMaterialSet(core.DefaultMaterials()),
+		ScenePath:       defaultScenePath,
+		Capture:         export.NewSequence(),
+		ScreenshotPath:  "screenshot",
+		Lighting:        core.DefaultLightingSettings(),
+		Overlay:         core.NewOverlay(),
 		TerrainHitPos:   mgl32.Vec3{},
 		Model:           mgl32.Mat4{},
 		MousePos:        mgl32.Vec4{},
-		Angle:           0,
 		Height:          0.0,
 		FOV:             50.0,
-		LightingDir:     0.1,
-		Plane:           testPlane,
+		Terrain:         terrain,
+		MeshResolution:  2,
 		MidpointGen:     midpointDisp,
+		Generator:       midpointDisp,
 		TerrainEroder:   terrainEroder,
 		GPUEroder:       gpuEroder,
 		Spread:          0.5,
@@ -157,20 +219,64 @@ func main() {
 		DebugField:      make([]byte, 1000),
 		DebugFieldLen:   0,
 		InfoValueString: "",
+		Export: ExportSettings{
+			Source:  SourceGPUErosion,
+			Format:  int32(export.FormatPNG16),
+			Path:    "terrain",
+			Options: export.Options{Normalise: false, Min: 0, Max: 1},
+			Mesh:    export.MeshOptions{HorizontalScale: 1, VerticalScale: 100},
+			Solid:   export.SolidOptions{Size: 100, Base: 3, VerticalScale: 20, Decimation: 2},
+			DEMPath: "terrain.tif",
+			Relief:  export.DefaultReliefOptions(),
+			Bake:    export.DefaultBakeOptions(),
+		},
+		ReloadShaders: true,
+		UIScale:       newGUI.UIScale(),
 	}
 
+	// The view can't be drawn without these, so a shader that doesn't build ends the program with its error.
 	program, err := core.NewProgramFromPath(vertexShaderPath, fragShaderPath)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 	state.Program = program
 	setupUniforms(state)
 
+	picker, err := core.NewPicker()
+	if err != nil {
+		log.Fatal(err)
+	}
+	state.Picker = picker
+
+	water, err := core.NewWater()
+	if err != nil {
+		log.Fatal(err)
+	}
+	state.Water = water
+
+	shadowMap, err := core.NewShadowMap(shadowMapSize)
+	if err != nil {
+		log.Fatal(err)
+	}
+	state.ShadowMap = shadowMap
+
+	ao, err := core.NewHorizonAO()
+	if err != nil {
+		log.Fatal(err)
+	}
+	state.AO = ao
+
+	if err := state.Materials.UpdateTextures(); err != nil {
+		state.InfoValueString = err.Error()
+	}
+
 	// Setup terrain
 	state.MidpointGen.Generate(state.Spread, state.Reduce)
 	state.TerrainEroder = erosion.NewCPUEroder(midpointDisp, &erosionState)
 	state.TerrainEroder.Initialise()
-	state.Plane.Construct(512, 512)
+	state.Terrain.Construct(state.Generator.Dimensions())
+	state.Terrain.UpdateBounds(heightmap.FromGenerator(state.Generator))
+	state.Terrain.UpdateNormals(heightmap.FromGenerator(state.Generator), state.Height)
 
 	exitC := make(chan struct{}, 1)
 	doneC := make(chan struct{}, 1)
@@ -200,27 +306,1087 @@ func main() {
 	}
 }
 
-func updateUniforms(state *State) {
-	state.CameraPos = mgl32.Rotate3DY(state.Angle).Mul3x1(state.WorldPos)
-	state.Camera = mgl32.LookAtV(state.CameraPos, mgl32.Vec3{0, 0, 0}, mgl32.Vec3{0, 1, 0})
-	state.Projection = mgl32.Perspective(mgl32.DegToRad(state.FOV), float32(windowWidth)/windowHeight, 0.01, 10000.0)
+/**
+ * aspect is width over height of what's being drawn to, the cursor marker is left out when cursor is false.
+ */
+func updateUniforms(state *State, aspect float32, cursor bool) {
+	state.CameraPos = state.CameraControl.Eye()
+	state.Camera = state.CameraControl.View()
+	state.Projection = mgl32.Perspective(mgl32.DegToRad(state.FOV), aspect, 0.01, 10000.0)
+
+	program := state.Program
+	program.SetMat4("projection", state.Projection)
+	program.SetMat4("camera", state.Camera)
+	program.SetFloat("height", state.Height)
+	program.SetFloat("skirtDepth", state.Terrain.SkirtDepth)
+	program.SetFloat("sampleLod", state.Terrain.SampleLOD())
+
+	// The cursor marker is hidden by a zero radius when the cursor is off the terrain.
+	var cursorRadius float32
+	if cursor && state.TerrainHit.Hit {
+		cursorRadius = state.CursorRadius
+		if state.Brush.Tool != erosion.BrushNone {
+			cursorRadius = state.Brush.Radius * state.Terrain.CellSize()
+		}
+	}
+	program.SetVec3("hitpos", state.TerrainHitPos)
+	program.SetFloat("cursorRadius", cursorRadius)
+	state.Materials.Bind(state.Program)
 
-	gl.UniformMatrix4fv(state.Uniforms["projectionUniform"], 1, false, &state.Projection[0])
-	gl.UniformMatrix4fv(state.Uniforms["cameraUniform"], 1, false, &state.Camera[0])
-	gl.Uniform1fv(state.Uniforms["heightUniform"], 1, &state.Height)
-	gl.Uniform1fv(state.Uniforms["angleUniform"], 1, &state.Angle)
-	gl.Uniform1fv(state.Uniforms["lightingDirUniform"], 1, &state.LightingDir)
+	lighting := state.Lighting
+	sun := lighting.Sun.Direction()
+	program.SetVec3("lightDir", sun)
+	program.SetMat4("lightSpace", state.ShadowMap.LightSpace)
+	program.SetBool("shadowsEnabled", lighting.Shadows)
+	program.SetFloat("shadowBias", lighting.ShadowBias)
+	program.SetBool("aoEnabled", lighting.AmbientOcclusion && state.AO.Texture() != 0)
+	gl.ActiveTexture(gl.TEXTURE0 + core.ShadowTextureUnit)
+	gl.BindTexture(gl.TEXTURE_2D, state.ShadowMap.Texture())
+	gl.ActiveTexture(gl.TEXTURE0 + core.AOTextureUnit)
+	gl.BindTexture(gl.TEXTURE_2D, state.AO.Texture())
+
+	state.Overlay.Bind(state.Program)
+	gl.ActiveTexture(gl.TEXTURE4)
+	gl.BindTexture(gl.TEXTURE_2D, state.GPUEroder.VelocitySampleTexture())
+	gl.ActiveTexture(gl.TEXTURE0 + core.OutflowTextureUnit)
+	gl.BindTexture(gl.TEXTURE_2D, state.GPUEroder.OutflowSampleTexture())
+	gl.ActiveTexture(gl.TEXTURE0 + core.InitialHeightTextureUnit)
+	gl.BindTexture(gl.TEXTURE_2D, state.GPUEroder.InitialHeightTexture())
 	
 	gl.ActiveTexture(gl.TEXTURE1)
 	gl.BindTexture(gl.TEXTURE_2D, state.GPUEroder.HeightDisplayTexture())
-	gl.Uniform1i(state.Uniforms["heightmapUniform"], 1)
-	
+
+	// Filtered height for displacing the mesh, bound to the unit main.vert declares.
+	gl.ActiveTexture(gl.TEXTURE2)
+	gl.BindTexture(gl.TEXTURE_2D, state.GPUEroder.HeightSampleTexture())
+	gl.ActiveTexture(gl.TEXTURE0)
+}
+
+
+/**
+ * Draws the terrain then the water over it with the current camera, into whatever framebuffer is bound.
+ */
+func (coreState *State) drawScene(aspect float32, cursor bool) {
+	coreState.Program.Use()
+	updateUniforms(coreState, aspect, cursor)
+	coreState.Terrain.Draw(coreState.Projection.Mul4(coreState.Camera), coreState.CameraPos, coreState.Height)
+
+	// Water goes over the terrain, it's blended so is drawn last.
+	coreState.Water.Draw(coreState.Terrain, coreState.Projection, coreState.Camera, coreState.CameraPos, coreState.Lighting.Sun.Direction(),
+		coreState.Height, float32(glfw.GetTime()), coreState.GPUEroder.HeightSampleTexture(), coreState.GPUEroder.VelocitySampleTexture())
+}
+
+/**
+ * Draws the view offscreen at width x height, without the cursor, and reads it back.
+ */
+func (coreState *State) renderOffscreen(width, height int) (*image.RGBA, error) {
+	target := coreState.captureTarget
+	if target == nil || target.Width != width || target.Height != height {
+		if target != nil {
+			target.Delete()
+		}
+		var err error
+		if target, err = core.NewRenderTarget(width, height); err != nil {
+			coreState.captureTarget = nil
+			return nil, err
+		}
+		coreState.captureTarget = target
+	}
+	target.Bind()
+	gl.Enable(gl.DEPTH_TEST)
+	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+	coreState.drawScene(float32(width)/float32(height), false)
+	img := target.Image()
+	target.Unbind()
+	return img, nil
+}
+
+/**
+ * Takes a requested screenshot, and the next frame of the image sequence when one is due.
+ */
+func (coreState *State) capture() {
+	sequence := coreState.Capture
+	if coreState.screenshotPending {
+		coreState.screenshotPending = false
+		img, err := coreState.renderOffscreen(int(sequence.Width), int(sequence.Height))
+		var path string
+		if err == nil {
+			path, err = export.WriteScreenshot(coreState.ScreenshotPath, img)
+		}
+		if err != nil {
+			coreState.InfoValueString = fmt.Sprintf("Screenshot failed: %v", err)
+		} else {
+			coreState.InfoValueString = fmt.Sprintf("Saved %s", path)
+		}
+	}
+
+	if !sequence.Due(coreState.iterations) {
+		return
+	}
+	img, err := coreState.renderOffscreen(int(sequence.Width), int(sequence.Height))
+	var path string
+	if err == nil {
+		path, err = sequence.Write(img, coreState.iterations)
+	}
+	if err != nil {
+		coreState.InfoValueString = fmt.Sprintf("Recording stopped: %v", err)
+	} else {
+		coreState.InfoValueString = fmt.Sprintf("Recorded %s", path)
+	}
+	if !sequence.Recording() {
+		coreState.stopRecording()
+	}
+}
+
+func (coreState *State) startRecording() {
+	coreState.orbitPose = coreState.CameraControl.Pose()
+	coreState.Capture.Start(coreState.iterations)
+}
+
+func (coreState *State) stopRecording() {
+	sequence := coreState.Capture
+	sequence.Stop()
+	if sequence.Mode == export.SequenceOrbit {
+		coreState.CameraControl.SetPose(coreState.orbitPose, true)
+	}
+}
+
+func (coreState *State) renderCaptureUI() {
+	sequence := coreState.Capture
+	imgui.PushItemWidth(160)
+	{
+		imgui.DragIntV("Width", &sequence.Width, 8, 16, 8192, "%d")
+		imgui.DragIntV("Height", &sequence.Height, 8, 16, 8192, "%d")
+		imgui.InputText("Screenshot Path", &coreState.ScreenshotPath)
+		imgui.PopItemWidth()
+	}
+	if imgui.Button("Screenshot") {
+		coreState.screenshotPending = true
+	}
+
+	imgui.PushItemWidth(160)
+	{
+		imgui.InputText("Sequence Prefix", &sequence.Prefix)
+		mode := int32(sequence.Mode)
+		if combo("Sequence", &mode, export.SequenceModeNames) && !sequence.Recording() {
+			sequence.Mode = export.SequenceMode(mode)
+		}
+		if sequence.Mode == export.SequenceSimulation {
+			imgui.SliderInt("Steps Per Frame", &sequence.Interval, 1, 500)
+		}
+		imgui.DragIntV("Frames", &sequence.Frames, 1, 0, 100000, "%d")
+		imgui.PopItemWidth()
+	}
+	if sequence.Recording() {
+		if imgui.Button("Stop Recording") {
+			coreState.stopRecording()
+		}
+		imgui.SameLine()
+		imgui.Text(fmt.Sprintf("%d frames", sequence.Frame()))
+	} else if imgui.Button("Start Recording") {
+		coreState.startRecording()
+	}
+}
+
+/**
+ * Rebuilds the shaders whose files have changed. Failures are shown in the UI and the old shaders are kept.
+ */
+func (coreState *State) checkShaders(timer time.Time) {
+	if !coreState.ReloadShaders || timer.Sub(coreState.shadersChecked) < shaderCheckInterval {
+		return
+	}
+	coreState.shadersChecked = timer
+	if len(core.ReloadChangedShaders()) > 0 {
+		// The occlusion may have been baked by the old shader.
+		coreState.aoBaked = time.Time{}
+	}
+}
+
+func (coreState *State) renderShadersUI() {
+	if core.ShaderDir == "" {
+		imgui.Text("Using the built-in shaders")
+	} else {
+		imgui.Text(fmt.Sprintf("Reading from %s, then the built-in shaders", core.ShaderDir))
+	}
+	imgui.Checkbox("Reload On Change", &coreState.ReloadShaders)
+	if imgui.Button("Reload All") {
+		core.ReloadShaders()
+		coreState.aoBaked = time.Time{}
+	}
+	for _, program := range core.WatchedPrograms() {
+		status := "ok"
+		if program.Error() != nil {
+			status = "failed, see Shader Errors"
+		} else if warnings := len(program.Warnings()); warnings > 0 {
+			status = fmt.Sprintf("%d warnings", warnings)
+		}
+		if imgui.TreeNode(fmt.Sprintf("%s (%s)", program.Name, status)) {
+			imgui.Text("Files: " + strings.Join(program.Files(), ", "))
+			for _, warning := range program.Warnings() {
+				imgui.Text(warning)
+			}
+			imgui.TreePop()
+		}
+	}
+}
+
+/**
+ * A window listing the shaders that failed to rebuild, shown while there are any.
+ */
+func renderShaderErrors() {
+	failed := core.ShaderErrors()
+	if len(failed) == 0 {
+		return
+	}
+	if imgui.Begin("Shader Errors") {
+		imgui.PushTextWrapPos()
+		for i, program := range failed {
+			if i > 0 {
+				imgui.Separator()
+			}
+			imgui.Text(program.Name)
+			var shaderErr *core.ShaderError
+			if !errors.As(program.Error(), &shaderErr) || len(shaderErr.Messages) == 0 {
+				imgui.Text(program.Error().Error())
+				continue
+			}
+			for _, message := range shaderErr.Messages {
+				colour := imgui.Vec4{X: 1, Y: 0.4, Z: 0.4, W: 1}
+				if message.Severity == "warning" {
+					colour = imgui.Vec4{X: 1, Y: 0.8, Z: 0.3, W: 1}
+				}
+				imgui.PushStyleColor(imgui.StyleColorText, colour)
+				imgui.Text(message.String())
+				imgui.PopStyleColor()
+				imgui.PushStyleColor(imgui.StyleColorText, imgui.Vec4{X: 0.7, Y: 0.7, Z: 0.7, W: 1})
+				for _, line := range message.Context {
+					imgui.Text(line)
+				}
+				imgui.PopStyleColor()
+			}
+		}
+		imgui.PopTextWrapPos()
+	}
+	imgui.End()
+}
+
+/**
+ * Refreshes the bounds the terrain and water are culled with when they're due, reading them back is slow.
+ */
+func (coreState *State) updateBounds(timer time.Time) {
+	if timer.Sub(coreState.boundsUpdated) < boundsInterval {
+		return
+	}
+	coreState.boundsUpdated = timer
+	height, water := coreState.GPUEroder.Surface()
+	coreState.Terrain.UpdateBounds(height)
+	coreState.Terrain.UpdateWaterBounds(height, water)
 }
 
+/**
+ * Renders the shadow map and rebakes the ambient occlusion when it's due.
+ */
+func (coreState *State) updateLighting(timer time.Time) {
+	lighting := coreState.Lighting
+	if lighting.Shadows {
+		coreState.ShadowMap.Render(coreState.Terrain, lighting.Sun.Direction(), coreState.CameraPos, coreState.Height, coreState.GPUEroder.HeightSampleTexture())
+	}
+	due := coreState.aoBaked.IsZero() || (lighting.AOAutoUpdate && timer.Sub(coreState.aoBaked) > aoBakeInterval)
+	if lighting.AmbientOcclusion && due {
+		width, height := coreState.Generator.Dimensions()
+		coreState.AO.Bake(coreState.GPUEroder.HeightSampleTexture(), width, height, lighting.AORadius, coreState.Terrain.CellSize(), coreState.Height)
+		coreState.aoBaked = timer
+	}
+}
+
+func (coreState *State) renderOverlayUI() {
+	overlay := coreState.Overlay
+	imgui.PushItemWidth(160)
+	{
+		channel := int32(overlay.Channel)
+		if combo("Channel", &channel, core.OverlayChannelNames) {
+			overlay.SetChannel(core.OverlayChannel(channel))
+		}
+		if overlay.Channel != core.OverlayNone {
+			if overlay.Channel != core.OverlayDirection {
+				ramp := int32(overlay.Ramp)
+				if combo("Colour Ramp", &ramp, core.ColourRampNames) {
+					overlay.Ramp = core.ColourRamp(ramp)
+				}
+			}
+			speed := (overlay.Max - overlay.Min) * 0.005
+			imgui.DragFloatV("Range Min", &overlay.Min, speed, -1000.0, 1000.0, "%.4f", 1.0)
+			imgui.DragFloatV("Range Max", &overlay.Max, speed, -1000.0, 1000.0, "%.4f", 1.0)
+			imgui.SliderFloat("Opacity", &overlay.Opacity, 0.0, 1.0)
+		}
+		imgui.PopItemWidth()
+	}
+	if overlay.Channel == core.OverlayDirection {
+		imgui.Text("Hue shows the direction of flow,")
+		imgui.Text(fmt.Sprintf("full brightness at a speed of %.3f.", overlay.Max))
+	} else if overlay.Channel != core.OverlayNone {
+		// Legend, the ramp with its end and middle values under it.
+		imgui.Image(utils.FullColourTextureId(overlay.LegendTexture(), utils.COLOUR), imgui.Vec2{240, 14})
+		imgui.Text(fmt.Sprintf("%-10.4g %10.4g %10.4g", overlay.Min, (overlay.Min+overlay.Max)/2, overlay.Max))
+	}
+
+	imgui.Checkbox("Contours", &overlay.Contours)
+	imgui.PushItemWidth(160)
+	{
+		imgui.DragFloatV("Contour Interval", &overlay.ContourInterval, 0.001, 0.001, 1.0, "%.3f", 1.0)
+		imgui.DragFloatV("Contour Base", &overlay.ContourBase, 0.001, -1.0, 1.0, "%.3f", 1.0)
+		imgui.SliderInt("Index Contour Every", &overlay.ContourIndexEvery, 0, 20)
+		imgui.PopItemWidth()
+	}
+
+	imgui.Checkbox("Flow Arrows", &overlay.Arrows)
+	if overlay.Arrows {
+		imgui.PushItemWidth(160)
+		{
+			imgui.SliderFloat("Arrow Spacing (cells)", &overlay.ArrowSpacing, 4.0, 64.0)
+			imgui.DragFloatV("Full Length Speed", &overlay.ArrowSpeed, 0.01, 0.001, 100.0, "%.3f", 1.0)
+			imgui.PopItemWidth()
+		}
+	}
+}
+
+func (coreState *State) renderLightingUI() {
+	lighting := &coreState.Lighting
+	imgui.PushItemWidth(160)
+	{
+		imgui.SliderFloat("Sun Azimuth", &lighting.Sun.Azimuth, 0.0, 360.0)
+		imgui.SliderFloat("Sun Elevation", &lighting.Sun.Elevation, 1.0, 90.0)
+		imgui.Checkbox("Shadows", &lighting.Shadows)
+		imgui.DragFloatV("Shadow Bias", &lighting.ShadowBias, 0.0001, 0.0, 0.05, "%.4f", 1.0)
+		imgui.Checkbox("Ambient Occlusion", &lighting.AmbientOcclusion)
+		if imgui.SliderFloat("AO Radius", &lighting.AORadius, 1.0, 200.0) {
+			coreState.aoBaked = time.Time{}
+		}
+		imgui.Checkbox("Update AO While Eroding", &lighting.AOAutoUpdate)
+		imgui.PopItemWidth()
+	}
+	if imgui.Button("Bake AO") {
+		coreState.aoBaked = time.Time{}
+	}
+}
+
+/**
+ * Simple imgui combo box over a list of names.
+ */
+func combo(label string, current *int32, items []string) bool {
+	changed := false
+	if imgui.BeginCombo(label, items[*current]) {
+		for i, item := range items {
+			if imgui.SelectableV(item, int32(i) == *current, 0, imgui.Vec2{}) {
+				*current = int32(i)
+				changed = true
+			}
+		}
+		imgui.EndCombo()
+	}
+	return changed
+}
+
+/**
+ * Fetches the heightmap selected as the export source.
+ */
+func (coreState *State) sourceHeightmap(source int32) *heightmap.Heightmap {
+	switch source {
+	case SourceCPUErosion:
+		return coreState.TerrainEroder.Heightmap()
+	case SourceGPUErosion:
+		return coreState.GPUEroder.Heightmap()
+	default:
+		return heightmap.FromGenerator(coreState.Generator)
+	}
+}
+
+func (coreState *State) exportHeightmap() {
+	settings := coreState.Export
+	h := coreState.sourceHeightmap(settings.Source)
+	path, err := export.WriteHeightmap(settings.Path, export.Format(settings.Format), h, settings.Options)
+	if err != nil {
+		coreState.InfoValueString = fmt.Sprintf("Export failed: %v", err)
+		return
+	}
+	coreState.InfoValueString = fmt.Sprintf("Exported %s", path)
+}
 
+func (coreState *State) exportMesh() {
+	settings := coreState.Export
+	mesh := export.NewTerrainMesh(coreState.sourceHeightmap(settings.Source), settings.Mesh)
+	path, err := export.WriteMesh(settings.Path, export.MeshFormat(settings.MeshFormat), mesh)
+	if err != nil {
+		coreState.InfoValueString = fmt.Sprintf("Export failed: %v", err)
+		return
+	}
+	coreState.InfoValueString = fmt.Sprintf("Exported %s", path)
+}
+
+/**
+ * Exports the contours of the export source, at the interval set for the overlay.
+ */
+func (coreState *State) exportContours() {
+	settings := coreState.Export
+	overlay := coreState.Overlay
+	h := coreState.sourceHeightmap(settings.Source)
+	contours := h.Contours(heightmap.ContourOptions{
+		Interval:   overlay.ContourInterval,
+		Base:       overlay.ContourBase,
+		IndexEvery: int(overlay.ContourIndexEvery),
+	})
+	path, err := export.WriteContours(settings.Path+"_contours", export.ContourFormat(settings.ContourFormat), h, contours)
+	if err != nil {
+		coreState.InfoValueString = fmt.Sprintf("Export failed: %v", err)
+		return
+	}
+	coreState.InfoValueString = fmt.Sprintf("Exported %d contours to %s", len(contours), path)
+}
+
+/**
+ * Exports a hillshaded, height tinted map of the export source. The eroders' water is drawn over it.
+ */
+func (coreState *State) exportRelief() {
+	settings := coreState.Export
+	h := coreState.sourceHeightmap(settings.Source)
+	var water *heightmap.Heightmap
+	if settings.Relief.Water {
+		switch settings.Source {
+		case SourceCPUErosion:
+			water = coreState.TerrainEroder.Layers().Water
+		case SourceGPUErosion:
+			water = coreState.GPUEroder.Layers().Water
+		}
+	}
+	path, err := export.WriteRelief(settings.Path+"_relief", h, water, settings.Relief)
+	if err != nil {
+		coreState.InfoValueString = fmt.Sprintf("Export failed: %v", err)
+		return
+	}
+	coreState.InfoValueString = fmt.Sprintf("Exported %s", path)
+}
+
+/**
+ * Bakes normal, ambient occlusion and curvature maps of the export source.
+ */
+func (coreState *State) exportBakes() {
+	settings := coreState.Export
+	paths, err := export.WriteBakes(settings.Path, coreState.sourceHeightmap(settings.Source), settings.Bake)
+	if err != nil {
+		coreState.InfoValueString = fmt.Sprintf("Export failed: %v", err)
+		return
+	}
+	coreState.InfoValueString = fmt.Sprintf("Baked %d maps", len(paths))
+}
+
+/**
+ * Exports a closed solid for 3D printing, always as STL.
+ */
+func (coreState *State) exportSolid() {
+	settings := coreState.Export
+	mesh := export.NewSolidMesh(coreState.sourceHeightmap(settings.Source), settings.Solid)
+	path, err := export.WriteMesh(settings.Path+"_solid", export.MeshFormatSTL, mesh)
+	if err != nil {
+		coreState.InfoValueString = fmt.Sprintf("Export failed: %v", err)
+		return
+	}
+	coreState.InfoValueString = fmt.Sprintf("Exported %s", path)
+}
+
+/**
+ * Swaps the terrain source, rebuilding both eroders around it. Nothing changes if the GPU eroder can't be built.
+ */
+func (coreState *State) useGenerator(generator generators.TerrainGenerator) error {
+	gpuEroder, err := erosion.NewGPUEroder(generator, coreState.ErosionState)
+	if err != nil {
+		return err
+	}
+	coreState.GPUEroder.DeletePrograms()
+	coreState.GPUEroder = gpuEroder
+	coreState.Generator = generator
+	coreState.TerrainEroder = erosion.NewCPUEroder(generator, coreState.ErosionState)
+	coreState.TerrainEroder.Initialise()
+	coreState.rebuildTerrain()
+	// The history points at the old eroders.
+	coreState.History.Clear()
+	coreState.stroke = nil
+	coreState.simulationRun = nil
+	coreState.erosionRun = nil
+	// The new terrain may not be the same size.
+	coreState.aoBaked = time.Time{}
+	return nil
+}
+
+/**
+ * Rebuilds the terrain mesh at the selected resolution over the current simulation,
+ * keeping its level of detail settings.
+ */
+func (coreState *State) rebuildTerrain() {
+	resolution := meshResolutions[coreState.MeshResolution]
+	terrain := core.NewChunkedTerrain(resolution, resolution, terrainPatchSize, terrainWorldSize/float32(resolution))
+	terrain.LODDistance = coreState.Terrain.LODDistance
+	terrain.SkirtDepth = coreState.Terrain.SkirtDepth
+	coreState.Terrain.Delete()
+	coreState.Terrain = terrain
+	coreState.Terrain.Construct(coreState.Generator.Dimensions())
+	coreState.Terrain.UpdateBounds(heightmap.FromGenerator(coreState.Generator))
+	// The bounds above are for the terrain before erosion, and the new patches have no water bounds yet.
+	coreState.boundsUpdated = time.Time{}
+}
+
+/**
+ * Imports a GeoTIFF or ASCII grid DEM, resampled to the current simulation size.
+ */
+func (coreState *State) importDEM() {
+	width, height := coreState.Generator.Dimensions()
+	dem, err := gis.ImportDEM(coreState.Export.DEMPath, width, height)
+	if err != nil {
+		coreState.InfoValueString = fmt.Sprintf("Import failed: %v", err)
+		return
+	}
+	if err := coreState.useGenerator(dem); err != nil {
+		coreState.InfoValueString = fmt.Sprintf("Import failed: %v", err)
+		return
+	}
+	coreState.InfoValueString = fmt.Sprintf("Imported %s", coreState.Export.DEMPath)
+}
+
+func (coreState *State) exportDEM() {
+	settings := coreState.Export
+	h := coreState.sourceHeightmap(settings.Source)
+	if err := gis.WriteDEM(settings.DEMPath, h, gis.SampleType(settings.DEMSampleType)); err != nil {
+		coreState.InfoValueString = fmt.Sprintf("Export failed: %v", err)
+		return
+	}
+	coreState.InfoValueString = fmt.Sprintf("Exported %s", settings.DEMPath)
+}
+
+/**
+ * Exports the simulation channels of the selected eroder.
+ * The generator has no simulation state, so the GPU eroder is used in its place.
+ */
+func (coreState *State) exportLayers() {
+	settings := coreState.Export
+	var source erosion.LayerSource = coreState.GPUEroder
+	if settings.Source == SourceCPUErosion {
+		source = coreState.TerrainEroder
+	}
+	paths, err := export.WriteLayers(settings.Path, export.Format(settings.Format), source.Layers())
+	if err != nil {
+		coreState.InfoValueString = fmt.Sprintf("Export failed: %v", err)
+		return
+	}
+	coreState.InfoValueString = fmt.Sprintf("Exported %d layers", len(paths))
+}
+
+/**
+ * Drives the camera from the mouse and keyboard, unless imgui is using them.
+ * Right drag rotates, middle drag (or shift + right drag) pans, scroll zooms and WASD/QE move.
+ */
+func (coreState *State) updateCamera(g *gui.GUI, dt float32) {
+	camera := coreState.CameraControl
+	input := g.Input()
+	shift := g.KeyDown(glfw.KeyLeftShift) || g.KeyDown(glfw.KeyRightShift)
+
+	if !input.WantCaptureMouse {
+		switch {
+		case g.MouseButtonDown(2) || (g.MouseButtonDown(1) && shift):
+			camera.Pan(input.MouseDeltaX, input.MouseDeltaY)
+		case g.MouseButtonDown(1):
+			camera.Rotate(input.MouseDeltaX, input.MouseDeltaY)
+		}
+		camera.Zoom(input.Scroll)
+	}
+
+	if !input.WantCaptureKeyboard {
+		axis := func(positive, negative glfw.Key) float32 {
+			var value float32
+			if g.KeyDown(positive) {
+				value++
+			}
+			if g.KeyDown(negative) {
+				value--
+			}
+			return value
+		}
+		speed := dt
+		if shift {
+			speed *= 4
+		}
+		camera.Move(axis(glfw.KeyW, glfw.KeyS), axis(glfw.KeyD, glfw.KeyA), axis(glfw.KeyE, glfw.KeyQ), speed)
+	}
+
+	camera.Update(dt)
+}
+
+/**
+ * Casts a ray from the cursor onto the terrain, unless the cursor is over the UI. Only done while
+ * sculpting, or when the cursor or view moved, and the hit arrives a frame or so later.
+ */
+func (coreState *State) pickTerrain(g *gui.GUI) {
+	input := g.Input()
+	if input.WantCaptureMouse {
+		coreState.TerrainHit = core.TerrainHit{}
+		coreState.pickedView = mgl32.Mat4{}
+		return
+	}
+	if hit, ok := coreState.Picker.Result(); ok {
+		coreState.TerrainHit = hit
+		coreState.TerrainHitPos = hit.Position
+	}
+	viewProjection := coreState.Projection.Mul4(coreState.Camera)
+	moved := input.MouseDeltaX != 0 || input.MouseDeltaY != 0 || viewProjection != coreState.pickedView
+	if coreState.Brush.Tool == erosion.BrushNone && !moved {
+		return
+	}
+	coreState.pickedView = viewProjection
+	width, height := g.GetSize()
+	origin, direction := core.ScreenRay(viewProjection, input.MouseX, input.MouseY, width, height)
+	coreState.Picker.Pick(coreState.GPUEroder.HeightSampleTexture(), coreState.Terrain, coreState.Height, origin, direction)
+}
+
+/**
+ * Sculpts the terrain under the cursor while the left mouse button is held.
+ */
+func (coreState *State) applyBrush(g *gui.GUI, dt float32) {
+	brush := coreState.Brush
+	hit := coreState.TerrainHit
+	if brush.Tool == erosion.BrushNone || g.Input().WantCaptureMouse || !g.MouseButtonDown(0) || !hit.Hit {
+		if coreState.stroke != nil {
+			coreState.finishEdit(coreState.stroke, coreState.strokeRegion)
+			coreState.stroke = nil
+			coreState.resetErosionDelta()
+			// Patch bounds are only refreshed once the stroke is done, reading the heights back is slow.
+			coreState.Terrain.UpdateBounds(coreState.GPUEroder.Heightmap())
+		}
+		return
+	}
+	if coreState.stroke == nil {
+		brush.BeginStroke(hit.Height)
+		coreState.stroke = coreState.beginEdit(erosion.BrushToolNames[brush.Tool], history.Delta, coreState.GPUEroder, coreState.TerrainEroder)
+		coreState.strokeRegion = history.Region{}
+	}
+	width, height := coreState.Generator.Dimensions()
+	minX, minY, maxX, maxY := brush.Bounds(hit.CellX, hit.CellY, width, height)
+	coreState.strokeRegion = coreState.strokeRegion.Union(history.Region{X: minX, Y: minY, Width: maxX - minX, Height: maxY - minY})
+	coreState.TerrainEroder.ApplyBrush(brush, hit.CellX, hit.CellY, dt)
+	coreState.GPUEroder.ApplyBrush(brush, hit.CellX, hit.CellY, dt)
+}
+
+/**
+ * Runs a GPU erosion pass, unless erosion is paused or a brush stroke is in progress so the stroke
+ * only records the brush. The passes between edits are recorded as a single history entry.
+ */
+func (coreState *State) erode() {
+	if coreState.ErosionPaused {
+		coreState.finishErosion()
+		return
+	}
+	if coreState.stroke != nil {
+		return
+	}
+	if coreState.erosionRun == nil {
+		coreState.erosionRun = coreState.beginEdit("GPU Erosion", history.Snapshot, coreState.GPUEroder)
+	}
+	coreState.GPUEroder.Pass()
+	coreState.iterations++
+	fmt.Printf("%d Iterations\n", coreState.iterations)
+}
+
+/**
+ * Adds the GPU erosion since the last edit to the history, so other edits and undoing don't lose it.
+ */
+func (coreState *State) finishErosion() {
+	if coreState.erosionRun == nil {
+		return
+	}
+	run := coreState.erosionRun
+	coreState.erosionRun = nil
+	coreState.finishEdit(run, coreState.wholeTerrain())
+}
+
+/**
+ * Starts recording a change to the terrain height of the targets, for the undo history.
+ */
+func (coreState *State) beginEdit(name string, kind history.Kind, targets ...history.Target) *history.Recording {
+	coreState.finishErosion()
+	width, height := coreState.Generator.Dimensions()
+	return history.Record(name, kind, width, height, targets...)
+}
+
+/**
+ * Adds the changes made over `region` since the recording started to the undo history.
+ */
+func (coreState *State) finishEdit(recording *history.Recording, region history.Region) {
+	coreState.History.Push(recording.Finish(region))
+	coreState.aoBaked = time.Time{}
+}
+
+func (coreState *State) wholeTerrain() history.Region {
+	width, height := coreState.Generator.Dimensions()
+	return history.Region{Width: width, Height: height}
+}
+
+/**
+ * Undoes or redoes edits until `position` of them are applied. GPU erosion is paused afterwards,
+ * otherwise it would carry on from the restored terrain and throw away the entries left to redo.
+ */
+func (coreState *State) goToHistory(position int) {
+	if coreState.stroke != nil || position == coreState.History.Position() {
+		return
+	}
+	coreState.finishErosion()
+	coreState.ErosionPaused = true
+	if err := coreState.History.GoTo(position); err != nil {
+		coreState.InfoValueString = fmt.Sprintf("History failed: %v", err)
+	}
+	coreState.Terrain.UpdateBounds(coreState.GPUEroder.Heightmap())
+	coreState.aoBaked = time.Time{}
+	coreState.resetErosionDelta()
+}
+
+/**
+ * Measures erosion from the terrain as it is now, after it was edited rather than eroded.
+ */
+func (coreState *State) resetErosionDelta() {
+	coreState.GPUEroder.ResetDelta()
+	coreState.TerrainEroder.ResetDelta()
+}
+
+/**
+ * Undoes the last edit, the GPU erosion since it first if there was any.
+ */
+func (coreState *State) undo() {
+	if coreState.stroke != nil {
+		return
+	}
+	coreState.finishErosion()
+	coreState.goToHistory(coreState.History.Position() - 1)
+}
+
+func (coreState *State) redo() {
+	if coreState.stroke != nil {
+		return
+	}
+	coreState.finishErosion()
+	coreState.goToHistory(coreState.History.Position() + 1)
+}
+
+/**
+ * Ctrl+Z undoes, Ctrl+Y or Ctrl+Shift+Z redoes, F11 toggles fullscreen.
+ */
+func (coreState *State) handleShortcuts(g *gui.GUI) {
+	input := g.Input()
+	if input.WantCaptureKeyboard {
+		return
+	}
+	switch {
+	case input.Pressed(glfw.KeyZ, glfw.ModControl):
+		coreState.undo()
+	case input.Pressed(glfw.KeyY, glfw.ModControl) || input.Pressed(glfw.KeyZ, glfw.ModControl|glfw.ModShift):
+		coreState.redo()
+	case input.Pressed(glfw.KeyF11, 0):
+		coreState.Fullscreen = !coreState.Fullscreen
+	}
+}
+
+/**
+ * Applies the window settings changed in the UI or by shortcut.
+ */
+func (coreState *State) applyWindowSettings(g *gui.GUI) {
+	// Left or entered through the window manager rather than here.
+	if g.Fullscreen() != coreState.wasFullscreen {
+		coreState.Fullscreen = g.Fullscreen()
+	}
+	if coreState.Fullscreen != g.Fullscreen() {
+		g.SetFullscreen(coreState.Fullscreen)
+	}
+	coreState.wasFullscreen = g.Fullscreen()
+	g.SetUIScale(coreState.UIScale)
+}
+
+func (coreState *State) renderWindowUI() {
+	imgui.Checkbox("Fullscreen (F11)", &coreState.Fullscreen)
+	imgui.PushItemWidth(80)
+	imgui.SliderFloatV("UI Scale", &coreState.UIScale, 0.5, 3.0, "%.2f", 1.0)
+	imgui.PopItemWidth()
+	imgui.Text(fmt.Sprintf("Framebuffer: %d x %d", coreState.framebufferSize[0], coreState.framebufferSize[1]))
+}
+
+func (coreState *State) renderHistoryUI() {
+	h := coreState.History
+	if imgui.Button("Undo") {
+		coreState.undo()
+	}
+	imgui.SameLine()
+	if imgui.Button("Redo") {
+		coreState.redo()
+	}
+	imgui.SameLine()
+	if imgui.Button("Clear History") {
+		h.Clear()
+	}
+	imgui.Text(fmt.Sprintf("%d edits, %.1f MB", len(h.Entries()), float64(h.Size())/(1<<20)))
+	imgui.Text("Ctrl+Z: undo, Ctrl+Y: redo")
+	// Undoing pauses erosion, it carries on from wherever the history is left when resumed.
+	imgui.Checkbox("Pause Erosion##history", &coreState.ErosionPaused)
+
+	// Clicking an entry undoes or redoes up to and including it, greyed out entries have been undone.
+	imgui.BeginChildV("HistoryList", imgui.Vec2{X: 0, Y: 150}, true, 0)
+	if imgui.SelectableV("Start##history", h.Position() == 0, 0, imgui.Vec2{}) {
+		coreState.goToHistory(0)
+	}
+	for i, entry := range h.Entries() {
+		label := fmt.Sprintf("%d. %s##history%d", i+1, entry.Name, i)
+		if i >= h.Position() {
+			imgui.PushStyleColor(imgui.StyleColorText, imgui.Vec4{X: 0.5, Y: 0.5, Z: 0.5, W: 1})
+		}
+		if imgui.SelectableV(label, i == h.Position()-1, 0, imgui.Vec2{}) {
+			coreState.goToHistory(i + 1)
+		}
+		if i >= h.Position() {
+			imgui.PopStyleColor()
+		}
+	}
+	imgui.EndChild()
+}
+
+func (coreState *State) renderBrushUI() {
+	brush := coreState.Brush
+	imgui.PushItemWidth(120)
+	{
+		tool := int32(brush.Tool)
+		if combo("Tool", &tool, erosion.BrushToolNames) {
+			brush.Tool = erosion.BrushTool(tool)
+		}
+		imgui.SliderFloat("Radius (cells)", &brush.Radius, 1.0, 100.0)
+		imgui.SliderFloat("Strength", &brush.Strength, 0.001, 1.0)
+		imgui.SliderFloat("Falloff", &brush.Falloff, 0.0, 1.0)
+		if brush.Tool == erosion.BrushNoise {
+			imgui.SliderFloat("Noise Scale", &brush.NoiseScale, 1.0, 32.0)
+		}
+		imgui.PopItemWidth()
+	}
+	imgui.Text("Left drag: sculpt")
+}
+
+func (coreState *State) updateMaterialTextures() {
+	if err := coreState.Materials.UpdateTextures(); err != nil {
+		coreState.InfoValueString = err.Error()
+	}
+}
+
+func (coreState *State) renderMaterialsUI() {
+	materials := coreState.Materials
+	// Set when a layer is moved or removed, the list can't change while it's being drawn.
+	move, moveBy, remove := -1, 0, -1
+	for i := range materials.Materials {
+		material := &materials.Materials[i]
+		imgui.PushID(fmt.Sprintf("material%d", i))
+		if imgui.TreeNode(fmt.Sprintf("%d. %s###material", i+1, material.Name)) {
+			imgui.PushItemWidth(160)
+			{
+				imgui.InputText("Name", &material.Name)
+				imgui.InputText("Texture", &material.Texture)
+				imgui.SliderFloat3("Colour", &material.Colour, 0.0, 1.0)
+				imgui.DragFloatV("Scale", &material.Scale, 0.1, 0.1, 1000.0, "%.1f", 1.0)
+				imgui.DragFloatV("Min Height", &material.MinHeight, 0.01, -10.0, 10.0, "%.2f", 1.0)
+				imgui.DragFloatV("Max Height", &material.MaxHeight, 0.01, -10.0, 10.0, "%.2f", 1.0)
+				imgui.SliderFloat("Min Slope", &material.MinSlope, 0.0, 90.0)
+				imgui.SliderFloat("Max Slope", &material.MaxSlope, 0.0, 90.0)
+				imgui.SliderFloat("Sharpness", &material.Sharpness, 0.1, 20.0)
+				imgui.PopItemWidth()
+			}
+			if imgui.Button("Up") && i > 0 {
+				move, moveBy = i, -1
+			}
+			imgui.SameLine()
+			if imgui.Button("Down") && i < len(materials.Materials)-1 {
+				move, moveBy = i, 1
+			}
+			imgui.SameLine()
+			if imgui.Button("Remove") {
+				remove = i
+			}
+			imgui.TreePop()
+		}
+		imgui.PopID()
+	}
+
+	layers := materials.Materials
+	switch {
+	case move >= 0:
+		layers[move], layers[move+moveBy] = layers[move+moveBy], layers[move]
+		coreState.updateMaterialTextures()
+	case remove >= 0:
+		materials.Materials = append(layers[:remove], layers[remove+1:]...)
+		coreState.updateMaterialTextures()
+	}
+
+	if len(materials.Materials) < core.MaxMaterials && imgui.Button("Add Layer") {
+		materials.Materials = append(materials.Materials, core.Material{
+			Name: "Layer", Colour: [3]float32{1, 1, 1}, Scale: 8, MaxHeight: 10, MaxSlope: 90, Sharpness: 4,
+		})
+		coreState.updateMaterialTextures()
+	}
+	imgui.SameLine()
+	if imgui.Button("Default Layers") {
+		materials.Materials = core.DefaultMaterials()
+		coreState.updateMaterialTextures()
+	}
+	if materials.Stale() {
+		imgui.Text("Texture paths have changed.")
+		imgui.SameLine()
+		if imgui.Button("Reload Textures") {
+			coreState.updateMaterialTextures()
+		}
+	}
+}
+
+func (coreState *State) saveScene() {
+	scene := &core.Scene{
+		Materials: coreState.Materials.Materials,
+		Camera:    coreState.CameraControl.Pose(),
+		Bookmarks: coreState.CameraControl.Bookmarks,
+		Water:     &coreState.Water.WaterSettings,
+		Lighting:  &coreState.Lighting,
+	}
+	if err := core.SaveScene(coreState.ScenePath, scene); err != nil {
+		coreState.InfoValueString = fmt.Sprintf("Saving scene failed: %v", err)
+		return
+	}
+	coreState.InfoValueString = fmt.Sprintf("Saved scene to %s", coreState.ScenePath)
+}
+
+func (coreState *State) loadScene() {
+	scene, err := core.LoadScene(coreState.ScenePath)
+	if err != nil {
+		coreState.InfoValueString = fmt.Sprintf("Loading scene failed: %v", err)
+		return
+	}
+	coreState.InfoValueString = fmt.Sprintf("Loaded scene from %s", coreState.ScenePath)
+	coreState.Materials.Materials = scene.Materials
+	coreState.updateMaterialTextures()
+	coreState.CameraControl.SetPose(scene.Camera, false)
+	coreState.CameraControl.Bookmarks = scene.Bookmarks
+	if scene.Water != nil {
+		coreState.Water.WaterSettings = *scene.Water
+	}
+	if scene.Lighting != nil {
+		coreState.Lighting = *scene.Lighting
+		coreState.aoBaked = time.Time{}
+	}
+}
+
+func (coreState *State) renderWaterUI() {
+	water := &coreState.Water.WaterSettings
+	imgui.Checkbox("Show Water", &water.Enabled)
+	imgui.PushItemWidth(160)
+	{
+		imgui.SliderFloat3("Shallow Colour", &water.ShallowColour, 0.0, 1.0)
+		imgui.SliderFloat3("Deep Colour", &water.DeepColour, 0.0, 1.0)
+		imgui.SliderFloat("Absorption", &water.Absorption, 0.0, 5.0)
+		imgui.DragFloatV("Min Depth", &water.MinDepth, 0.0001, 0.0, 0.1, "%.4f", 1.0)
+		imgui.SliderFloat("Shininess", &water.Shininess, 1.0, 512.0)
+		imgui.SliderFloat("Ripple Scale", &water.RippleScale, 0.1, 20.0)
+		imgui.SliderFloat("Ripple Strength", &water.RippleStrength, 0.0, 2.0)
+		imgui.SliderFloat("Flow Speed", &water.FlowSpeed, 0.0, 10.0)
+		imgui.PopItemWidth()
+	}
+}
+
+func (coreState *State) renderSceneUI() {
+	imgui.PushItemWidth(160)
+	imgui.InputText("Scene Path", &coreState.ScenePath)
+	imgui.PopItemWidth()
+	if imgui.Button("Save Scene") {
+		coreState.saveScene()
+	}
+	imgui.SameLine()
+	if imgui.Button("Load Scene") {
+		coreState.loadScene()
+	}
+	imgui.Text("Saves the materials, water, lighting, camera and bookmarks.")
+}
+
+func (coreState *State) renderCursorUI() {
+	hit := coreState.TerrainHit
+	imgui.PushItemWidth(80)
+	imgui.SliderFloat("Cursor Size", &coreState.CursorRadius, 0.5, 100.0)
+	imgui.PopItemWidth()
+	if !hit.Hit {
+		imgui.Text("Cursor is off the terrain")
+		return
+	}
+	x, y := hit.Cell()
+	imgui.Text(fmt.Sprintf("Cell: %d, %d", x, y))
+	imgui.Text(fmt.Sprintf("World: %.2f, %.2f, %.2f", hit.Position[0], hit.Position[1], hit.Position[2]))
+	imgui.Text(fmt.Sprintf("Height: %.4f  Water: %.4f  Sediment: %.4f", hit.Height, hit.Water, hit.Sediment))
+}
+
+func (coreState *State) renderCameraUI() {
+	camera := coreState.CameraControl
+	imgui.PushItemWidth(120)
+	{
+		mode := int32(camera.Mode)
+		if combo("Mode", &mode, core.CameraModeNames) {
+			camera.Mode = core.CameraMode(mode)
+		}
+		imgui.SliderFloat("Smoothing", &camera.Smoothing, 0.0, 30.0)
+		imgui.SliderFloat("Move Speed", &camera.MoveSpeed, 1.0, 500.0)
+		imgui.PopItemWidth()
+	}
+	imgui.Text("Right drag: rotate, middle drag: pan, scroll: zoom")
+	imgui.Text("WASD: move, Q/E: down/up, Shift: faster")
+	if imgui.Button("Reset View") {
+		camera.SetPose(core.PoseLookingAt(coreState.WorldPos, mgl32.Vec3{}), false)
+	}
+
+	if imgui.TreeNode("Bookmarks") {
+		imgui.PushItemWidth(120)
+		imgui.InputText("Name", &coreState.BookmarkName)
+		imgui.PopItemWidth()
+		imgui.SameLine()
+		if imgui.Button("Save View") {
+			name := coreState.BookmarkName
+			if name == "" {
+				name = fmt.Sprintf("View %d", len(camera.Bookmarks)+1)
+			}
+			camera.AddBookmark(name)
+			coreState.BookmarkName = ""
+		}
+		for i := 0; i < len(camera.Bookmarks); i++ {
+			if imgui.Button(fmt.Sprintf("%s##bookmark%d", camera.Bookmarks[i].Name, i)) {
+				camera.GoToBookmark(i)
+			}
+			imgui.SameLine()
+			if imgui.Button(fmt.Sprintf("Delete##bookmark%d", i)) {
+				camera.RemoveBookmark(i)
+				i--
+			}
+		}
+		if imgui.Button("Save Bookmarks") {
+			if err := camera.SaveBookmarks(cameraBookmarksPath); err != nil {
+				coreState.InfoValueString = fmt.Sprintf("Saving bookmarks failed: %v", err)
+			} else {
+				coreState.InfoValueString = fmt.Sprintf("Saved %s", cameraBookmarksPath)
+			}
+		}
+		imgui.SameLine()
+		if imgui.Button("Load Bookmarks") {
+			if err := camera.LoadBookmarks(cameraBookmarksPath); err != nil {
+				coreState.InfoValueString = fmt.Sprintf("Loading bookmarks failed: %v", err)
+			} else {
+				coreState.InfoValueString = fmt.Sprintf("Loaded %s", cameraBookmarksPath)
+			}
+		}
+		imgui.TreePop()
+	}
+}
 
 func (coreState *State) renderUI(guiState *gui.State) {
 	imgui.NewFrame()
+	gui.PushStyleScale(guiState.UIScale)
 
 	treeNodeFlags := imgui.TreeNodeFlagsDefaultOpen
 	windowFlags := imgui.WindowFlagsMenuBar
@@ -262,24 +1428,88 @@ func (coreState *State) renderUI(guiState *gui.State) {
 			imgui.PushItemWidth(80)
 			{
 				imgui.SliderFloat("FOV", &coreState.FOV, 0.0, 100.0)
-				imgui.SameLine()
-				imgui.SliderFloat("Angle", &coreState.Angle, 0.0, math.Pi*2.0)
-				imgui.SliderFloat("Lighting Direction", &coreState.LightingDir, 0.01, 1.0)
 				imgui.PopItemWidth()
 			}
+			coreState.renderCameraUI()
+			imgui.TreePop()
+		}
+		imgui.Separator()
+		if imgui.TreeNodeV("Cursor", treeNodeFlags) {
+			coreState.renderCursorUI()
+			imgui.TreePop()
+		}
+		imgui.Separator()
+		if imgui.TreeNodeV("Brush", treeNodeFlags) {
+			coreState.renderBrushUI()
+			imgui.TreePop()
+		}
+		imgui.Separator()
+		if imgui.TreeNodeV("History", treeNodeFlags) {
+			coreState.renderHistoryUI()
+			imgui.TreePop()
+		}
+		imgui.Separator()
+		if imgui.TreeNodeV("Materials", treeNodeFlags) {
+			coreState.renderMaterialsUI()
+			imgui.TreePop()
+		}
+		imgui.Separator()
+		if imgui.TreeNodeV("Water", treeNodeFlags) {
+			coreState.renderWaterUI()
+			imgui.TreePop()
+		}
+		imgui.Separator()
+		if imgui.TreeNodeV("Lighting", treeNodeFlags) {
+			coreState.renderLightingUI()
+			imgui.TreePop()
+		}
+		imgui.Separator()
+		if imgui.TreeNodeV("Overlay", treeNodeFlags) {
+			coreState.renderOverlayUI()
+			imgui.TreePop()
+		}
+		imgui.Separator()
+		if imgui.TreeNodeV("Scene", treeNodeFlags) {
+			coreState.renderSceneUI()
+			imgui.TreePop()
+		}
+		imgui.Separator()
+		if imgui.TreeNodeV("Capture", treeNodeFlags) {
+			coreState.renderCaptureUI()
+			imgui.TreePop()
+		}
+		imgui.Separator()
+		if imgui.TreeNodeV("Window", 0) {
+			coreState.renderWindowUI()
+			imgui.TreePop()
+		}
+		imgui.Separator()
+		if imgui.TreeNodeV("Shaders", 0) {
+			coreState.renderShadersUI()
 			imgui.TreePop()
 		}
 		imgui.Separator()
 		if imgui.TreeNodeV("Terrain", treeNodeFlags) {
 			imgui.PushItemWidth(80)
 			{
-				imgui.SliderFloat("Height", &coreState.Height, 0.0, 100.0)
+				if imgui.SliderFloat("Height", &coreState.Height, 0.0, 100.0) {
+					coreState.aoBaked = time.Time{}
+				}
 				imgui.SliderFloat("Spread", &coreState.Spread, 0.0, 1.0)
 				imgui.SliderFloat("Reduce", &coreState.Reduce, 0.0, 1.0)
+				imgui.SliderFloat("LOD Distance", &coreState.Terrain.LODDistance, 10.0, 1000.0)
+				imgui.SliderFloat("Skirt Depth", &coreState.Terrain.SkirtDepth, 0.0, 20.0)
+				if combo("Mesh Resolution", &coreState.MeshResolution, meshResolutionNames) {
+					coreState.rebuildTerrain()
+				}
 				imgui.PopItemWidth()
 			}
+			drawn, total := coreState.Terrain.Stats()
+			imgui.Text(fmt.Sprintf("Patches drawn: %d / %d", drawn, total))
 			if imgui.Button("Regenerate Terrain") {
-				coreState.MidpointGen.Generate(coreState.Spread, coreState.Reduce)
+				edit := coreState.beginEdit("Regenerate Terrain", history.Snapshot, coreState.GPUEroder, coreState.TerrainEroder)
+				coreState.Generator.Generate(coreState.Spread, coreState.Reduce)
+				coreState.Terrain.UpdateBounds(heightmap.FromGenerator(coreState.Generator))
 
 				// Reset CPU sim
 				coreState.TerrainEroder.Reset()
@@ -287,6 +1517,7 @@ func (coreState *State) renderUI(guiState *gui.State) {
 
 				// Reset GPU sim
 				coreState.GPUEroder.Reset()
+				coreState.finishEdit(edit, coreState.wholeTerrain())
 			}
 			imgui.TreePop()
 		}
@@ -299,15 +1530,26 @@ func (coreState *State) renderUI(guiState *gui.State) {
 				}
 				if imgui.Button(runningLabel) {
 					coreState.TerrainEroder.Toggle()
+					// Each run of the simulation is one step in the history.
+					if coreState.TerrainEroder.IsRunning() {
+						coreState.simulationRun = coreState.beginEdit("CPU Erosion", history.Snapshot, coreState.TerrainEroder)
+					} else if coreState.simulationRun != nil {
+						coreState.finishEdit(coreState.simulationRun, coreState.wholeTerrain())
+						coreState.simulationRun = nil
+					}
 				}
 				imgui.SameLine()
 				if imgui.Button("Step Simulation") {
+					edit := coreState.beginEdit("CPU Erosion Step", history.Snapshot, coreState.TerrainEroder)
 					coreState.TerrainEroder.SimulationStep()
 					coreState.TerrainEroder.SimulationStep()
+					coreState.finishEdit(edit, coreState.wholeTerrain())
 				}
 				if imgui.Button("Reset Simulation") {
+					edit := coreState.beginEdit("Reset CPU Simulation", history.Snapshot, coreState.TerrainEroder)
 					coreState.TerrainEroder.Reset()
 					coreState.TerrainEroder.Initialise()
+					coreState.finishEdit(edit, coreState.wholeTerrain())
 				}
 				imgui.TreePop()
 			}
@@ -324,10 +1566,154 @@ func (coreState *State) renderUI(guiState *gui.State) {
 			}
 			imgui.TreePop()
 		}
+		imgui.Separator()
+		if imgui.TreeNodeV("Export", treeNodeFlags) {
+			settings := &coreState.Export
+			imgui.PushItemWidth(160)
+			{
+				combo("Source", &settings.Source, sourceNames)
+				combo("Format", &settings.Format, export.FormatNames)
+				imgui.InputText("Path", &settings.Path)
+				imgui.Checkbox("Normalise", &settings.Options.Normalise)
+				if settings.Options.Normalise {
+					imgui.DragFloatV("Min", &settings.Options.Min, 0.01, -10.0, 10.0, "%.3f", 1.0)
+					imgui.DragFloatV("Max", &settings.Options.Max, 0.01, -10.0, 10.0, "%.3f", 1.0)
+					imgui.Text("Set Min = Max to use the data range.")
+				}
+				imgui.PopItemWidth()
+			}
+			if imgui.Button("Export") {
+				coreState.exportHeightmap()
+			}
+			imgui.SameLine()
+			if imgui.Button("Export Layers") {
+				coreState.exportLayers()
+			}
+			imgui.PushItemWidth(160)
+			{
+				combo("Mesh Format", &settings.MeshFormat, export.MeshFormatNames)
+				imgui.DragFloatV("Horizontal Scale", &settings.Mesh.HorizontalScale, 0.01, 0.01, 100.0, "%.2f", 1.0)
+				imgui.DragFloatV("Vertical Scale", &settings.Mesh.VerticalScale, 0.5, 0.0, 1000.0, "%.1f", 1.0)
+				imgui.PopItemWidth()
+			}
+			if imgui.Button("Export Mesh") {
+				coreState.exportMesh()
+			}
+			if imgui.TreeNode("Contours") {
+				imgui.PushItemWidth(160)
+				{
+					combo("Contour Format", &settings.ContourFormat, export.ContourFormatNames)
+					imgui.PopItemWidth()
+				}
+				imgui.Text("Interval and index contours are set under Overlay.")
+				if imgui.Button("Export Contours") {
+					coreState.exportContours()
+				}
+				imgui.TreePop()
+			}
+			if imgui.TreeNode("Relief Map") {
+				relief := &settings.Relief
+				imgui.PushItemWidth(160)
+				{
+					palette := int32(relief.Palette)
+					if combo("Palette", &palette, export.ReliefPaletteNames) {
+						relief.Palette = export.ReliefPalette(palette)
+					}
+					imgui.SliderFloat("Light Azimuth", &relief.Azimuth, 0.0, 360.0)
+					imgui.SliderFloat("Light Altitude", &relief.Altitude, 1.0, 90.0)
+					imgui.DragFloatV("Z Factor", &relief.ZFactor, 1.0, 0.0, 10000.0, "%.0f", 1.0)
+					imgui.SliderFloat("Shading", &relief.Shading, 0.0, 1.0)
+					imgui.PopItemWidth()
+				}
+				if imgui.Button("Match 3D View") {
+					relief.ZFactor = coreState.Height / coreState.Terrain.CellSize()
+				}
+				imgui.Checkbox("Multidirectional", &relief.Multidirectional)
+				imgui.Checkbox("Water", &relief.Water)
+				if imgui.Button("Export Relief Map") {
+					coreState.exportRelief()
+				}
+				imgui.TreePop()
+			}
+			if imgui.TreeNode("Texture Maps") {
+				bake := &settings.Bake
+				imgui.Checkbox("Normal Map", &bake.Normals)
+				imgui.SameLine()
+				imgui.Checkbox("AO", &bake.AO)
+				imgui.SameLine()
+				imgui.Checkbox("Curvature", &bake.Curvature)
+				imgui.PushItemWidth(160)
+				{
+					imgui.DragFloatV("Bake Z Factor", &bake.ZFactor, 1.0, 0.0, 10000.0, "%.0f", 1.0)
+					imgui.SliderFloat("AO Radius (cells)", &bake.AORadius, 1.0, 256.0)
+					directions := int32(bake.AODirections)
+					if imgui.SliderInt("AO Directions", &directions, 4, 64) {
+						bake.AODirections = int(directions)
+					}
+					imgui.SliderFloat("Curvature Radius (cells)", &bake.CurvatureRadius, 1.0, 64.0)
+					imgui.PopItemWidth()
+				}
+				if imgui.Button("Match 3D View##bake") {
+					bake.ZFactor = coreState.Height / coreState.Terrain.CellSize()
+				}
+				imgui.Checkbox("DirectX Normals (Flip Green)", &bake.FlipGreen)
+				if imgui.Button("Bake Maps") {
+					coreState.exportBakes()
+				}
+				imgui.TreePop()
+			}
+			if imgui.TreeNode("3D Print") {
+				imgui.PushItemWidth(160)
+				{
+					imgui.DragFloatV("Size (mm)", &settings.Solid.Size, 1.0, 10.0, 1000.0, "%.0f", 1.0)
+					imgui.DragFloatV("Base (mm)", &settings.Solid.Base, 0.1, 0.4, 50.0, "%.1f", 1.0)
+					imgui.DragFloatV("Relief (mm)", &settings.Solid.VerticalScale, 0.5, 0.0, 500.0, "%.1f", 1.0)
+					decimation := int32(settings.Solid.Decimation)
+					if imgui.SliderInt("Decimation", &decimation, 1, 16) {
+						settings.Solid.Decimation = int(decimation)
+					}
+					imgui.PopItemWidth()
+				}
+				if imgui.Button("Export Solid STL") {
+					coreState.exportSolid()
+				}
+				imgui.TreePop()
+			}
+			if imgui.TreeNode("DEM (GeoTIFF / ASCII Grid)") {
+				imgui.PushItemWidth(160)
+				{
+					imgui.InputText("DEM Path", &settings.DEMPath)
+					combo("GeoTIFF Samples", &settings.DEMSampleType, gis.SampleTypeNames)
+					imgui.PopItemWidth()
+				}
+				if imgui.Button("Import DEM") {
+					coreState.importDEM()
+				}
+				imgui.SameLine()
+				if imgui.Button("Export DEM") {
+					coreState.exportDEM()
+				}
+				if _, imported := coreState.Generator.(*gis.DEM); imported {
+					if imgui.Button("Use Generated Terrain") {
+						if err := coreState.useGenerator(coreState.MidpointGen); err != nil {
+							coreState.InfoValueString = err.Error()
+						}
+					}
+				}
+				imgui.TreePop()
+			}
+			if coreState.InfoValueString != "" {
+				imgui.Text(coreState.InfoValueString)
+			}
+			imgui.TreePop()
+		}
 	}
 	imgui.End()
 
+	renderShaderErrors()
+
 	if imgui.BeginV("Simulation Settings", &guiState.TerrainWindowOpen, windowFlags) {
+		imgui.Checkbox("Pause Erosion", &coreState.ErosionPaused)
 		erosionState := coreState.ErosionState
 		imgui.SliderFloat("Carry Capacity", &erosionState.SedimentCarryCapacity, 0.0, 2.0)
 		imgui.SliderFloat("Sediment Suspension Rate", &erosionState.SoilSuspensionRate, 0.0, 2.0)
@@ -339,11 +1725,31 @@ func (coreState *State) renderUI(guiState *gui.State) {
 	}
 	imgui.End()
 
+	gui.PopStyleScale()
 	imgui.EndFrame()
 	imgui.Render()
 }
 
 func render(g *gui.GUI, coreState *State, timer time.Time) {
+	var dt float32
+	if !coreState.lastFrame.IsZero() {
+		dt = float32(math.Min(timer.Sub(coreState.lastFrame).Seconds(), 0.1))
+	}
+	coreState.lastFrame = timer
+	coreState.checkShaders(timer)
+	coreState.updateCamera(g, dt)
+	coreState.handleShortcuts(g)
+	if coreState.Capture.Recording() && coreState.Capture.Mode == export.SequenceOrbit {
+		pose := coreState.orbitPose
+		pose.Yaw += coreState.Capture.OrbitAngle()
+		coreState.CameraControl.SetPose(pose, true)
+	}
+
+	coreState.applyWindowSettings(g)
+	width, height := g.FramebufferSize()
+	coreState.framebufferSize = [2]int{width, height}
+	gl.Viewport(0, 0, int32(width), int32(height))
+
 	gl.Enable(gl.DEPTH_TEST)
 	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
 
@@ -352,27 +1758,35 @@ func render(g *gui.GUI, coreState *State, timer time.Time) {
 	//	gl.UseProgram(coreState.Program)
 	//	updateUniforms(coreState)
 	//	coreState.TerrainEroder.UpdateBuffers()
+	//	coreState.Terrain.UpdateNormals(coreState.TerrainEroder.Heightmap(), coreState.Height)
 	//	{
 	//		gl.ActiveTexture(gl.TEXTURE0)
 	//		gl.Uniform1i(coreState.Uniforms["waterHeightUniform"], 0)
 	//		gl.ActiveTexture(gl.TEXTURE1)
 	//		gl.Uniform1i(coreState.Uniforms["heightmapUniform"], 1)
 	//	}
-	//	coreState.Plane.M().Draw()
+	//	coreState.Terrain.Draw(coreState.Projection.Mul4(coreState.Camera), coreState.CameraPos, coreState.Height)
 	//}
 
-	// Render Terrain GPU
-	{
-		gl.UseProgram(coreState.Program)
-		updateUniforms(coreState)
-		coreState.Plane.M().Draw()
+	coreState.updateLighting(timer)
+	coreState.updateBounds(timer)
+
+	// Nothing to draw into while minimised, the simulation carries on.
+	if width > 0 && height > 0 {
+		coreState.drawScene(float32(width)/float32(height), true)
+
+		// The marker follows next frame, picking uses the matrices the terrain was just drawn with.
+		coreState.pickTerrain(g)
+		coreState.applyBrush(g, dt)
 	}
 
-	coreState.GPUEroder.Pass()
-	coreState.iterations++
-	fmt.Printf("%d Iterations\n", coreState.iterations)
+	coreState.erode()
+	for _, mesh := range coreState.Terrain.Meshes() {
+		coreState.GPUEroder.UpdateNormals(mesh, coreState.Terrain.CellSize(), coreState.Terrain.SampleSpacing(), coreState.Height)
+	}
+	coreState.capture()
 
-	sWidth, sHeight := coreState.MidpointGen.Dimensions()
+	sWidth, sHeight := coreState.Generator.Dimensions()
 
 	/*
 	 * Read from our simulation state into a draw framebuffer for visualisation.
@@ -405,7 +1819,5 @@ func render(g *gui.GUI, coreState *State, timer time.Time) {
 		g.Render(coreState.renderUI)
 	}
 
-	width, height := g.GetSize()
-	gl.Viewport(0, 0, int32(width), int32(height))
 	g.SwapBuffers()
 }
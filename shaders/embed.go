@@ -0,0 +1,62 @@
+//go:build ignore
+// +build ignore
+
+package main
+
+/**
+ * Writes embedded.go, holding every shader under this directory as a string.
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var extensions = map[string]bool{".vert": true, ".frag": true, ".comp": true, ".glsl": true}
+
+func main() {
+	var names []string
+	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && extensions[filepath.Ext(path)] {
+			names = append(names, filepath.ToSlash(path))
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by embed.go; DO NOT EDIT.\n\npackage shaders\n\n")
+	fmt.Fprintf(&b, "var names = []string{\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "%q,\n", name)
+	}
+	fmt.Fprintf(&b, "}\n\nvar sources = map[string]string{\n")
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(&b, "%q: %q,\n", name, data)
+	}
+	fmt.Fprintf(&b, "}\n")
+
+	source, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("embedded.go", source, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,45 @@
+// Code generated by embed.go; DO NOT EDIT.
+
+package shaders
+
+var names = []string{
+	"Brush.comp",
+	"Erosion.comp",
+	"HorizonAO.comp",
+	"Normals.comp",
+	"OutFlow.comp",
+	"Pick.comp",
+	"Sediment.comp",
+	"Velocity.comp",
+	"WaterHeight.comp",
+	"WaterPass.comp",
+	"include/height.glsl",
+	"include/simulation.glsl",
+	"main.frag",
+	"main.vert",
+	"shadow.frag",
+	"shadow.vert",
+	"water.frag",
+	"water.vert",
+}
+
+var sources = map[string]string{
+	"Brush.comp":              "#version 430 core\n\nlayout (local_size_x = 16, local_size_y = 16) in;\n#include \"include/simulation.glsl\"\n\n// Keep in step with erosion.BrushTool.\nconst int BRUSH_RAISE = 1;\nconst int BRUSH_LOWER = 2;\nconst int BRUSH_SMOOTH = 3;\nconst int BRUSH_FLATTEN = 4;\nconst int BRUSH_NOISE = 5;\nconst int BRUSH_ERODE = 6;\n// See erosion.brushBlendRate.\nconst float BLEND_RATE = 10.0;\n\nuniform int tool;\n// First cell covered by the dispatch.\nuniform ivec2 boundsMin;\nuniform vec2 centre;\nuniform float radius;\nuniform float falloff;\n// strength * dt\nuniform float amount;\nuniform float targetHeight;\nuniform float noiseScale;\n\nfloat brushWeight(float distance) {\n    if(radius <= 0.0 || distance >= radius) {\n        return 0.0;\n    }\n    float r = distance / radius;\n    float inner = 1.0 - falloff;\n    if(r <= inner) {\n        return 1.0;\n    }\n    return 1.0 - smoothstep(0.0, 1.0, (r - inner) / falloff);\n}\n\nfloat latticeValue(uint x, uint y) {\n    uint h = x * 374761393u + y * 668265263u;\n    h = (h ^ (h >> 13)) * 1274126177u;\n    h ^= h >> 16;\n    return float(h & 0xffffffu) / float(0xffffff) * 2.0 - 1.0;\n}\n\nfloat valueNoise(vec2 p) {\n    vec2 cell = floor(p);\n    vec2 t = p - cell;\n    t = t * t * (3.0 - 2.0 * t);\n    uvec2 i = uvec2(ivec2(cell));\n    float top = mix(latticeValue(i.x, i.y), latticeValue(i.x + 1u, i.y), t.x);\n    float bottom = mix(latticeValue(i.x, i.y + 1u), latticeValue(i.x + 1u, i.y + 1u), t.x);\n    return mix(top, bottom, t.y);\n}\n\nvoid main() {\n    ivec2 size = imageSize(currentHeightTex);\n    ivec2 storePos = boundsMin + ivec2(gl_GlobalInvocationID.xy);\n    if(any(greaterThanEqual(storePos, size))) {\n        return;\n    }\n\n    vec4 texel = imageLoad(currentHeightTex, storePos);\n    float weight = amount * brushWeight(distance(vec2(storePos), centre));\n    if(weight <= 0.0) {\n        return;\n    }\n    float blend = min(1.0, weight * BLEND_RATE);\n\n    if(tool == BRUSH_RAISE) {\n        texel.r += weight;\n    } else if(tool == BRUSH_LOWER) {\n        texel.r -= weight;\n    } else if(tool == BRUSH_SMOOTH) {\n        float sum = 0.0;\n        for(int dx = -1; dx <= 1; dx++) {\n            for(int dy = -1; dy <= 1; dy++) {\n                sum += imageLoad(currentHeightTex, clamp(storePos + ivec2(dx, dy), ivec2(0), size - 1)).r;\n            }\n        }\n        texel.r += (sum / 9.0 - texel.r) * blend;\n    } else if(tool == BRUSH_FLATTEN) {\n        texel.r += (targetHeight - texel.r) * blend;\n    } else if(tool == BRUSH_NOISE) {\n        texel.r += weight * valueNoise(vec2(storePos) / noiseScale);\n    } else if(tool == BRUSH_ERODE) {\n        texel.g += weight;\n    }\n    texel.r = max(texel.r, 0.0);\n    texel.g = max(texel.g, 0.0);\n\n    imageStore(nextHeightTex, storePos, texel);\n}\n",
+	"Erosion.comp":            "#version 430 core\n\nlayout (local_size_x = 32, local_size_y = 32) in;\n\n#include \"include/simulation.glsl\"\n\nuniform float sedimentCarryCapacity;\nuniform float soilSuspensionRate;\nuniform float sedimentDepositionRate;\nuniform float maximumErodeDepth;\nuniform float deltaTime;\n\nvoid main() {\n    /////----------------------------------\n    vec4 currentHeightTexel, currentOutflowTexel, currentVelocityTexel;\n    vec4 nextHeightTexel, nextOutflowTexel, nextVelocityTexel;\n    /////----------------------------------\n    ivec2 storePos = ivec2(gl_GlobalInvocationID.xy);\n    ivec2 leftStorePos = ivec2(storePos.x - 1, storePos.y);\n    ivec2 rightStorePos = ivec2(storePos.x + 1, storePos.y);\n    ivec2 topStorePos = ivec2(storePos.x, storePos.y - 1);\n    ivec2 bottomStorePos = ivec2(storePos.x, storePos.y + 1);\n    // Current Data\n    currentHeightTexel = imageLoad(currentHeightTex, storePos);\n    // Next Data\n    nextHeightTexel = imageLoad(nextHeightTex, storePos);\n    nextOutflowTexel = imageLoad(nextOutflowTex, storePos);\n    nextVelocityTexel = imageLoad(nextVelocityTex, storePos);\n\n    // Load directional height data.\n    vec4 leftCurrentHeightTexel = imageLoad(currentHeightTex, leftStorePos);\n    vec4 rightCurrentHeightTexel = imageLoad(currentHeightTex, rightStorePos);\n    vec4 topCurrentHeightTexel = imageLoad(currentHeightTex, topStorePos);\n    vec4 bottomCurrentHeightTexel = imageLoad(currentHeightTex, bottomStorePos);\n\n    // Get total terrain height (water + land column)\n    float centreCurrentTerrainHeight = currentHeightTexel.r;\n    float leftCurrentTerrainHeight = leftCurrentHeightTexel.r - leftCurrentHeightTexel.g;\n    float rightCurrentTerrainHeight = rightCurrentHeightTexel.r + rightCurrentHeightTexel.g;\n    float topCurrentTerrainHeight = topCurrentHeightTexel.r - topCurrentHeightTexel.g;\n    float bottomCurrentTerrainHeight = bottomCurrentHeightTexel.r + bottomCurrentHeightTexel.g;\n\n    // Calculating the tilt angle\n    // Based on:\n    // https://math.stackexchange.com/questions/1044044/local-tilt-angle-based-on-height-field\n    float dx = (rightCurrentTerrainHeight - leftCurrentTerrainHeight) / 2.0;\n    float dy = (bottomCurrentTerrainHeight - topCurrentTerrainHeight) / 2.0;\n    float changes = dx * dx + dy * dy;\n    float tiltAngle = sqrt(1.0 / (1.0 + changes));\n\n    // Get the velocity magnitude\n    float velocityMagnitude = nextVelocityTexel.r;\n\n    // Calculate the water sediment carry capacity (how much sediment can this grid cell carry?)\n    // Notation: {C}\n    float currentSedimentCarryCapacity = sedimentCarryCapacity * min(tiltAngle, maximumErodeDepth) * velocityMagnitude;\n\n\n    // Caclulate the sediment carry capacity for the current grid point.\n    // Notation: {St}.\n    float currentDissolvedSediment = nextHeightTexel.b;\n\n    // Carry out erosion or deposition based upon the calculated carry capacity.\n    // TODO: Look at manipulating the water height here too \"stability\".\n    if(currentDissolvedSediment < currentSedimentCarryCapacity) {\n        // Dissolve land into water as sediment.\n        // TODO: Involve R(x, y) a hardness coefficient, maybe make upper regions harder?\n        float delta = soilSuspensionRate * (currentSedimentCarryCapacity - currentDissolvedSediment);\n        nextHeightTexel.r -= deltaTime * delta; // Terrain height\n        nextHeightTexel.g += deltaTime * delta; // Water Height.\n        nextHeightTexel.b += deltaTime * delta; // Sediment\n    } else {\n        // Deposit sediment onto land.\n        float delta = sedimentDepositionRate * (currentDissolvedSediment - currentSedimentCarryCapacity);\n        nextHeightTexel.r +=  deltaTime * delta; // Terrain height\n        nextHeightTexel.g -= deltaTime * delta; // Water Height.\n        nextHeightTexel.b -=  deltaTime * delta; // Sediment\n    }\n    nextHeightTexel.g *= (1.0 - 0.15 * deltaTime);\n\n    imageStore(nextHeightTex, storePos, nextHeightTexel);\n    imageStore(nextOutflowTex, storePos, nextOutflowTexel);\n    imageStore(nextVelocityTex, storePos, nextVelocityTexel);\n}",
+	"HorizonAO.comp":          "#version 430 core\n\nlayout (local_size_x = 16, local_size_y = 16) in;\n#include \"include/height.glsl\"\n// Fraction of the sky visible from each cell.\nlayout (r32f, binding = 6) writeonly uniform highp image2D aoImage;\n\nuniform int directions;\nuniform int steps;\n// World distance searched, and between neighbouring cells.\nuniform float radius;\nuniform float cellSize;\nuniform float heightScale;\n\nconst float PI = 3.14159265;\n\nfloat heightAt(vec2 cell) {\n    return stateAt(cell, 0.0).r * heightScale;\n}\n\nvoid main() {\n    ivec2 cell = ivec2(gl_GlobalInvocationID.xy);\n    if(any(greaterThanEqual(cell, imageSize(aoImage)))) {\n        return;\n    }\n    float centre = heightAt(vec2(cell));\n    float radiusCells = radius / cellSize;\n\n    // For each direction find the highest angle to the horizon, the sky below it is hidden.\n    float occlusion = 0.0;\n    for(int d = 0; d < directions; d++) {\n        float angle = 2.0 * PI * (float(d) + 0.5) / float(directions);\n        vec2 direction = vec2(cos(angle), sin(angle));\n        float horizon = 0.0;\n        for(int s = 1; s <= steps; s++) {\n            // Steps grow with distance, nearby terrain matters most.\n            float t = float(s) / float(steps);\n            float distanceCells = radiusCells * t * t;\n            if(distanceCells < 1.0) {\n                continue;\n            }\n            float rise = heightAt(vec2(cell) + direction * distanceCells) - centre;\n            horizon = max(horizon, rise / (distanceCells * cellSize));\n        }\n        // sin of the horizon angle.\n        occlusion += horizon / sqrt(1.0 + horizon * horizon);\n    }\n    imageStore(aoImage, cell, vec4(1.0 - occlusion / float(directions)));\n}\n",
+	"Normals.comp":            "#version 430 core\n\nlayout (local_size_x = 64) in;\n#include \"include/height.glsl\"\n\n// Interleaved vertex data of the terrain mesh: position (3), normal (3), texcoord (2), sample coords (2).\nlayout (std430, binding = 0) buffer Vertices {\n    float vertices[];\n};\n\nuniform int vertexCount;\nuniform int vertexStride;\nuniform int normalOffset;\nuniform int sampleCoordOffset;\n// World units between neighbouring cells, and the multiplier applied to heights when drawing.\nuniform float cellSize;\nuniform float heightScale;\n// Cells between neighbouring vertices, differences are taken over this distance.\nuniform float sampleSpacing;\n\nfloat heightAt(vec2 cell, float lod) {\n    return stateAt(cell, lod).r;\n}\n\nvoid main() {\n    int vertex = int(gl_GlobalInvocationID.x);\n    if(vertex >= vertexCount) {\n        return;\n    }\n    int base = vertex * vertexStride;\n    vec2 samplePos = vec2(vertices[base + sampleCoordOffset], vertices[base + sampleCoordOffset + 1]);\n\n    float spacing = max(sampleSpacing, 1.0);\n    float lod = log2(spacing);\n\n    // Central differences, the cell x axis runs along world Z and the cell y axis along world X.\n    float dx = (heightAt(samplePos + vec2(spacing, 0.0), lod) - heightAt(samplePos - vec2(spacing, 0.0), lod)) / (2.0 * spacing);\n    float dy = (heightAt(samplePos + vec2(0.0, spacing), lod) - heightAt(samplePos - vec2(0.0, spacing), lod)) / (2.0 * spacing);\n    vec3 normal = normalize(vec3(-dy * heightScale / cellSize, 1.0, -dx * heightScale / cellSize));\n\n    vertices[base + normalOffset + 0] = normal.x;\n    vertices[base + normalOffset + 1] = normal.y;\n    vertices[base + normalOffset + 2] = normal.z;\n}\n",
+	"OutFlow.comp":            "#version 430 core\n\nlayout (local_size_x = 32, local_size_y = 32) in;\n\n#include \"include/simulation.glsl\"\n\nuniform float deltaTime;\nuniform float pipeCrossSectionalArea;\nuniform float gravitationalConstant;\n\nvoid main() {\n    // TODO: 1. Bounds check\n    // TODO: 2. Set outflow to zero if at bounds\n    // TODO: 3. Double check variables\n    // TODO: 4. Ensure that min/max checks are carried out where appropriate\n    // TODO: 5. Abstract texel lookups into dedicated method.\n\n    /////----------------------------------\n\n    vec4 currentOutflowTexel;\n    vec4 nextHeightTexel;\n\n    /////----------------------------------\n\n    ivec2 storePos = ivec2(gl_GlobalInvocationID.xy);\n    nextHeightTexel = imageLoad(nextHeightTex, storePos);\n    currentOutflowTexel = imageLoad(currentOutflowTex, storePos);\n\n    /////----------------------------------\n\n    float currentTerrainHeight = nextHeightTexel.r;\n    float nextWaterHeight = nextHeightTexel.g;\n    float totalHeight = currentTerrainHeight + nextWaterHeight;\n    float pressure = deltaTime * pipeCrossSectionalArea * gravitationalConstant;\n\n    /////------------LEFT OUTFLOW---------////////\n    ivec2 leftStorePos = ivec2(storePos.x - 1, storePos.y);\n    vec4 leftCurrentHeightTexel = imageLoad(currentHeightTex, leftStorePos);\n    vec4 leftNextHeightTexel = imageLoad(nextHeightTex, leftStorePos);\n\n    float leftCurrentTerrainHeight = leftCurrentHeightTexel.r;\n    // We use the \"next\" water height because this has just been updated in the previous\n    // step of the pipeline, which increments the water height.\n    // TODO: Look at using \"current\", does this make a difference?\n    float leftNextWaterHeight = leftNextHeightTexel.g;\n    float leftTotalHeight = leftCurrentTerrainHeight + leftNextWaterHeight;\n\n    float leftHeightDiff = totalHeight - leftTotalHeight;\n    float leftOutflow = max(0.0, currentOutflowTexel.r + pressure * leftHeightDiff);\n\n    /////------------RIGHT OUTFLOW---------////////\n    ivec2 rightStorePos = ivec2(storePos.x + 1, storePos.y);\n    vec4 rightCurrentHeightTexel = imageLoad(currentHeightTex, rightStorePos);\n    vec4 rightNextHeightTexel = imageLoad(nextHeightTex, rightStorePos);\n\n    float rightCurrentTerrainHeight = rightCurrentHeightTexel.r;\n    float rightNextWaterHeight = rightNextHeightTexel.g;\n    float rightTotalHeight = rightCurrentTerrainHeight + rightNextWaterHeight;\n\n    float rightHeightDiff = totalHeight - rightTotalHeight;\n    float rightOutflow = max(0.0, currentOutflowTexel.g + pressure * rightHeightDiff);\n\n    /////------------TOP OUTFLOW---------////////\n    ivec2 topStorePos = ivec2(storePos.x, storePos.y - 1);\n    vec4 topCurrentHeightTexel = imageLoad(currentHeightTex, topStorePos);\n    vec4 topNextHeightTexel = imageLoad(nextHeightTex, topStorePos);\n\n    float topCurrentTerrainHeight = topCurrentHeightTexel.r;\n    float topNextWaterHeight = topNextHeightTexel.g;\n    float topTotalHeight = topCurrentTerrainHeight + topNextWaterHeight;\n\n    float topHeightDiff = totalHeight - topTotalHeight;\n    float topOutflow = max(0.0, currentOutflowTexel.b + pressure * topHeightDiff);\n\n    /////------------BOTTOM OUTFLOW---------////////\n    ivec2 bottomStorePos = ivec2(storePos.x, storePos.y + 1);\n    vec4 bottomCurrentHeightTexel = imageLoad(currentHeightTex, bottomStorePos);\n    vec4 bottomNextHeightTexel = imageLoad(nextHeightTex, bottomStorePos);\n\n    float bottomCurrentTerrainHeight = bottomCurrentHeightTexel.r;\n    float bottomNextWaterHeight = bottomNextHeightTexel.g;\n    float bottomTotalHeight = bottomCurrentTerrainHeight + bottomNextWaterHeight;\n\n    float bottomHeightDiff = totalHeight - bottomTotalHeight;\n    float bottomOutflow = max(0.0, currentOutflowTexel.a + pressure * bottomHeightDiff);\n\n\n    /////------------TOTAL OUTFLOW---------////////\n    float flux = leftOutflow + rightOutflow + topOutflow + bottomOutflow;\n    float scale = min(1.0, nextWaterHeight / (flux * deltaTime));\n\n\n    if(storePos.x == 0) {\n        leftOutflow = 0.0;\n    }\n\n    if(storePos.y == 0) {\n        topOutflow = 0.0;\n    }\n\n    if(storePos.x == 511) {\n        rightOutflow = 0.0;\n    }\n\n    if(storePos.y == 511) {\n        bottomOutflow = 0.0;\n    }\n\n    /**\n     * Cell outflow vector direction mapping\n     * r -> left\n     * g -> right\n     * b -> top\n     * a -> bottom\n     */\n    vec4 nextOutflowTexel = vec4(\n        max(0.0, leftOutflow*scale),\n        max(0.0, rightOutflow*scale),\n        max(0.0, topOutflow*scale),\n        max(0.0, bottomOutflow*scale)\n    );\n\n    imageStore(nextOutflowTex, storePos, nextOutflowTexel);\n}",
+	"Pick.comp":               "#version 430 core\n\nlayout (local_size_x = 1) in;\n#include \"include/height.glsl\"\n\nlayout (std430, binding = 1) buffer PickResult {\n    vec4 hitPosition; // xyz -> world position, w -> 1 if the ray hit the terrain\n    vec4 hitCell;     // xy -> fractional cell\n    vec4 hitState;    // height state texel of the cell\n};\n\nuniform vec3 rayOrigin;\nuniform vec3 rayDirection;\n// World X and Z of cell (0, 0), world units between cells and the height multiplier used when drawing.\nuniform vec2 cellOrigin;\nuniform float cellSize;\nuniform float heightScale;\n\nconst int maxSteps = 4096;\nconst int refineSteps = 16;\n\n// The cell x axis runs along world Z and the cell y axis along world X.\nvec2 cellAt(vec3 p) {\n    return vec2((p.z - cellOrigin.y) / cellSize, (p.x - cellOrigin.x) / cellSize);\n}\n\nfloat terrainAt(vec3 p) {\n    return stateAt(cellAt(p), 0.0).r * heightScale;\n}\n\nvoid main() {\n    hitPosition = vec4(0.0);\n    hitCell = vec4(0.0);\n    hitState = vec4(0.0);\n\n    // Clip the ray to the footprint of the terrain.\n    vec2 size = vec2(textureSize(heightSampler, 0));\n    vec2 boxMin = cellOrigin;\n    vec2 boxMax = cellOrigin + (size.yx - 1.0) * cellSize;\n    vec2 inverse = 1.0 / rayDirection.xz;\n    vec2 t0 = (boxMin - rayOrigin.xz) * inverse;\n    vec2 t1 = (boxMax - rayOrigin.xz) * inverse;\n    float tEnter = max(max(min(t0.x, t1.x), min(t0.y, t1.y)), 0.0);\n    float tExit = min(max(t0.x, t1.x), max(t0.y, t1.y));\n    if(tEnter > tExit) {\n        return;\n    }\n\n    // March until the ray drops below the terrain, taking bigger steps while it is high above.\n    float previous = tEnter;\n    float t = tEnter;\n    bool found = false;\n    for(int i = 0; i < maxSteps && t <= tExit; i++) {\n        vec3 p = rayOrigin + rayDirection * t;\n        float above = p.y - terrainAt(p);\n        if(above < 0.0) {\n            found = true;\n            break;\n        }\n        previous = t;\n        t += max(cellSize * 0.5, above * 0.4);\n    }\n    if(!found) {\n        return;\n    }\n\n    // Bisect between the last point above and the first point below.\n    for(int i = 0; i < refineSteps; i++) {\n        float middle = (previous + t) * 0.5;\n        vec3 p = rayOrigin + rayDirection * middle;\n        if(p.y - terrainAt(p) < 0.0) {\n            t = middle;\n        } else {\n            previous = middle;\n        }\n    }\n\n    vec3 hit = rayOrigin + rayDirection * t;\n    vec2 cell = cellAt(hit);\n    hitPosition = vec4(hit.x, terrainAt(hit), hit.z, 1.0);\n    hitCell = vec4(cell, 0.0, 0.0);\n    hitState = texelFetch(heightSampler, ivec2(clamp(floor(cell + 0.5), vec2(0.0), size - 1.0)), 0);\n}\n",
+	"Sediment.comp":           "#version 430 core\n\nlayout (local_size_x = 32, local_size_y = 32) in;\n\n#include \"include/simulation.glsl\"\n\nuniform float deltaTime;\n\nvoid main() {\n    /////----------------------------------\n    vec4 currentHeightTexel, currentOutflowTexel, currentVelocityTexel;\n    vec4 nextHeightTexel, nextOutflowTexel, nextVelocityTexel;\n    /////----------------------------------\n    ivec2 storePos = ivec2(gl_GlobalInvocationID.xy);\n    // Current Data\n    currentHeightTexel = imageLoad(currentHeightTex, storePos);\n    // Next Data\n    nextHeightTexel = imageLoad(nextHeightTex, storePos);\n    nextVelocityTexel = imageLoad(nextVelocityTex, storePos);\n\n    ivec2 vel = ivec2(int(nextVelocityTexel.g * deltaTime), int(nextVelocityTexel.b * deltaTime));\n    ivec2 sum = storePos - vel;\n    vec4 advectedLocationHeight = imageLoad(nextHeightTex, sum);\n\n    float nextSedimentVal = advectedLocationHeight.b;\n\n    if(sum.x == 0) {\n        nextSedimentVal = nextHeightTexel.b;\n    }\n\n    if(sum.y == 0) {\n        nextSedimentVal = nextHeightTexel.b;\n    }\n\n    if(sum.x == 511) {\n        nextSedimentVal = nextHeightTexel.b;\n    }\n\n    if(sum.y == 511) {\n        nextSedimentVal = nextHeightTexel.b;\n    }\n\n    nextHeightTexel.b = nextSedimentVal;\n\n    imageStore(nextHeightTex, storePos, nextHeightTexel);\n}",
+	"Velocity.comp":           "#version 430 core\n\nlayout (local_size_x = 32, local_size_y = 32) in;\n\n#include \"include/simulation.glsl\"\n\nuniform float deltaTime;\n\nvoid main() {\n    /////----------------------------------\n    vec4 currentHeightTexel, currentOutflowTexel, currentVelocityTexel;\n    vec4 nextHeightTexel, nextOutflowTexel, nextVelocityTexel;\n    /////----------------------------------\n    ivec2 storePos = ivec2(gl_GlobalInvocationID.xy);\n    // Next Data\n    nextHeightTexel = imageLoad(nextHeightTex, storePos);\n    nextOutflowTexel = imageLoad(nextOutflowTex, storePos);\n    nextVelocityTexel = imageLoad(nextVelocityTex, storePos);\n\n    /////------------X Component of Velocity---------////////\n\n    /////------------LEFT INFLOW---------////////\n    ivec2 leftStorePos = ivec2(storePos.x - 1, storePos.y);\n    vec4 leftCurrentOuflow = imageLoad(nextOutflowTex, leftStorePos);\n    float leftCellRightOutflow = leftCurrentOuflow.g;\n\n    /////------------LEFT OUTFLOW---------////////\n    float currentCellLeftOutflow = nextOutflowTexel.r;\n\n    /////------------RIGHT OUTFLOW---------////////\n    float currentCellRightOutflow = nextOutflowTexel.g;\n\n    /////------------RIGHT INFLOW---------////////\n    ivec2 rightStorePos = ivec2(storePos.x + 1, storePos.y);\n    vec4 rightCurrentOuflow = imageLoad(nextOutflowTex, rightStorePos);\n    float rightCellLeftOutflow = rightCurrentOuflow.r;\n\n    float velX = 0.5 * (leftCellRightOutflow - currentCellLeftOutflow + currentCellRightOutflow - rightCellLeftOutflow);\n\n    /////------------Y Component of Velocity---------////////\n\n    /////------------TOP INFLOW---------////////\n    ivec2 topStorePos = ivec2(storePos.x, storePos.y - 1);\n    vec4 topCurrentOuflow = imageLoad(nextOutflowTex, topStorePos);\n    float topCellBottomOutflow = topCurrentOuflow.a;\n\n    /////------------TOP OUTFLOW---------////////\n    float currentCellTopOutflow = nextOutflowTexel.b;\n\n    /////------------BOTTOM OUTFLOW---------////////\n    float currentCellBottomOutflow = nextOutflowTexel.a;\n\n    /////------------BOTTOM INFLOW---------////////\n    ivec2 bottomStorePos = ivec2(storePos.x, storePos.y + 1);\n    vec4 bottomCurrentOuflow = imageLoad(nextOutflowTex, bottomStorePos);\n    float bottomCellTopOutflow = topCurrentOuflow.b;\n\n    float velY = 0.5 * (topCellBottomOutflow - currentCellTopOutflow + currentCellBottomOutflow - bottomCellTopOutflow);\n\n    vec2 velocity = vec2(velX, velY);\n    float velocityMagnitude = length(velocity);\n\n    vec4 newVel = vec4(velocityMagnitude, velX, velY, 0.0);\n    imageStore(nextVelocityTex, storePos, newVel);\n}",
+	"WaterHeight.comp":        "#version 430 core\n\nlayout (local_size_x = 32, local_size_y = 32) in;\n\n#include \"include/simulation.glsl\"\n\nuniform float deltaTime;\n\nvoid main() {\n    // TODO: 1. Bounds check\n    /////----------------------------------\n    vec4 nextHeightTexel, nextOutflowTexel;\n    /////----------------------------------\n    ivec2 storePos = ivec2(gl_GlobalInvocationID.xy);\n    // Next Data\n    nextHeightTexel = imageLoad(nextHeightTex, storePos);\n    nextOutflowTexel = imageLoad(nextOutflowTex, storePos);\n    /////----------------------------------\n\n    /////------------LEFT INFLOW---------////////\n    ivec2 leftStorePos = ivec2(storePos.x - 1, storePos.y);\n    vec4 leftCurrentOuflow = imageLoad(nextOutflowTex, leftStorePos);\n\n    // AKA Left Inflow\n    float leftCellRightOutflow = leftCurrentOuflow.g;\n\n    /////------------RIGHT INFLOW---------////////\n    ivec2 rightStorePos = ivec2(storePos.x + 1, storePos.y);\n    vec4 rightCurrentOuflow = imageLoad(nextOutflowTex, rightStorePos);\n\n    // AKA Right Inflow\n    float rightCellLeftOutflow = rightCurrentOuflow.r;\n\n    /////------------TOP INFLOW---------////////\n    ivec2 topStorePos = ivec2(storePos.x, storePos.y - 1);\n    vec4 topCurrentOuflow = imageLoad(nextOutflowTex, topStorePos);\n\n    // AKA Top Inflow\n    float topCellBottomOutflow = topCurrentOuflow.a;\n\n    /////------------BOTTOM INFLOW---------////////\n    ivec2 bottomStorePos = ivec2(storePos.x, storePos.y + 1);\n    vec4 bottomCurrentOuflow = imageLoad(nextOutflowTex, bottomStorePos);\n\n    // AKA Bottom Inflow\n    float bottomCellTopOutflow = bottomCurrentOuflow.b;\n\n    /////------------TOTAL OUTFLOW---------////////\n    float totalOutflow =\n        nextOutflowTexel.r\n        + nextOutflowTexel.g\n        + nextOutflowTexel.b\n        + nextOutflowTexel.a;\n\n    /////------------TOTAL INFLOW---------////////\n    float totalInflow =\n        leftCellRightOutflow\n        + rightCellLeftOutflow\n        + topCellBottomOutflow\n        + bottomCellTopOutflow;\n\n    /////------------WATER-H DELTA---------////////\n    float waterDeltaHeight = deltaTime * (totalInflow - totalOutflow);\n    nextHeightTexel.g += waterDeltaHeight;\n\n    imageStore(nextHeightTex, storePos, nextHeightTexel);\n}",
+	"WaterPass.comp":          "#version 430 core\n\nlayout (local_size_x = 32, local_size_y = 32) in;\n\n#include \"include/simulation.glsl\"\n\nuniform float deltaTime;\nuniform float waterIncrementRate;\nuniform int isRaining;\n\nvoid main() {\n\n    // TODO: Use mouse to add water?\n    // TODO: Toggle rain?\n    // TODO: . . .\n\n    vec4 heightTexel, outflowTexel;\n    ivec2 storePos = ivec2(gl_GlobalInvocationID.xy);\n    heightTexel = imageLoad(currentHeightTex, storePos);\n    outflowTexel = imageLoad(currentOutflowTex, storePos);\n\n    float rainRate = heightTexel.a;\n\n    // Update water height based on constant rain values for each terrain coord\n    if(isRaining == 1) {\n        heightTexel.g += rainRate * deltaTime * waterIncrementRate;\n    }\n\n    imageStore(nextHeightTex, storePos, heightTexel);\n}",
+	"include/height.glsl":     "// Filtered, mipmapped copy of the height state, see erosion.GPUEroder.HeightSampleTexture.\n// r -> terrainHeight, g -> waterHeight, b -> sediment, a -> rain rate.\nlayout (binding = 2) uniform sampler2D heightSampler;\n\n// The state at a fractional cell, the centre of cell (x, y) is at (x, y).\nvec4 stateAt(vec2 cell, float lod) {\n    vec2 size = vec2(textureSize(heightSampler, 0));\n    return textureLod(heightSampler, (cell + 0.5) / size, lod);\n}\n",
+	"include/simulation.glsl": "// Simulation state images, bound by erosion.GPUEroder.\n// Height: r -> terrainHeight, g -> waterHeight, b -> sediment, a -> constant rain rate.\n// Outflow: r -> left, g -> right, b -> top, a -> bottom.\n// Velocity: r -> speed, g -> x, b -> y.\nlayout (rgba32f, binding = 0) uniform highp image2D nextHeightTex;\nlayout (rgba32f, binding = 1) uniform highp image2D nextOutflowTex;\nlayout (rgba32f, binding = 2) uniform highp image2D nextVelocityTex;\n\nlayout (rgba32f, binding = 3) readonly uniform highp image2D currentHeightTex;\nlayout (rgba32f, binding = 4) readonly uniform highp image2D currentOutflowTex;\nlayout (rgba32f, binding = 5) readonly uniform highp image2D currentVelocityTex;\n",
+	"main.frag":               "#version 430 core\n\n// Keep in step with core.MaxMaterials and core.MaxRampStops.\n#define MAX_MATERIALS 8\n#define MAX_RAMP_STOPS 8\n\n// Keep in step with core.OverlayChannel.\nconst int OVERLAY_NONE = 0;\nconst int OVERLAY_WATER = 1;\nconst int OVERLAY_SEDIMENT = 2;\nconst int OVERLAY_SPEED = 3;\nconst int OVERLAY_DIRECTION = 4;\nconst int OVERLAY_OUTFLOW = 5;\nconst int OVERLAY_EROSION = 6;\nconst int OVERLAY_SLOPE = 7;\n\nuniform sampler2D tboHeightmap;\nuniform vec3 hitpos;\n// Radius of the ring drawn around the cursor, zero hides it.\nuniform float cursorRadius;\n\n// Material layers, painted over each other in order. See core.Material.\nuniform int materialCount;\nuniform vec3 materialColour[MAX_MATERIALS];\n// minHeight, maxHeight, minSlope, maxSlope (degrees)\nuniform vec4 materialRange[MAX_MATERIALS];\n// sharpness, scale\nuniform vec2 materialParams[MAX_MATERIALS];\nlayout (binding = 3) uniform sampler2DArray materialTextures;\n\n// Unit vector towards the sun.\nuniform vec3 lightDir;\n// Takes world positions into the shadow map, see core.ShadowMap.\nuniform mat4 lightSpace;\nuniform int shadowsEnabled;\nuniform float shadowBias;\nlayout (binding = 5) uniform sampler2DShadow shadowMap;\n// Fraction of the sky visible from each cell, see core.HorizonAO.\nuniform int aoEnabled;\nlayout (binding = 6) uniform sampler2D aoSampler;\n\n// Simulation channel overlay, see core.Overlay.\nuniform int overlayChannel;\nuniform float overlayMin;\nuniform float overlayMax;\nuniform float overlayOpacity;\nuniform int overlayRampStops;\nuniform vec3 overlayRamp[MAX_RAMP_STOPS];\nuniform int overlayArrows;\n// Cells between arrows, and the speed (cells per step) at which they reach full length.\nuniform float arrowSpacing;\nuniform float arrowSpeed;\n// Lines of constant height, see heightmap.ContourOptions.\nuniform int contoursEnabled;\nuniform float contourInterval;\nuniform float contourBase;\nuniform int contourIndexEvery;\n#include \"include/height.glsl\"\n// g -> x velocity, b -> y velocity, in cells.\nlayout (binding = 4) uniform sampler2D velocitySampler;\n// Flow out through each side of the cell.\nlayout (binding = 7) uniform sampler2D outflowSampler;\n// r -> height before erosion.\nlayout (binding = 8) uniform sampler2D initialHeightSampler;\n\nin vec2 fragTexCoord;\nin vec3 fragNormal;\nin vec3 vertex;\nin vec3 worldPos;\nin float terrainHeight;\n\nout vec4 color;\n\n/**\n * 1 inside [low, high], fading to 0 outside over a distance that shrinks as sharpness grows.\n */\nfloat band(float value, float low, float high, float sharpness) {\n    float fade = max((high - low) * 0.5 / max(sharpness, 0.001), 0.0001);\n    return smoothstep(low - fade, low, value) * (1.0 - smoothstep(high, high + fade, value));\n}\n\n/**\n * Samples a layer's albedo projected along each axis, weighted by the normal,\n * so steep faces aren't stretched the way a top-down projection would.\n */\nvec3 triplanar(int layer, vec3 position, vec3 n, float scale) {\n    vec3 weights = pow(abs(n), vec3(4.0));\n    weights /= weights.x + weights.y + weights.z;\n    vec3 p = position / scale;\n    vec3 x = texture(materialTextures, vec3(p.zy, layer)).rgb;\n    vec3 y = texture(materialTextures, vec3(p.xz, layer)).rgb;\n    vec3 z = texture(materialTextures, vec3(p.xy, layer)).rgb;\n    return x * weights.x + y * weights.y + z * weights.z;\n}\n\n/**\n * Fraction of the sunlight reaching this fragment, averaged over a 3x3 block of the shadow map.\n */\nfloat sunlight(vec3 n) {\n    if(shadowsEnabled == 0) {\n        return 1.0;\n    }\n    vec4 lightPos = lightSpace * vec4(worldPos, 1.0);\n    vec3 p = lightPos.xyz / lightPos.w * 0.5 + 0.5;\n    if(any(lessThan(p, vec3(0.0))) || any(greaterThan(p, vec3(1.0)))) {\n        return 1.0;\n    }\n    // Surfaces at a grazing angle to the sun need more bias.\n    float bias = shadowBias * (1.0 + 4.0 * (1.0 - max(dot(n, lightDir), 0.0)));\n    vec2 texel = 1.0 / vec2(textureSize(shadowMap, 0));\n    float lit = 0.0;\n    for(int x = -1; x <= 1; x++) {\n        for(int y = -1; y <= 1; y++) {\n            lit += texture(shadowMap, vec3(p.xy + vec2(x, y) * texel, p.z - bias));\n        }\n    }\n    return lit / 9.0;\n}\n\nvec3 ramp(float t) {\n    t = clamp(t, 0.0, 1.0) * float(overlayRampStops - 1);\n    int i = min(int(t), overlayRampStops - 2);\n    return mix(overlayRamp[i], overlayRamp[i + 1], t - float(i));\n}\n\nvec3 hue(float h) {\n    return clamp(abs(mod(h * 6.0 + vec3(0.0, 4.0, 2.0), 6.0) - 3.0) - 1.0, 0.0, 1.0);\n}\n\n/**\n * Colour of the overlay channel at this fragment.\n */\nvec3 overlayColour(float slope) {\n    float range = max(overlayMax - overlayMin, 1e-6);\n    if(overlayChannel == OVERLAY_DIRECTION) {\n        // Hue around the compass, brightness with speed.\n        vec2 v = texture(velocitySampler, fragTexCoord).gb;\n        float brightness = clamp((length(v) - overlayMin) / range, 0.0, 1.0);\n        return hue(atan(v.y, v.x) / 6.2831853 + 0.5) * brightness;\n    }\n    vec4 state = texture(heightSampler, fragTexCoord);\n    float value = 0.0;\n    if(overlayChannel == OVERLAY_WATER) {\n        value = state.g;\n    } else if(overlayChannel == OVERLAY_SEDIMENT) {\n        value = state.b;\n    } else if(overlayChannel == OVERLAY_SPEED) {\n        value = length(texture(velocitySampler, fragTexCoord).gb);\n    } else if(overlayChannel == OVERLAY_OUTFLOW) {\n        value = dot(texture(outflowSampler, fragTexCoord), vec4(1.0));\n    } else if(overlayChannel == OVERLAY_EROSION) {\n        value = state.r - texture(initialHeightSampler, fragTexCoord).r;\n    } else if(overlayChannel == OVERLAY_SLOPE) {\n        value = slope;\n    }\n    return ramp((value - overlayMin) / range);\n}\n\n/**\n * Coverage of a flow arrow at this fragment. Arrows sit on a grid of cells, each pointing\n * along the flow at its centre. Everything is in cell units, so the arrows keep their shape.\n */\nfloat flowArrow() {\n    vec2 size = vec2(textureSize(velocitySampler, 0));\n    vec2 cell = fragTexCoord * size - 0.5;\n    vec2 centre = (floor(cell / arrowSpacing) + 0.5) * arrowSpacing;\n    vec2 v = texture(velocitySampler, (centre + 0.5) / size).gb;\n    float speed = length(v);\n    if(speed < 1e-6) {\n        return 0.0;\n    }\n    vec2 along = v / speed;\n    vec2 p = cell - centre;\n    p = vec2(dot(p, along), dot(p, vec2(-along.y, along.x)));\n\n    float reach = arrowSpacing * 0.45 * clamp(speed / max(arrowSpeed, 1e-6), 0.2, 1.0);\n    float shaft = max(abs(p.y) - arrowSpacing * 0.03, max(-reach - p.x, p.x - reach * 0.3));\n    float head = max(abs(p.y) - (reach - p.x) * 0.45, max(reach * 0.3 - p.x, p.x - reach));\n    float d = min(shaft, head);\n    return 1.0 - smoothstep(0.0, fwidth(d), d);\n}\n\n/**\n * Coverage of a contour line at this fragment, index contours are twice as wide.\n */\nfloat contourLine() {\n    float f = (terrainHeight - contourBase) / contourInterval;\n    float k = floor(f + 0.5);\n    float width = 1.0;\n    if(contourIndexEvery > 0 && mod(k, float(contourIndexEvery)) == 0.0) {\n        width = 2.0;\n    }\n    // Distance to the nearest line in pixels.\n    float d = abs(f - k) / max(fwidth(f), 1e-6);\n    return 1.0 - smoothstep(width * 0.5, width * 0.5 + 1.0, d);\n}\n\nvoid main() {\n    vec3 lightColour = vec3(1.0);\n    vec3 ambient = 0.1 * lightColour;\n\n    vec3 n = normalize(fragNormal);\n    float slope = degrees(acos(clamp(n.y, -1.0, 1.0)));\n\n    // The first layer covers everything, the rest are painted on top.\n    vec3 terrainColour = vec3(0.5);\n    for(int i = 0; i < materialCount; i++) {\n        vec4 range = materialRange[i];\n        float sharpness = materialParams[i].x;\n        float weight = band(terrainHeight, range.x, range.y, sharpness) * band(slope, range.z, range.w, sharpness);\n        if(i == 0) {\n            weight = 1.0;\n        }\n        if(weight <= 0.0) {\n            continue;\n        }\n        vec3 albedo = materialColour[i] * triplanar(i, worldPos, n, max(materialParams[i].y, 0.001));\n        terrainColour = mix(terrainColour, albedo, weight);\n    }\n\n    // The water itself is drawn by its own pass, the ground under it is just darkened by being wet.\n    vec4 hmSample = texture2D(tboHeightmap, fragTexCoord);\n    terrainColour *= mix(1.0, 0.6, clamp(hmSample.g * 50.0, 0.0, 1.0));\n\n    if(aoEnabled == 1) {\n        ambient *= texture(aoSampler, fragTexCoord).r;\n    }\n\n    float diff = max(dot(lightDir, n), 0.0);\n\n    vec3 diffuse = lightColour * diff * sunlight(n);\n\n    vec3 result = (ambient + diffuse) * terrainColour;\n\n    // Overlays are shaded enough to keep the relief readable.\n    if(overlayChannel != OVERLAY_NONE) {\n        vec3 overlay = overlayColour(slope) * (0.4 + 0.6 * diff);\n        result = mix(result, overlay, overlayOpacity);\n    }\n    if(overlayArrows == 1) {\n        result = mix(result, vec3(0.05), flowArrow() * 0.85);\n    }\n    if(contoursEnabled == 1) {\n        result = mix(result, vec3(0.35, 0.2, 0.08), contourLine() * 0.8);\n    }\n\n    // Cursor marker, a ring around the hit position with a dot in the middle.\n    if(cursorRadius > 0.0) {\n        float d = distance(vertex.xz, hitpos.xz);\n        float width = fwidth(d) * 1.5;\n        float ring = 1.0 - smoothstep(0.0, width, abs(d - cursorRadius));\n        float centre = 1.0 - smoothstep(0.0, width, d - cursorRadius * 0.05);\n        result = mix(result, vec3(1.0, 0.3, 0.1), max(ring, centre));\n    }\n\n    color = vec4(result, 1.0);\n}\n",
+	"main.vert":               "#version 430 core\n\nuniform mat4 projection;\nuniform mat4 camera;\nuniform mat4 model;\nuniform float height;\nuniform float skirtDepth;\nuniform vec3 hitpos;\nuniform sampler2D tboHeightmap;\n// Mip level matching the spacing of the mesh over the simulation cells.\nuniform float sampleLod;\n\n#include \"include/height.glsl\"\n\n// Skirt vertices have a y of -1, everything else 0.\nlayout (location = 0) in vec3 vert;\nlayout (location = 1) in vec3 normal;\nlayout (location = 2) in vec2 texcoord;\nlayout (location = 3) in vec2 sampleCoord;\n\nout vec2 fragTexCoord;\nout vec3 fragNormal;\nout vec3 vertex;\nout vec3 worldPos;\nout float terrainHeight;\n\nvoid main() {\n    vertex = vert;\n\n    // Sample coords are fractional cell positions, the centre of cell (x, y) is at (x + 0.5) / size.\n    vec2 stateSize = vec2(textureSize(heightSampler, 0));\n    fragTexCoord = (sampleCoord + 0.5) / stateSize;\n    fragNormal = mat3(model) * normal;\n\n    terrainHeight = textureLod(heightSampler, fragTexCoord, sampleLod).r;\n\n    float skirt = min(vert.y, 0.0) * skirtDepth;\n\n    worldPos = vec3(vert.x, terrainHeight * height + skirt, vert.z);\n    gl_Position = projection * camera * vec4(worldPos, 1.0);\n}",
+	"shadow.frag":             "#version 430 core\n\n// Depth only.\nvoid main() {\n}\n",
+	"shadow.vert":             "#version 430 core\n\nuniform mat4 lightSpace;\nuniform float height;\nuniform float skirtDepth;\n// Mip level matching the spacing of the mesh over the simulation cells.\nuniform float sampleLod;\n\n#include \"include/height.glsl\"\n\n// Same layout as the terrain, skirt vertices have a y of -1.\nlayout (location = 0) in vec3 vert;\nlayout (location = 3) in vec2 sampleCoord;\n\nvoid main() {\n    float terrainHeight = stateAt(sampleCoord, sampleLod).r;\n    float skirt = min(vert.y, 0.0) * skirtDepth;\n    gl_Position = lightSpace * vec4(vert.x, terrainHeight * height + skirt, vert.z, 1.0);\n}\n",
+	"water.frag":              "#version 430 core\n\nuniform vec3 cameraPos;\nuniform vec3 lightDir;\nuniform float time;\nuniform float height;\nuniform float cellSize;\n\n// See core.WaterSettings.\nuniform vec3 shallowColour;\nuniform vec3 deepColour;\nuniform float absorption;\nuniform float minDepth;\nuniform float shininess;\nuniform float rippleScale;\nuniform float rippleStrength;\nuniform float flowSpeed;\n\n#include \"include/height.glsl\"\n// g -> x velocity, b -> y velocity, in cells.\nlayout (binding = 4) uniform sampler2D velocitySampler;\n\nin vec2 fragTexCoord;\nin vec3 worldPos;\n\nout vec4 color;\n\nconst vec3 skyColour = vec3(0.6, 0.75, 0.9);\n// Seconds for the ripples to be dragged one full cycle along the flow.\nconst float flowCycle = 2.0;\n\nfloat hash(vec2 p) {\n    return fract(sin(dot(p, vec2(127.1, 311.7))) * 43758.5453);\n}\n\nfloat noise(vec2 p) {\n    vec2 cell = floor(p);\n    vec2 t = p - cell;\n    t = t * t * (3.0 - 2.0 * t);\n    float top = mix(hash(cell), hash(cell + vec2(1.0, 0.0)), t.x);\n    float bottom = mix(hash(cell + vec2(0.0, 1.0)), hash(cell + vec2(1.0, 1.0)), t.x);\n    return mix(top, bottom, t.y);\n}\n\nfloat ripples(vec2 p) {\n    return noise(p) * 0.5 + noise(p * 2.1 + 17.0) * 0.3 + noise(p * 4.3 + 31.0) * 0.2;\n}\n\n/**\n * Slope of the ripple pattern, in world units.\n */\nvec2 rippleGradient(vec2 p) {\n    const float e = 0.05;\n    float centre = ripples(p);\n    return vec2(ripples(p + vec2(e, 0.0)) - centre, ripples(p + vec2(0.0, e)) - centre) / e;\n}\n\nfloat surfaceAt(vec2 uv) {\n    vec4 state = texture(heightSampler, uv);\n    return state.r + state.g;\n}\n\nvoid main() {\n    float depth = texture(heightSampler, fragTexCoord).g;\n    if(depth < minDepth) {\n        discard;\n    }\n\n    // Normal of the water surface itself, the cell x axis runs along world Z and the cell y axis along world X.\n    vec2 texel = 1.0 / vec2(textureSize(heightSampler, 0));\n    float dx = (surfaceAt(fragTexCoord + vec2(texel.x, 0.0)) - surfaceAt(fragTexCoord - vec2(texel.x, 0.0))) * 0.5;\n    float dy = (surfaceAt(fragTexCoord + vec2(0.0, texel.y)) - surfaceAt(fragTexCoord - vec2(0.0, texel.y))) * 0.5;\n    vec3 n = normalize(vec3(-dy * height / cellSize, 1.0, -dx * height / cellSize));\n\n    // Ripples are dragged along the flow, crossfading between two copies half a cycle apart\n    // so they never stretch too far.\n    vec2 velocity = texture(velocitySampler, fragTexCoord).gb;\n    vec2 flow = vec2(velocity.y, velocity.x) * cellSize * flowSpeed / rippleScale;\n    float phase0 = fract(time / flowCycle);\n    float phase1 = fract(time / flowCycle + 0.5);\n    float crossfade = abs(1.0 - 2.0 * phase0);\n    vec2 p = worldPos.xz / rippleScale;\n    vec2 gradient = mix(rippleGradient(p - flow * phase0), rippleGradient(p - flow * phase1 + 0.5), crossfade);\n    n = normalize(n - vec3(gradient.x, 0.0, gradient.y) * rippleStrength);\n\n    vec3 view = normalize(cameraPos - worldPos);\n    vec3 light = normalize(lightDir);\n\n    // Schlick's approximation, with the reflectance of water head on.\n    float fresnel = 0.02 + 0.98 * pow(1.0 - max(dot(n, view), 0.0), 5.0);\n    float specular = pow(max(dot(n, normalize(light + view)), 0.0), shininess);\n\n    // Light passing through the water is absorbed with depth.\n    float transmittance = exp(-absorption * depth * height);\n    vec3 body = mix(deepColour, shallowColour, transmittance) * (0.3 + 0.7 * max(dot(n, light), 0.0));\n    vec3 result = mix(body, skyColour, fresnel) + vec3(specular);\n\n    // Fade out at the edges of the water rather than cutting off.\n    float edge = smoothstep(minDepth, max(minDepth * 4.0, minDepth + 0.0001), depth);\n    float alpha = clamp(1.0 - transmittance + fresnel + specular, 0.0, 1.0) * edge;\n\n    color = vec4(result, alpha);\n}\n",
+	"water.vert":              "#version 430 core\n\nuniform mat4 projection;\nuniform mat4 camera;\nuniform float height;\n// Mip level matching the spacing of the mesh over the simulation cells.\nuniform float sampleLod;\n\n#include \"include/height.glsl\"\n\n// Same layout as the terrain, skirts are flattened onto the surface.\nlayout (location = 0) in vec3 vert;\nlayout (location = 3) in vec2 sampleCoord;\n\nout vec2 fragTexCoord;\nout vec3 worldPos;\n\nvoid main() {\n    vec2 stateSize = vec2(textureSize(heightSampler, 0));\n    fragTexCoord = (sampleCoord + 0.5) / stateSize;\n\n    vec4 state = textureLod(heightSampler, fragTexCoord, sampleLod);\n    worldPos = vec3(vert.x, (state.r + state.g) * height, vert.z);\n    gl_Position = projection * camera * vec4(worldPos, 1.0);\n}\n",
+}
@@ -0,0 +1,9 @@
+// Filtered, mipmapped copy of the height state, see erosion.GPUEroder.HeightSampleTexture.
+// r -> terrainHeight, g -> waterHeight, b -> sediment, a -> rain rate.
+layout (binding = 2) uniform sampler2D heightSampler;
+
+// The state at a fractional cell, the centre of cell (x, y) is at (x, y).
+vec4 stateAt(vec2 cell, float lod) {
+    vec2 size = vec2(textureSize(heightSampler, 0));
+    return textureLod(heightSampler, (cell + 0.5) / size, lod);
+}
@@ -0,0 +1,11 @@
+// Simulation state images, bound by erosion.GPUEroder.
+// Height: r -> terrainHeight, g -> waterHeight, b -> sediment, a -> constant rain rate.
+// Outflow: r -> left, g -> right, b -> top, a -> bottom.
+// Velocity: r -> speed, g -> x, b -> y.
+layout (rgba32f, binding = 0) uniform highp image2D nextHeightTex;
+layout (rgba32f, binding = 1) uniform highp image2D nextOutflowTex;
+layout (rgba32f, binding = 2) uniform highp image2D nextVelocityTex;
+
+layout (rgba32f, binding = 3) readonly uniform highp image2D currentHeightTex;
+layout (rgba32f, binding = 4) readonly uniform highp image2D currentOutflowTex;
+layout (rgba32f, binding = 5) readonly uniform highp image2D currentVelocityTex;
@@ -1,57 +1,257 @@
 #version 430 core
 
+// Keep in step with core.MaxMaterials and core.MaxRampStops.
+#define MAX_MATERIALS 8
+#define MAX_RAMP_STOPS 8
+
+// Keep in step with core.OverlayChannel.
+const int OVERLAY_NONE = 0;
+const int OVERLAY_WATER = 1;
+const int OVERLAY_SEDIMENT = 2;
+const int OVERLAY_SPEED = 3;
+const int OVERLAY_DIRECTION = 4;
+const int OVERLAY_OUTFLOW = 5;
+const int OVERLAY_EROSION = 6;
+const int OVERLAY_SLOPE = 7;
+
 uniform sampler2D tboHeightmap;
 uniform vec3 hitpos;
-uniform float lightingDir;
+// Radius of the ring drawn around the cursor, zero hides it.
+uniform float cursorRadius;
+
+// Material layers, painted over each other in order. See core.Material.
+uniform int materialCount;
+uniform vec3 materialColour[MAX_MATERIALS];
+// minHeight, maxHeight, minSlope, maxSlope (degrees)
+uniform vec4 materialRange[MAX_MATERIALS];
+// sharpness, scale
+uniform vec2 materialParams[MAX_MATERIALS];
+layout (binding = 3) uniform sampler2DArray materialTextures;
+
+// Unit vector towards the sun.
+uniform vec3 lightDir;
+// Takes world positions into the shadow map, see core.ShadowMap.
+uniform mat4 lightSpace;
+uniform int shadowsEnabled;
+uniform float shadowBias;
+layout (binding = 5) uniform sampler2DShadow shadowMap;
+// Fraction of the sky visible from each cell, see core.HorizonAO.
+uniform int aoEnabled;
+layout (binding = 6) uniform sampler2D aoSampler;
 
-layout (rgba32f, binding = 0) readonly uniform highp image2D nextHeightTex;
-layout (rgba32f, binding = 2) readonly uniform highp image2D nextVelocityTex;
+// Simulation channel overlay, see core.Overlay.
+uniform int overlayChannel;
+uniform float overlayMin;
+uniform float overlayMax;
+uniform float overlayOpacity;
+uniform int overlayRampStops;
+uniform vec3 overlayRamp[MAX_RAMP_STOPS];
+uniform int overlayArrows;
+// Cells between arrows, and the speed (cells per step) at which they reach full length.
+uniform float arrowSpacing;
+uniform float arrowSpeed;
+// Lines of constant height, see heightmap.ContourOptions.
+uniform int contoursEnabled;
+uniform float contourInterval;
+uniform float contourBase;
+uniform int contourIndexEvery;
+#include "include/height.glsl"
+// g -> x velocity, b -> y velocity, in cells.
+layout (binding = 4) uniform sampler2D velocitySampler;
+// Flow out through each side of the cell.
+layout (binding = 7) uniform sampler2D outflowSampler;
+// r -> height before erosion.
+layout (binding = 8) uniform sampler2D initialHeightSampler;
 
 in vec2 fragTexCoord;
+in vec3 fragNormal;
 in vec3 vertex;
-
+in vec3 worldPos;
 in float terrainHeight;
 
 out vec4 color;
 
+/**
+ * 1 inside [low, high], fading to 0 outside over a distance that shrinks as sharpness grows.
+ */
+float band(float value, float low, float high, float sharpness) {
+    float fade = max((high - low) * 0.5 / max(sharpness, 0.001), 0.0001);
+    return smoothstep(low - fade, low, value) * (1.0 - smoothstep(high, high + fade, value));
+}
+
+/**
+ * Samples a layer's albedo projected along each axis, weighted by the normal,
+ * so steep faces aren't stretched the way a top-down projection would.
+ */
+vec3 triplanar(int layer, vec3 position, vec3 n, float scale) {
+    vec3 weights = pow(abs(n), vec3(4.0));
+    weights /= weights.x + weights.y + weights.z;
+    vec3 p = position / scale;
+    vec3 x = texture(materialTextures, vec3(p.zy, layer)).rgb;
+    vec3 y = texture(materialTextures, vec3(p.xz, layer)).rgb;
+    vec3 z = texture(materialTextures, vec3(p.xy, layer)).rgb;
+    return x * weights.x + y * weights.y + z * weights.z;
+}
+
+/**
+ * Fraction of the sunlight reaching this fragment, averaged over a 3x3 block of the shadow map.
+ */
+float sunlight(vec3 n) {
+    if(shadowsEnabled == 0) {
+        return 1.0;
+    }
+    vec4 lightPos = lightSpace * vec4(worldPos, 1.0);
+    vec3 p = lightPos.xyz / lightPos.w * 0.5 + 0.5;
+    if(any(lessThan(p, vec3(0.0))) || any(greaterThan(p, vec3(1.0)))) {
+        return 1.0;
+    }
+    // Surfaces at a grazing angle to the sun need more bias.
+    float bias = shadowBias * (1.0 + 4.0 * (1.0 - max(dot(n, lightDir), 0.0)));
+    vec2 texel = 1.0 / vec2(textureSize(shadowMap, 0));
+    float lit = 0.0;
+    for(int x = -1; x <= 1; x++) {
+        for(int y = -1; y <= 1; y++) {
+            lit += texture(shadowMap, vec3(p.xy + vec2(x, y) * texel, p.z - bias));
+        }
+    }
+    return lit / 9.0;
+}
+
+vec3 ramp(float t) {
+    t = clamp(t, 0.0, 1.0) * float(overlayRampStops - 1);
+    int i = min(int(t), overlayRampStops - 2);
+    return mix(overlayRamp[i], overlayRamp[i + 1], t - float(i));
+}
+
+vec3 hue(float h) {
+    return clamp(abs(mod(h * 6.0 + vec3(0.0, 4.0, 2.0), 6.0) - 3.0) - 1.0, 0.0, 1.0);
+}
+
+/**
+ * Colour of the overlay channel at this fragment.
+ */
+vec3 overlayColour(float slope) {
+    float range = max(overlayMax - overlayMin, 1e-6);
+    if(overlayChannel == OVERLAY_DIRECTION) {
+        // Hue around the compass, brightness with speed.
+        vec2 v = texture(velocitySampler, fragTexCoord).gb;
+        float brightness = clamp((length(v) - overlayMin) / range, 0.0, 1.0);
+        return hue(atan(v.y, v.x) / 6.2831853 + 0.5) * brightness;
+    }
+    vec4 state = texture(heightSampler, fragTexCoord);
+    float value = 0.0;
+    if(overlayChannel == OVERLAY_WATER) {
+        value = state.g;
+    } else if(overlayChannel == OVERLAY_SEDIMENT) {
+        value = state.b;
+    } else if(overlayChannel == OVERLAY_SPEED) {
+        value = length(texture(velocitySampler, fragTexCoord).gb);
+    } else if(overlayChannel == OVERLAY_OUTFLOW) {
+        value = dot(texture(outflowSampler, fragTexCoord), vec4(1.0));
+    } else if(overlayChannel == OVERLAY_EROSION) {
+        value = state.r - texture(initialHeightSampler, fragTexCoord).r;
+    } else if(overlayChannel == OVERLAY_SLOPE) {
+        value = slope;
+    }
+    return ramp((value - overlayMin) / range);
+}
+
+/**
+ * Coverage of a flow arrow at this fragment. Arrows sit on a grid of cells, each pointing
+ * along the flow at its centre. Everything is in cell units, so the arrows keep their shape.
+ */
+float flowArrow() {
+    vec2 size = vec2(textureSize(velocitySampler, 0));
+    vec2 cell = fragTexCoord * size - 0.5;
+    vec2 centre = (floor(cell / arrowSpacing) + 0.5) * arrowSpacing;
+    vec2 v = texture(velocitySampler, (centre + 0.5) / size).gb;
+    float speed = length(v);
+    if(speed < 1e-6) {
+        return 0.0;
+    }
+    vec2 along = v / speed;
+    vec2 p = cell - centre;
+    p = vec2(dot(p, along), dot(p, vec2(-along.y, along.x)));
+
+    float reach = arrowSpacing * 0.45 * clamp(speed / max(arrowSpeed, 1e-6), 0.2, 1.0);
+    float shaft = max(abs(p.y) - arrowSpacing * 0.03, max(-reach - p.x, p.x - reach * 0.3));
+    float head = max(abs(p.y) - (reach - p.x) * 0.45, max(reach * 0.3 - p.x, p.x - reach));
+    float d = min(shaft, head);
+    return 1.0 - smoothstep(0.0, fwidth(d), d);
+}
+
+/**
+ * Coverage of a contour line at this fragment, index contours are twice as wide.
+ */
+float contourLine() {
+    float f = (terrainHeight - contourBase) / contourInterval;
+    float k = floor(f + 0.5);
+    float width = 1.0;
+    if(contourIndexEvery > 0 && mod(k, float(contourIndexEvery)) == 0.0) {
+        width = 2.0;
+    }
+    // Distance to the nearest line in pixels.
+    float d = abs(f - k) / max(fwidth(f), 1e-6);
+    return 1.0 - smoothstep(width * 0.5, width * 0.5 + 1.0, d);
+}
+
 void main() {
     vec3 lightColour = vec3(1.0);
     vec3 ambient = 0.1 * lightColour;
 
-    vec3 height_colours[3];
-    height_colours[0] = vec3(0.1, 0.8, 0.1);
-    height_colours[1] =  vec3(0.4, 0.8, 0.4);
-    height_colours[2] = vec3(1.0,1.0,1.0);
+    vec3 n = normalize(fragNormal);
+    float slope = degrees(acos(clamp(n.y, -1.0, 1.0)));
 
-    vec3 terrainColour = vec3(0.0, 1.0, 0.0);
-    vec3 waterColour = vec3(0.0, 0.0, 1.0);
-    vec4 hmSample = texture2D(tboHeightmap, fragTexCoord);
-    float height = hmSample.r * 2.0;
-    if(height < 1.0) {
-        terrainColour = mix(height_colours[1], height_colours[0], 2.0 - height);
-    } else {
-        terrainColour = mix(height_colours[2], height_colours[1], 2.0 - height);
+    // The first layer covers everything, the rest are painted on top.
+    vec3 terrainColour = vec3(0.5);
+    for(int i = 0; i < materialCount; i++) {
+        vec4 range = materialRange[i];
+        float sharpness = materialParams[i].x;
+        float weight = band(terrainHeight, range.x, range.y, sharpness) * band(slope, range.z, range.w, sharpness);
+        if(i == 0) {
+            weight = 1.0;
+        }
+        if(weight <= 0.0) {
+            continue;
+        }
+        vec3 albedo = materialColour[i] * triplanar(i, worldPos, n, max(materialParams[i].y, 0.001));
+        terrainColour = mix(terrainColour, albedo, weight);
     }
-    terrainColour = mix(terrainColour, waterColour, hmSample.g * 10.0);
 
-    vec3 offset = vec3(-1.0/512.0, 0.0, 1.0/512.0);
-
-    float s1 = texture2D(tboHeightmap, fragTexCoord + offset.xy).r;
-    float s2 = texture2D(tboHeightmap, fragTexCoord + offset.zy).r;
-    float s3 = texture2D(tboHeightmap, fragTexCoord + offset.yx).r;
-    float s4 = texture2D(tboHeightmap, fragTexCoord + offset.yz).r;
-    vec3 va = normalize(vec3(lightingDir, 0.0, s2 - s1));
-    vec3 vb = normalize(vec3(0.0, lightingDir, s3 - s4));
-    vec3 n = normalize(cross(va, vb));
+    // The water itself is drawn by its own pass, the ground under it is just darkened by being wet.
+    vec4 hmSample = texture2D(tboHeightmap, fragTexCoord);
+    terrainColour *= mix(1.0, 0.6, clamp(hmSample.g * 50.0, 0.0, 1.0));
 
+    if(aoEnabled == 1) {
+        ambient *= texture(aoSampler, fragTexCoord).r;
+    }
 
-    vec3 lightPos = vec3(0.5, 2.0, 0.5);
-    vec3 lightDir = normalize(lightPos);
     float diff = max(dot(lightDir, n), 0.0);
 
-    vec3 diffuse = lightColour * diff;
+    vec3 diffuse = lightColour * diff * sunlight(n);
 
     vec3 result = (ambient + diffuse) * terrainColour;
 
+    // Overlays are shaded enough to keep the relief readable.
+    if(overlayChannel != OVERLAY_NONE) {
+        vec3 overlay = overlayColour(slope) * (0.4 + 0.6 * diff);
+        result = mix(result, overlay, overlayOpacity);
+    }
+    if(overlayArrows == 1) {
+        result = mix(result, vec3(0.05), flowArrow() * 0.85);
+    }
+    if(contoursEnabled == 1) {
+        result = mix(result, vec3(0.35, 0.2, 0.08), contourLine() * 0.8);
+    }
+
+    // Cursor marker, a ring around the hit position with a dot in the middle.
+    if(cursorRadius > 0.0) {
+        float d = distance(vertex.xz, hitpos.xz);
+        float width = fwidth(d) * 1.5;
+        float ring = 1.0 - smoothstep(0.0, width, abs(d - cursorRadius));
+        float centre = 1.0 - smoothstep(0.0, width, d - cursorRadius * 0.05);
+        result = mix(result, vec3(1.0, 0.3, 0.1), max(ring, centre));
+    }
+
     color = vec4(result, 1.0);
-}
\ No newline at end of file
+}
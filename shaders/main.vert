@@ -3,28 +3,39 @@
 uniform mat4 projection;
 uniform mat4 camera;
 uniform mat4 model;
-uniform float angle;
 uniform float height;
+uniform float skirtDepth;
 uniform vec3 hitpos;
 uniform sampler2D tboHeightmap;
+// Mip level matching the spacing of the mesh over the simulation cells.
+uniform float sampleLod;
 
-layout (rgba32f, binding = 0) readonly uniform highp image2D nextHeightTex;
+#include "include/height.glsl"
 
+// Skirt vertices have a y of -1, everything else 0.
 layout (location = 0) in vec3 vert;
 layout (location = 1) in vec3 normal;
 layout (location = 2) in vec2 texcoord;
-layout (location = 3) in float lookupIndex;
+layout (location = 3) in vec2 sampleCoord;
 
 out vec2 fragTexCoord;
+out vec3 fragNormal;
 out vec3 vertex;
+out vec3 worldPos;
+out float terrainHeight;
 
 void main() {
     vertex = vert;
 
-    fragTexCoord = normal.xy * (1/512.0);
+    // Sample coords are fractional cell positions, the centre of cell (x, y) is at (x + 0.5) / size.
+    vec2 stateSize = vec2(textureSize(heightSampler, 0));
+    fragTexCoord = (sampleCoord + 0.5) / stateSize;
+    fragNormal = mat3(model) * normal;
 
-    vec4 heightTexel = imageLoad(nextHeightTex, ivec2(int(normal.x), int(normal.y)));
-    float terrainHeight = heightTexel.r;
+    terrainHeight = textureLod(heightSampler, fragTexCoord, sampleLod).r;
 
-    gl_Position = projection * camera * vec4(vec3(vert.x, terrainHeight * height, vert.z), 1.0);
+    float skirt = min(vert.y, 0.0) * skirtDepth;
+
+    worldPos = vec3(vert.x, terrainHeight * height + skirt, vert.z);
+    gl_Position = projection * camera * vec4(worldPos, 1.0);
 }
\ No newline at end of file
@@ -0,0 +1,23 @@
+package shaders
+
+/**
+ * The GLSL sources, built into the binary so it runs from any directory.
+ * embedded.go is generated from the files alongside it, run `go generate ./shaders` after editing them.
+ */
+
+//go:generate go run embed.go
+
+/**
+ * The built-in copy of a shader, by its path under this directory, eg "include/simulation.glsl".
+ */
+func Source(name string) (string, bool) {
+	source, ok := sources[name]
+	return source, ok
+}
+
+/**
+ * Paths of the built-in shaders, sorted.
+ */
+func Names() []string {
+	return names
+}
@@ -0,0 +1,5 @@
+#version 430 core
+
+// Depth only.
+void main() {
+}
@@ -0,0 +1,19 @@
+#version 430 core
+
+uniform mat4 lightSpace;
+uniform float height;
+uniform float skirtDepth;
+// Mip level matching the spacing of the mesh over the simulation cells.
+uniform float sampleLod;
+
+#include "include/height.glsl"
+
+// Same layout as the terrain, skirt vertices have a y of -1.
+layout (location = 0) in vec3 vert;
+layout (location = 3) in vec2 sampleCoord;
+
+void main() {
+    float terrainHeight = stateAt(sampleCoord, sampleLod).r;
+    float skirt = min(vert.y, 0.0) * skirtDepth;
+    gl_Position = lightSpace * vec4(vert.x, terrainHeight * height + skirt, vert.z, 1.0);
+}
@@ -0,0 +1,103 @@
+#version 430 core
+
+uniform vec3 cameraPos;
+uniform vec3 lightDir;
+uniform float time;
+uniform float height;
+uniform float cellSize;
+
+// See core.WaterSettings.
+uniform vec3 shallowColour;
+uniform vec3 deepColour;
+uniform float absorption;
+uniform float minDepth;
+uniform float shininess;
+uniform float rippleScale;
+uniform float rippleStrength;
+uniform float flowSpeed;
+
+#include "include/height.glsl"
+// g -> x velocity, b -> y velocity, in cells.
+layout (binding = 4) uniform sampler2D velocitySampler;
+
+in vec2 fragTexCoord;
+in vec3 worldPos;
+
+out vec4 color;
+
+const vec3 skyColour = vec3(0.6, 0.75, 0.9);
+// Seconds for the ripples to be dragged one full cycle along the flow.
+const float flowCycle = 2.0;
+
+float hash(vec2 p) {
+    return fract(sin(dot(p, vec2(127.1, 311.7))) * 43758.5453);
+}
+
+float noise(vec2 p) {
+    vec2 cell = floor(p);
+    vec2 t = p - cell;
+    t = t * t * (3.0 - 2.0 * t);
+    float top = mix(hash(cell), hash(cell + vec2(1.0, 0.0)), t.x);
+    float bottom = mix(hash(cell + vec2(0.0, 1.0)), hash(cell + vec2(1.0, 1.0)), t.x);
+    return mix(top, bottom, t.y);
+}
+
+float ripples(vec2 p) {
+    return noise(p) * 0.5 + noise(p * 2.1 + 17.0) * 0.3 + noise(p * 4.3 + 31.0) * 0.2;
+}
+
+/**
+ * Slope of the ripple pattern, in world units.
+ */
+vec2 rippleGradient(vec2 p) {
+    const float e = 0.05;
+    float centre = ripples(p);
+    return vec2(ripples(p + vec2(e, 0.0)) - centre, ripples(p + vec2(0.0, e)) - centre) / e;
+}
+
+float surfaceAt(vec2 uv) {
+    vec4 state = texture(heightSampler, uv);
+    return state.r + state.g;
+}
+
+void main() {
+    float depth = texture(heightSampler, fragTexCoord).g;
+    if(depth < minDepth) {
+        discard;
+    }
+
+    // Normal of the water surface itself, the cell x axis runs along world Z and the cell y axis along world X.
+    vec2 texel = 1.0 / vec2(textureSize(heightSampler, 0));
+    float dx = (surfaceAt(fragTexCoord + vec2(texel.x, 0.0)) - surfaceAt(fragTexCoord - vec2(texel.x, 0.0))) * 0.5;
+    float dy = (surfaceAt(fragTexCoord + vec2(0.0, texel.y)) - surfaceAt(fragTexCoord - vec2(0.0, texel.y))) * 0.5;
+    vec3 n = normalize(vec3(-dy * height / cellSize, 1.0, -dx * height / cellSize));
+
+    // Ripples are dragged along the flow, crossfading between two copies half a cycle apart
+    // so they never stretch too far.
+    vec2 velocity = texture(velocitySampler, fragTexCoord).gb;
+    vec2 flow = vec2(velocity.y, velocity.x) * cellSize * flowSpeed / rippleScale;
+    float phase0 = fract(time / flowCycle);
+    float phase1 = fract(time / flowCycle + 0.5);
+    float crossfade = abs(1.0 - 2.0 * phase0);
+    vec2 p = worldPos.xz / rippleScale;
+    vec2 gradient = mix(rippleGradient(p - flow * phase0), rippleGradient(p - flow * phase1 + 0.5), crossfade);
+    n = normalize(n - vec3(gradient.x, 0.0, gradient.y) * rippleStrength);
+
+    vec3 view = normalize(cameraPos - worldPos);
+    vec3 light = normalize(lightDir);
+
+    // Schlick's approximation, with the reflectance of water head on.
+    float fresnel = 0.02 + 0.98 * pow(1.0 - max(dot(n, view), 0.0), 5.0);
+    float specular = pow(max(dot(n, normalize(light + view)), 0.0), shininess);
+
+    // Light passing through the water is absorbed with depth.
+    float transmittance = exp(-absorption * depth * height);
+    vec3 body = mix(deepColour, shallowColour, transmittance) * (0.3 + 0.7 * max(dot(n, light), 0.0));
+    vec3 result = mix(body, skyColour, fresnel) + vec3(specular);
+
+    // Fade out at the edges of the water rather than cutting off.
+    float edge = smoothstep(minDepth, max(minDepth * 4.0, minDepth + 0.0001), depth);
+    float alpha = clamp(1.0 - transmittance + fresnel + specular, 0.0, 1.0) * edge;
+
+    color = vec4(result, alpha);
+}
@@ -0,0 +1,25 @@
+#version 430 core
+
+uniform mat4 projection;
+uniform mat4 camera;
+uniform float height;
+// Mip level matching the spacing of the mesh over the simulation cells.
+uniform float sampleLod;
+
+#include "include/height.glsl"
+
+// Same layout as the terrain, skirts are flattened onto the surface.
+layout (location = 0) in vec3 vert;
+layout (location = 3) in vec2 sampleCoord;
+
+out vec2 fragTexCoord;
+out vec3 worldPos;
+
+void main() {
+    vec2 stateSize = vec2(textureSize(heightSampler, 0));
+    fragTexCoord = (sampleCoord + 0.5) / stateSize;
+
+    vec4 state = textureLod(heightSampler, fragTexCoord, sampleLod);
+    worldPos = vec3(vert.x, (state.r + state.g) * height, vert.z);
+    gl_Position = projection * camera * vec4(worldPos, 1.0);
+}
@@ -3,7 +3,6 @@ package utils
 import (
 	"bufio"
 	"github.com/inkyblackness/imgui-go/v2"
-	"log"
 	"math/rand"
 	"os"
 )
@@ -11,7 +10,7 @@ import (
 func ReadTextFile(path string) (body string, err error) {
 	file, err := os.Open(path)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 	defer file.Close()
 	scanner := bufio.NewScanner(file)
@@ -19,9 +18,9 @@ func ReadTextFile(path string) (body string, err error) {
 		body += scanner.Text() + "\n"
 	}
 	if err := scanner.Err(); err != nil {
-		log.Fatal(err)
+		return "", err
 	}
-	return body, err
+	return body, nil
 }
 
 func ToIndex(x, y, width int) int {
@@ -68,6 +67,8 @@ const (
 	GREEN byte = 2
 	BLUE byte = 4
 	ALPHA byte = 8
+	// All four channels as they are, rather than one of them as grey.
+	COLOUR byte = 16
 )
 
 func FullColourTextureId(handle uint32, channels byte) imgui.TextureID {